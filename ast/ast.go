@@ -4,12 +4,15 @@ import (
 	"bytes"
 	"fmt"
 	"github.com/qiuhoude/go-interpreter/token"
+	"math/big"
 	"strings"
 )
 
 type Node interface {
 	fmt.Stringer
 	TokenLiteral() string
+	Pos() token.Position // 节点第一个字符的位置
+	End() token.Position // 节点之后第一个字符的位置
 }
 
 type Statement interface {
@@ -27,6 +30,7 @@ type Expression interface {
 // Program Node is root node
 type Program struct {
 	Statements []Statement
+	Comments   []token.Token // 源码中的注释, 按出现顺序. 只有 lexer 开启 ScanComments 时才有
 }
 
 func (p *Program) TokenLiteral() string {
@@ -36,6 +40,18 @@ func (p *Program) TokenLiteral() string {
 		return ""
 	}
 }
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+func (p *Program) End() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[len(p.Statements)-1].End()
+	}
+	return token.Position{}
+}
 func (p *Program) String() string {
 	var out bytes.Buffer
 	for _, s := range p.Statements {
@@ -47,18 +63,26 @@ func (p *Program) String() string {
 // ================== statement ======================
 // let <identifier> = <expression>;
 type LetStatement struct {
-	Token token.Token //the token.LET
-	Name  *Identifier
-	Value Expression
+	Token   token.Token //the token.LET
+	Name    *Identifier
+	Pattern Pattern // 解构时不为 nil, 此时 Name 为 nil. eg let [a, b] = arr;
+	Value   Expression
 }
 
 func (l *LetStatement) TokenLiteral() string { return l.Token.Literal }
 func (l *LetStatement) statementNode()       {}
+func (l *LetStatement) Pos() token.Position  { return l.Token.Pos }
+func (l *LetStatement) End() token.Position {
+	if l.Value != nil {
+		return l.Value.End()
+	}
+	return l.target().End()
+}
 func (l *LetStatement) String() string {
 	var out bytes.Buffer
 
 	out.WriteString(l.TokenLiteral() + " ")
-	out.WriteString(l.Name.String())
+	out.WriteString(l.target().String())
 	out.WriteString(" = ")
 	if l.Value != nil {
 		out.WriteString(l.Value.String())
@@ -68,6 +92,13 @@ func (l *LetStatement) String() string {
 	return out.String()
 }
 
+func (l *LetStatement) target() Pattern {
+	if l.Pattern != nil {
+		return l.Pattern
+	}
+	return l.Name
+}
+
 // ReturnStatement
 // return <expression>;
 type ReturnStatement struct {
@@ -77,6 +108,13 @@ type ReturnStatement struct {
 
 func (r *ReturnStatement) TokenLiteral() string { return r.Token.Literal }
 func (r *ReturnStatement) statementNode()       {}
+func (r *ReturnStatement) Pos() token.Position  { return r.Token.Pos }
+func (r *ReturnStatement) End() token.Position {
+	if r.Value != nil {
+		return r.Value.End()
+	}
+	return r.Token.End
+}
 func (r *ReturnStatement) String() string {
 	var out bytes.Buffer
 
@@ -89,6 +127,152 @@ func (r *ReturnStatement) String() string {
 	return out.String()
 }
 
+// ThrowStatement
+// throw <expression>;
+type ThrowStatement struct {
+	Token token.Token // the token.THROW
+	Value Expression
+}
+
+func (t *ThrowStatement) TokenLiteral() string { return t.Token.Literal }
+func (t *ThrowStatement) statementNode()       {}
+func (t *ThrowStatement) Pos() token.Position  { return t.Token.Pos }
+func (t *ThrowStatement) End() token.Position {
+	if t.Value != nil {
+		return t.Value.End()
+	}
+	return t.Token.End
+}
+func (t *ThrowStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(t.TokenLiteral() + " ")
+	if t.Value != nil {
+		out.WriteString(t.Value.String())
+	}
+	out.WriteString(";")
+
+	return out.String()
+}
+
+// WhileStatement
+// while (<condition>) <body>
+type WhileStatement struct {
+	Token     token.Token // the token.WHILE
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (w *WhileStatement) statementNode()       {}
+func (w *WhileStatement) TokenLiteral() string { return w.Token.Literal }
+func (w *WhileStatement) Pos() token.Position  { return w.Token.Pos }
+func (w *WhileStatement) End() token.Position {
+	if w.Body != nil {
+		return w.Body.End()
+	}
+	return w.Token.End
+}
+func (w *WhileStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("while (")
+	out.WriteString(w.Condition.String())
+	out.WriteString(") ")
+	out.WriteString(w.Body.String())
+	return out.String()
+}
+
+// ForStatement
+// for (<init>; <condition>; <post>) <body>, 三个部分都可以省略
+type ForStatement struct {
+	Token     token.Token // the token.FOR
+	Init      Statement
+	Condition Expression
+	Post      Expression
+	Body      *BlockStatement
+}
+
+func (f *ForStatement) statementNode()       {}
+func (f *ForStatement) TokenLiteral() string { return f.Token.Literal }
+func (f *ForStatement) Pos() token.Position  { return f.Token.Pos }
+func (f *ForStatement) End() token.Position {
+	if f.Body != nil {
+		return f.Body.End()
+	}
+	return f.Token.End
+}
+func (f *ForStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("for (")
+	if f.Init != nil {
+		out.WriteString(strings.TrimSuffix(f.Init.String(), ";"))
+	}
+	out.WriteString("; ")
+	if f.Condition != nil {
+		out.WriteString(f.Condition.String())
+	}
+	out.WriteString("; ")
+	if f.Post != nil {
+		out.WriteString(strings.TrimSuffix(f.Post.String(), ";"))
+	}
+	out.WriteString(") ")
+	out.WriteString(f.Body.String())
+	return out.String()
+}
+
+// for (v in iterable) 或 for (k, v in iterable)
+type ForInStatement struct {
+	Token    token.Token   // the token.FOR
+	Vars     []*Identifier // 一个或两个循环变量
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (f *ForInStatement) statementNode()       {}
+func (f *ForInStatement) TokenLiteral() string { return f.Token.Literal }
+func (f *ForInStatement) Pos() token.Position  { return f.Token.Pos }
+func (f *ForInStatement) End() token.Position {
+	if f.Body != nil {
+		return f.Body.End()
+	}
+	return f.Token.End
+}
+func (f *ForInStatement) String() string {
+	var out bytes.Buffer
+	vars := make([]string, 0, len(f.Vars))
+	for _, v := range f.Vars {
+		vars = append(vars, v.String())
+	}
+	out.WriteString("for (")
+	out.WriteString(strings.Join(vars, ", "))
+	out.WriteString(" in ")
+	out.WriteString(f.Iterable.String())
+	out.WriteString(") ")
+	out.WriteString(f.Body.String())
+	return out.String()
+}
+
+// BreakStatement
+type BreakStatement struct {
+	Token token.Token // the token.BREAK
+}
+
+func (b *BreakStatement) statementNode()       {}
+func (b *BreakStatement) TokenLiteral() string { return b.Token.Literal }
+func (b *BreakStatement) Pos() token.Position  { return b.Token.Pos }
+func (b *BreakStatement) End() token.Position  { return b.Token.End }
+func (b *BreakStatement) String() string       { return b.Token.Literal + ";" }
+
+// ContinueStatement
+type ContinueStatement struct {
+	Token token.Token // the token.CONTINUE
+}
+
+func (c *ContinueStatement) statementNode()       {}
+func (c *ContinueStatement) TokenLiteral() string { return c.Token.Literal }
+func (c *ContinueStatement) Pos() token.Position  { return c.Token.Pos }
+func (c *ContinueStatement) End() token.Position  { return c.Token.End }
+func (c *ContinueStatement) String() string       { return c.Token.Literal + ";" }
+
 // ExpressionStatement
 type ExpressionStatement struct {
 	Token      token.Token
@@ -97,6 +281,13 @@ type ExpressionStatement struct {
 
 func (es *ExpressionStatement) statementNode()       {}
 func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExpressionStatement) Pos() token.Position  { return es.Token.Pos }
+func (es *ExpressionStatement) End() token.Position {
+	if es.Expression != nil {
+		return es.Expression.End()
+	}
+	return es.Token.End
+}
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
 		return es.Expression.String()
@@ -108,10 +299,21 @@ func (es *ExpressionStatement) String() string {
 type BlockStatement struct {
 	Token      token.Token // the { token
 	Statements []Statement
+	Rbrace     token.Position // } 的位置
 }
 
 func (bs *BlockStatement) statementNode()       {}
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BlockStatement) Pos() token.Position  { return bs.Token.Pos }
+func (bs *BlockStatement) End() token.Position {
+	if bs.Rbrace.IsValid() {
+		return bs.Rbrace.Shift(1)
+	}
+	if len(bs.Statements) > 0 {
+		return bs.Statements[len(bs.Statements)-1].End()
+	}
+	return bs.Token.End
+}
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
 	for _, s := range bs.Statements {
@@ -131,6 +333,13 @@ type PrefixExpression struct {
 
 func (pe *PrefixExpression) expressionNode()      {}
 func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PrefixExpression) Pos() token.Position  { return pe.Token.Pos }
+func (pe *PrefixExpression) End() token.Position {
+	if pe.Right != nil {
+		return pe.Right.End()
+	}
+	return pe.Token.End
+}
 func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(")
@@ -151,6 +360,18 @@ type InfixExpression struct {
 
 func (ie *InfixExpression) expressionNode()      {}
 func (ie *InfixExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *InfixExpression) Pos() token.Position {
+	if ie.Left != nil {
+		return ie.Left.Pos()
+	}
+	return ie.Token.Pos
+}
+func (ie *InfixExpression) End() token.Position {
+	if ie.Right != nil {
+		return ie.Right.End()
+	}
+	return ie.Token.End
+}
 func (ie *InfixExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(")
@@ -172,6 +393,16 @@ type IfExpression struct {
 
 func (i *IfExpression) expressionNode()      {}
 func (i *IfExpression) TokenLiteral() string { return i.Token.Literal }
+func (i *IfExpression) Pos() token.Position  { return i.Token.Pos }
+func (i *IfExpression) End() token.Position {
+	if i.Alternative != nil {
+		return i.Alternative.End()
+	}
+	if i.Consequence != nil {
+		return i.Consequence.End()
+	}
+	return i.Token.End
+}
 func (i *IfExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("if")
@@ -185,42 +416,141 @@ func (i *IfExpression) String() string {
 	return out.String()
 }
 
+// TryExpression
+// try <block> catch (<param>) <catch> finally <finally>, catch 和 finally 至少有一个
+type TryExpression struct {
+	Token   token.Token // the token.TRY
+	Block   *BlockStatement
+	Param   *Identifier // catch 绑定的变量, 可以省略
+	Catch   *BlockStatement
+	Finally *BlockStatement
+}
+
+func (t *TryExpression) expressionNode()      {}
+func (t *TryExpression) TokenLiteral() string { return t.Token.Literal }
+func (t *TryExpression) Pos() token.Position  { return t.Token.Pos }
+func (t *TryExpression) End() token.Position {
+	if t.Finally != nil {
+		return t.Finally.End()
+	}
+	if t.Catch != nil {
+		return t.Catch.End()
+	}
+	if t.Block != nil {
+		return t.Block.End()
+	}
+	return t.Token.End
+}
+func (t *TryExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("try ")
+	out.WriteString(t.Block.String())
+	if t.Catch != nil {
+		out.WriteString(" catch ")
+		if t.Param != nil {
+			out.WriteString("(" + t.Param.String() + ") ")
+		}
+		out.WriteString(t.Catch.String())
+	}
+	if t.Finally != nil {
+		out.WriteString(" finally ")
+		out.WriteString(t.Finally.String())
+	}
+	return out.String()
+}
+
 // fn <parameters> <block statement>, fn(a,b){return a + b;}
 type FunctionLiteral struct {
 	Token      token.Token // token.FUNCTION
 	Parameters []*Identifier
+	Patterns   []Pattern    // 解构的参数, 与 Parameters 等长, Parameters 中对应的位置是以模式为名字的占位; 都没有时为 nil
+	Defaults   []Expression // 参数的默认值, 与 Parameters 等长, 没有默认值的位置为 nil; 都没有时为 nil
+	Rest       *Identifier  // 剩余参数 ...rest, 没有时为 nil
 	Body       *BlockStatement
 }
 
 func (fn *FunctionLiteral) expressionNode()      {}
 func (fn *FunctionLiteral) TokenLiteral() string { return fn.Token.Literal }
+func (fn *FunctionLiteral) Pos() token.Position  { return fn.Token.Pos }
+func (fn *FunctionLiteral) End() token.Position {
+	if fn.Body != nil {
+		return fn.Body.End()
+	}
+	return fn.Token.End
+}
 func (fn *FunctionLiteral) String() string {
 	var out bytes.Buffer
 
-	var params []string
-	for _, p := range fn.Parameters {
-		params = append(params, p.String())
-	}
 	out.WriteString(fn.TokenLiteral())
 	out.WriteString("(")
-	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(FormatParameters(fn.Parameters, fn.Defaults, fn.Rest))
 	out.WriteString(") ")
 	out.WriteString(fn.Body.String())
 
 	return out.String()
 }
 
+// a, b = 10, ...rest
+func FormatParameters(params []*Identifier, defaults []Expression, rest *Identifier) string {
+	var out []string
+	for i, p := range params {
+		if i < len(defaults) && defaults[i] != nil {
+			out = append(out, p.String()+" = "+defaults[i].String())
+		} else {
+			out = append(out, p.String())
+		}
+	}
+	if rest != nil {
+		out = append(out, "..."+rest.String())
+	}
+	return strings.Join(out, ", ")
+}
+
+// 展开表达式, 只能出现在调用参数和数组字面量中
+// f(...args), [1, ...xs]
+type SpreadExpression struct {
+	Token token.Token // token.ELLIPSIS
+	Value Expression
+}
+
+func (se *SpreadExpression) expressionNode()      {}
+func (se *SpreadExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SpreadExpression) Pos() token.Position  { return se.Token.Pos }
+func (se *SpreadExpression) End() token.Position {
+	if se.Value != nil {
+		return se.Value.End()
+	}
+	return se.Token.End
+}
+func (se *SpreadExpression) String() string {
+	return "..." + se.Value.String()
+}
+
 // 调用表达式
 // 可以分查两部分identifier和参数部分中间通过 ( 分割, `(` 注册成 infixFn
 // <expression>(<comma separated expressions>) , fn(x, y) { x + y; }(2, 3), add(2, 3), add(2 + 2, 3 * 3 * 3)
 type CallExpression struct {
-	Token     token.Token  // The '(' token
-	Function  Expression   // Identifier or FunctionLiteral ,eg add(1,2), add ;如果是 TS 语法就可以用用|类型表示
-	Arguments []Expression // eg add(1,2), 1,2
+	Token     token.Token      // The '(' token
+	Function  Expression       // Identifier or FunctionLiteral ,eg add(1,2), add ;如果是 TS 语法就可以用用|类型表示
+	Arguments []Expression     // eg add(1,2), 1,2
+	Named     []*NamedArgument // 命名参数, 只能在位置参数之后, eg add(1, b: 2)
+	Rparen    token.Position   // ) 的位置
 }
 
 func (ce *CallExpression) expressionNode()      {}
 func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *CallExpression) Pos() token.Position {
+	if ce.Function != nil {
+		return ce.Function.Pos()
+	}
+	return ce.Token.Pos
+}
+func (ce *CallExpression) End() token.Position {
+	if ce.Rparen.IsValid() {
+		return ce.Rparen.Shift(1)
+	}
+	return ce.Token.End
+}
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
 
@@ -228,6 +558,9 @@ func (ce *CallExpression) String() string {
 	for _, p := range ce.Arguments {
 		params = append(params, p.String())
 	}
+	for _, n := range ce.Named {
+		params = append(params, n.String())
+	}
 	out.WriteString(ce.Function.String())
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
@@ -236,6 +569,24 @@ func (ce *CallExpression) String() string {
 	return out.String()
 }
 
+// 命名参数 name: value
+type NamedArgument struct {
+	Name  *Identifier
+	Value Expression
+}
+
+func (na *NamedArgument) TokenLiteral() string { return na.Name.TokenLiteral() }
+func (na *NamedArgument) Pos() token.Position  { return na.Name.Pos() }
+func (na *NamedArgument) End() token.Position {
+	if na.Value != nil {
+		return na.Value.End()
+	}
+	return na.Name.End()
+}
+func (na *NamedArgument) String() string {
+	return na.Name.String() + ": " + na.Value.String()
+}
+
 // BlockExpression 语句块表达式, 单纯的{}语句表达式
 type BlockExpression struct {
 	Token token.Token // the { token
@@ -244,6 +595,13 @@ type BlockExpression struct {
 
 func (be *BlockExpression) expressionNode()      {}
 func (be *BlockExpression) TokenLiteral() string { return be.Token.Literal }
+func (be *BlockExpression) Pos() token.Position  { return be.Token.Pos }
+func (be *BlockExpression) End() token.Position {
+	if be.Body != nil {
+		return be.Body.End()
+	}
+	return be.Token.End
+}
 func (be *BlockExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("{")
@@ -260,6 +618,13 @@ type AssignExpression struct {
 
 func (ae *AssignExpression) expressionNode()      {}
 func (ae *AssignExpression) TokenLiteral() string { return ae.Name.Token.Literal }
+func (ae *AssignExpression) Pos() token.Position  { return ae.Name.Pos() }
+func (ae *AssignExpression) End() token.Position {
+	if ae.Value != nil {
+		return ae.Value.End()
+	}
+	return ae.Name.End()
+}
 func (ae *AssignExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString(ae.Name.String())
@@ -274,10 +639,18 @@ func (ae *AssignExpression) String() string {
 type ArrayLiteral struct {
 	Token    token.Token // the '[' token
 	Elements []Expression
+	Rbracket token.Position // ] 的位置
 }
 
 func (al *ArrayLiteral) expressionNode()      {}
 func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) Pos() token.Position  { return al.Token.Pos }
+func (al *ArrayLiteral) End() token.Position {
+	if al.Rbracket.IsValid() {
+		return al.Rbracket.Shift(1)
+	}
+	return al.Token.End
+}
 func (al *ArrayLiteral) String() string {
 	var out bytes.Buffer
 	var elements []string
@@ -293,13 +666,26 @@ func (al *ArrayLiteral) String() string {
 
 // 下标表达式 indexExpression <expression>[<expression>]
 type IndexExpression struct {
-	Token token.Token //  the '[' token
-	Left  Expression  // Identifier , AssignExpression or functionCall, eg: arr[1], [1, 2, 3][0]
-	Index Expression
+	Token    token.Token //  the '[' token
+	Left     Expression  // Identifier , AssignExpression or functionCall, eg: arr[1], [1, 2, 3][0]
+	Index    Expression
+	Rbracket token.Position // ] 的位置
 }
 
 func (ie *IndexExpression) expressionNode()      {}
 func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) Pos() token.Position {
+	if ie.Left != nil {
+		return ie.Left.Pos()
+	}
+	return ie.Token.Pos
+}
+func (ie *IndexExpression) End() token.Position {
+	if ie.Rbracket.IsValid() {
+		return ie.Rbracket.Shift(1)
+	}
+	return ie.Token.End
+}
 func (ie *IndexExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(")
@@ -313,12 +699,20 @@ func (ie *IndexExpression) String() string {
 
 // hashtable
 type HashLiteral struct {
-	Token token.Token               // the token.HASH
-	Pairs map[Expression]Expression // 因为 Expression 实现中都是指针类型,所以内部有slice也可以
+	Token  token.Token               // the token.HASH
+	Pairs  map[Expression]Expression // 因为 Expression 实现中都是指针类型,所以内部有slice也可以
+	Rbrace token.Position            // } 的位置
 }
 
 func (hl *HashLiteral) expressionNode()      {}
 func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+func (hl *HashLiteral) Pos() token.Position  { return hl.Token.Pos }
+func (hl *HashLiteral) End() token.Position {
+	if hl.Rbrace.IsValid() {
+		return hl.Rbrace.Shift(1)
+	}
+	return hl.Token.End
+}
 func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 	var pairs []string
@@ -332,6 +726,65 @@ func (hl *HashLiteral) String() string {
 	return out.String()
 }
 
+// 解构模式, 用在 let 和函数参数中, 可以嵌套
+// a, [a, b, ...rest], hash{"name": n, "tags": [first, ...others]}
+type Pattern interface {
+	Node
+	patternNode()
+}
+
+type ArrayPattern struct {
+	Token    token.Token // the token.LBRACKET
+	Elements []Pattern
+	Rest     *Identifier // ...rest, 没有时为 nil
+	Rbracket token.Position
+}
+
+func (ap *ArrayPattern) patternNode()         {}
+func (ap *ArrayPattern) TokenLiteral() string { return ap.Token.Literal }
+func (ap *ArrayPattern) Pos() token.Position  { return ap.Token.Pos }
+func (ap *ArrayPattern) End() token.Position {
+	if ap.Rbracket.IsValid() {
+		return ap.Rbracket.Shift(1)
+	}
+	return ap.Token.End
+}
+func (ap *ArrayPattern) String() string {
+	var elements []string
+	for _, el := range ap.Elements {
+		elements = append(elements, el.String())
+	}
+	if ap.Rest != nil {
+		elements = append(elements, "..."+ap.Rest.String())
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// 按 key 取值, key 在绑定时求值. 与 HashLiteral 不同, 这里保持源码中的顺序
+type HashPattern struct {
+	Token  token.Token // the token.HASH
+	Keys   []Expression
+	Values []Pattern
+	Rbrace token.Position
+}
+
+func (hp *HashPattern) patternNode()         {}
+func (hp *HashPattern) TokenLiteral() string { return hp.Token.Literal }
+func (hp *HashPattern) Pos() token.Position  { return hp.Token.Pos }
+func (hp *HashPattern) End() token.Position {
+	if hp.Rbrace.IsValid() {
+		return hp.Rbrace.Shift(1)
+	}
+	return hp.Token.End
+}
+func (hp *HashPattern) String() string {
+	var pairs []string
+	for i, key := range hp.Keys {
+		pairs = append(pairs, key.String()+": "+hp.Values[i].String())
+	}
+	return hp.Token.Literal + "{" + strings.Join(pairs, ", ") + "}"
+}
+
 // ==================== 叶子节点 ==================
 // IdentifierExpression
 type Identifier struct {
@@ -340,19 +793,37 @@ type Identifier struct {
 }
 
 func (i *Identifier) expressionNode()      {}
+func (i *Identifier) patternNode()         {}
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
+func (i *Identifier) Pos() token.Position  { return i.Token.Pos }
+func (i *Identifier) End() token.Position  { return i.Token.End }
 func (i *Identifier) String() string       { return i.Value }
 
 // IntegerExpression
 type IntegerLiteral struct {
 	Token token.Token //the token.INT
 	Value int64
+	Big   *big.Int // 超出 int64 范围时不为 nil, 此时忽略 Value
 }
 
 func (i *IntegerLiteral) expressionNode()      {}
 func (i *IntegerLiteral) TokenLiteral() string { return i.Token.Literal }
+func (i *IntegerLiteral) Pos() token.Position  { return i.Token.Pos }
+func (i *IntegerLiteral) End() token.Position  { return i.Token.End }
 func (i *IntegerLiteral) String() string       { return i.Token.Literal }
 
+// FloatExpression, eg: 3.14, 1e-9
+type FloatLiteral struct {
+	Token token.Token // the token.FLOAT
+	Value float64
+}
+
+func (f *FloatLiteral) expressionNode()      {}
+func (f *FloatLiteral) TokenLiteral() string { return f.Token.Literal }
+func (f *FloatLiteral) Pos() token.Position  { return f.Token.Pos }
+func (f *FloatLiteral) End() token.Position  { return f.Token.End }
+func (f *FloatLiteral) String() string       { return f.Token.Literal }
+
 // BooleanExpression
 type Boolean struct {
 	Token token.Token //the token.TRUE, token.FALSE
@@ -361,6 +832,8 @@ type Boolean struct {
 
 func (i *Boolean) expressionNode()      {}
 func (i *Boolean) TokenLiteral() string { return i.Token.Literal }
+func (i *Boolean) Pos() token.Position  { return i.Token.Pos }
+func (i *Boolean) End() token.Position  { return i.Token.End }
 func (i *Boolean) String() string       { return i.Token.Literal }
 
 // string
@@ -371,4 +844,36 @@ type StringLiteral struct {
 
 func (s *StringLiteral) expressionNode()      {}
 func (s *StringLiteral) TokenLiteral() string { return s.Token.Literal }
+func (s *StringLiteral) Pos() token.Position  { return s.Token.Pos }
+func (s *StringLiteral) End() token.Position  { return s.Token.End }
 func (s *StringLiteral) String() string       { return s.Token.Literal }
+
+// 带插值的字符串 "Hello ${name}"
+type InterpolatedString struct {
+	Token token.Token    // token.INTERP_HEAD
+	Parts []Expression   // 字符串片段(*StringLiteral) 和 ${} 中的表达式, 按源码中的顺序, 不包含空的片段
+	Quote token.Position // 结束的 " 的位置
+}
+
+func (is *InterpolatedString) expressionNode()      {}
+func (is *InterpolatedString) TokenLiteral() string { return is.Token.Literal }
+func (is *InterpolatedString) Pos() token.Position  { return is.Token.Pos }
+func (is *InterpolatedString) End() token.Position {
+	if is.Quote.IsValid() {
+		return is.Quote.Shift(1)
+	}
+	return is.Token.End
+}
+func (is *InterpolatedString) String() string {
+	var out bytes.Buffer
+	for _, part := range is.Parts {
+		if str, ok := part.(*StringLiteral); ok {
+			out.WriteString(str.Value)
+			continue
+		}
+		out.WriteString("${")
+		out.WriteString(part.String())
+		out.WriteString("}")
+	}
+	return out.String()
+}
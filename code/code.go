@@ -0,0 +1,251 @@
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+/*
+字节码指令集
+每条指令由 1 byte 的 Opcode 加上若干个操作数组成, 操作数使用大端序
+*/
+
+type Instructions []byte
+
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			_, _ = fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+		operands, read := ReadOperands(def, ins[i+1:])
+		_, _ = fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+		i += 1 + read
+	}
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	operandCount := len(def.OperandWidths)
+	if len(operands) != operandCount {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n",
+			len(operands), operandCount)
+	}
+	switch operandCount {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+}
+
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota // 从常量池中取值压栈
+	OpPop                    // 弹出栈顶, 每条表达式语句结束时使用
+
+	// 中缀运算
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpEqual
+	OpNotEqual
+	OpGreaterThan
+	OpGreaterEqual
+	OpLessThan
+	OpLessEqual
+	OpMod
+	OpBitAnd
+	OpBitOr
+	OpBitXor
+	OpShiftLeft
+	OpShiftRight
+	OpPow
+
+	// 前缀运算
+	OpMinus
+	OpPlus
+	OpBang
+
+	OpTrue
+	OpFalse
+	OpNull
+
+	OpJump          // 无条件跳转
+	OpJumpNotTruthy // 栈顶不为真时跳转
+	OpGetGlobal     // 全局变量
+	OpSetGlobal     //
+	OpGetLocal      // 当前函数的局部变量
+	OpSetLocal      //
+	OpGetFree       // 外层函数的局部变量, 操作数: 层级, 下标
+	OpSetFree       //
+	OpGetBuiltin    // 内建函数
+	OpArray         // 操作数为元素个数
+	OpHash          // 操作数为 key + value 的个数
+	OpConcat        // 操作数为拼接的个数, 用于字符串插值
+	OpIndex         // 下标
+	OpCall          // 操作数为参数个数
+	OpReturnValue   // 函数返回, 返回值在栈顶
+	OpClosure       // 操作数为常量池中 CompiledFunction 的下标
+	OpThrow         // 抛出栈顶的值
+
+	// 循环和 try 在帧中记录一个块, break, continue, return 和错误向外传递时据此恢复栈并执行 finally
+	OpSetupLoop  // 进入循环, 操作数: break 和 continue 跳转的位置
+	OpPopBlock   // 正常离开循环
+	OpBreak      // 跳出最内层的循环
+	OpContinue   // 进入最内层循环的下一次迭代
+	OpSetupTry   // 进入 try, 操作数: catch 和 finally 的位置, 没有 catch 时为 0
+	OpEndTry     // try 或 catch 正常结束, 栈顶是 try 表达式的值, 跳转到 finally
+	OpEndFinally // finally 结束, 继续被 finally 打断的 return, break, continue 或错误
+	OpIter       // 把栈顶的 Iterable 换成迭代器
+	OpIterNext   // 操作数: 迭代结束时跳转的位置, 循环变量的个数. 没有结束时压入循环变量的值
+
+	// 和 evaluator 一样循环的每次迭代都是新的绑定, 闭包捕获的是当次迭代的变量
+	OpPushScope // 一次迭代开始, 为循环体中的变量分配新的槽位, 操作数为槽位数
+	OpPopScope  // 一次迭代结束
+	OpGetLoop   // 当前函数中循环体的变量, 操作数: 层级(0 为最内层的循环), 下标
+	OpSetLoop   //
+)
+
+// 指令的定义
+type Definition struct {
+	Name          string
+	OperandWidths []int // 每个操作数占用的字节数
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+	OpPop:      {"OpPop", []int{}},
+
+	OpAdd:          {"OpAdd", []int{}},
+	OpSub:          {"OpSub", []int{}},
+	OpMul:          {"OpMul", []int{}},
+	OpDiv:          {"OpDiv", []int{}},
+	OpEqual:        {"OpEqual", []int{}},
+	OpNotEqual:     {"OpNotEqual", []int{}},
+	OpGreaterThan:  {"OpGreaterThan", []int{}},
+	OpGreaterEqual: {"OpGreaterEqual", []int{}},
+	OpLessThan:     {"OpLessThan", []int{}},
+	OpLessEqual:    {"OpLessEqual", []int{}},
+	OpMod:          {"OpMod", []int{}},
+	OpBitAnd:       {"OpBitAnd", []int{}},
+	OpBitOr:        {"OpBitOr", []int{}},
+	OpBitXor:       {"OpBitXor", []int{}},
+	OpShiftLeft:    {"OpShiftLeft", []int{}},
+	OpShiftRight:   {"OpShiftRight", []int{}},
+	OpPow:          {"OpPow", []int{}},
+
+	OpMinus: {"OpMinus", []int{}},
+	OpPlus:  {"OpPlus", []int{}},
+	OpBang:  {"OpBang", []int{}},
+
+	OpTrue:  {"OpTrue", []int{}},
+	OpFalse: {"OpFalse", []int{}},
+	OpNull:  {"OpNull", []int{}},
+
+	OpJump:          {"OpJump", []int{2}},
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+	OpGetGlobal:     {"OpGetGlobal", []int{2}},
+	OpSetGlobal:     {"OpSetGlobal", []int{2}},
+	OpGetLocal:      {"OpGetLocal", []int{1}},
+	OpSetLocal:      {"OpSetLocal", []int{1}},
+	OpGetFree:       {"OpGetFree", []int{1, 1}},
+	OpSetFree:       {"OpSetFree", []int{1, 1}},
+	OpGetBuiltin:    {"OpGetBuiltin", []int{1}},
+	OpArray:         {"OpArray", []int{2}},
+	OpHash:          {"OpHash", []int{2}},
+	OpConcat:        {"OpConcat", []int{2}},
+	OpIndex:         {"OpIndex", []int{}},
+	OpCall:          {"OpCall", []int{1}},
+	OpReturnValue:   {"OpReturnValue", []int{}},
+	OpClosure:       {"OpClosure", []int{2}},
+	OpThrow:         {"OpThrow", []int{}},
+
+	OpSetupLoop:  {"OpSetupLoop", []int{2, 2}},
+	OpPopBlock:   {"OpPopBlock", []int{}},
+	OpBreak:      {"OpBreak", []int{}},
+	OpContinue:   {"OpContinue", []int{}},
+	OpSetupTry:   {"OpSetupTry", []int{2, 2}},
+	OpEndTry:     {"OpEndTry", []int{}},
+	OpEndFinally: {"OpEndFinally", []int{}},
+	OpIter:       {"OpIter", []int{}},
+	OpIterNext:   {"OpIterNext", []int{2, 1}},
+
+	OpPushScope: {"OpPushScope", []int{2}},
+	OpPopScope:  {"OpPopScope", []int{}},
+	OpGetLoop:   {"OpGetLoop", []int{1, 1}},
+	OpSetLoop:   {"OpSetLoop", []int{1, 1}},
+}
+
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+	return def, nil
+}
+
+// 生成一条指令
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLen := 1
+	for _, w := range def.OperandWidths {
+		instructionLen += w
+	}
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+	return instruction
+}
+
+// 解码操作数, 返回操作数和读取的字节数
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+		offset += width
+	}
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 {
+	return ins[0]
+}
@@ -0,0 +1,708 @@
+package compiler
+
+import (
+	"errors"
+	"fmt"
+	"github.com/qiuhoude/go-interpreter/ast"
+	"github.com/qiuhoude/go-interpreter/code"
+	"github.com/qiuhoude/go-interpreter/evaluator"
+	"github.com/qiuhoude/go-interpreter/object"
+	"sort"
+)
+
+/*
+编译器, 将 AST 编译成字节码(指令 + 常量池)交给 vm 执行
+相比 evaluator 每次都要遍历 AST 并按名字查找 environment,
+字节码只需要顺序执行指令, 变量也已经在编译期解析成了下标
+*/
+
+const (
+	maxLocals = 1 << 8  // OpGetLocal 操作数为 1 byte
+	maxGlobal = 1 << 16 // OpGetGlobal 操作数为 2 byte
+	maxArgs   = 1 << 8  // OpCall 操作数为 1 byte
+)
+
+// vm 不支持的语法, 返回的错误可以用 errors.Is 判断. 这些脚本只能用 evaluator 执行
+var ErrUnsupported = errors.New("not supported by the vm")
+
+// 中缀运算符和指令的对应关系
+var infixOps = map[string]code.Opcode{
+	"+":  code.OpAdd,
+	"-":  code.OpSub,
+	"*":  code.OpMul,
+	"/":  code.OpDiv,
+	"==": code.OpEqual,
+	"!=": code.OpNotEqual,
+	">":  code.OpGreaterThan,
+	">=": code.OpGreaterEqual,
+	"<":  code.OpLessThan,
+	"<=": code.OpLessEqual,
+	"%":  code.OpMod,
+	"&":  code.OpBitAnd,
+	"|":  code.OpBitOr,
+	"^":  code.OpBitXor,
+	"<<": code.OpShiftLeft,
+	">>": code.OpShiftRight,
+	"**": code.OpPow,
+}
+
+var prefixOps = map[string]code.Opcode{
+	"-": code.OpMinus,
+	"+": code.OpPlus,
+	"!": code.OpBang,
+}
+
+type Bytecode struct {
+	Instructions code.Instructions
+	Constants    []object.Object
+	GlobalNames  []string // 全局变量下标 -> 名字, 用于运行时报错
+}
+
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+// 每个函数体都有自己的指令集
+type CompilationScope struct {
+	instructions        code.Instructions
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+}
+
+type Compiler struct {
+	constants   []object.Object
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	err error // 操作数超出范围, 编译结束时返回
+}
+
+func New() *Compiler {
+	return &Compiler{
+		constants:   []object.Object{},
+		symbolTable: NewSymbolTable(),
+		scopes:      []CompilationScope{{}},
+	}
+}
+
+// 使用已有的符号表和常量池, 用于 repl 多次编译共享全局变量
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+	c := New()
+	c.symbolTable = s
+	c.constants = constants
+	return c
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	global := c.symbolTable
+	for global.Outer != nil {
+		global = global.Outer
+	}
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Constants:    c.constants,
+		GlobalNames:  global.Names(),
+	}
+}
+
+func (c *Compiler) Compile(node ast.Node) error {
+	if err := c.compile(node); err != nil {
+		return err
+	}
+	return c.err
+}
+
+func (c *Compiler) compile(node ast.Node) error {
+	switch node := node.(type) {
+	// statements
+	case *ast.Program:
+		for _, s := range node.Statements {
+			if err := c.compile(s); err != nil {
+				return err
+			}
+		}
+	case *ast.ExpressionStatement:
+		if node.Expression == nil {
+			return nil
+		}
+		if err := c.compile(node.Expression); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+	case *ast.BlockStatement:
+		return c.compileBlock(node)
+	case *ast.ReturnStatement:
+		if err := c.compile(node.Value); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+	case *ast.LetStatement:
+		return c.compileLetStatement(node)
+	case *ast.ThrowStatement:
+		if err := c.compile(node.Value); err != nil {
+			return err
+		}
+		c.emit(code.OpThrow)
+	case *ast.WhileStatement:
+		return c.compileWhileStatement(node)
+	case *ast.ForStatement:
+		return c.compileForStatement(node)
+	case *ast.ForInStatement:
+		return c.compileForInStatement(node)
+	case *ast.BreakStatement:
+		c.emit(code.OpBreak)
+	case *ast.ContinueStatement:
+		c.emit(code.OpContinue)
+
+	// expressions
+	case *ast.AssignExpression:
+		if err := c.compile(node.Value); err != nil {
+			return err
+		}
+		sym, ok := c.symbolTable.Resolve(node.Name.Value)
+		if !ok {
+			// 与 evaluator 一致, 给未定义的变量赋值时定义在全局
+			sym = c.symbolTable.DefineGlobal(node.Name.Value)
+		}
+		if err := c.storeSymbol(sym); err != nil {
+			return err
+		}
+		return c.loadSymbol(sym)
+	case *ast.IntegerLiteral:
+		if node.Big != nil {
+			c.emit(code.OpConstant, c.addConstant(&object.BigInt{Value: node.Big}))
+		} else {
+			c.emit(code.OpConstant, c.addConstant(object.NewInteger(node.Value)))
+		}
+	case *ast.FloatLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.Float{Value: node.Value}))
+	case *ast.StringLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: node.Value}))
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+	case *ast.PrefixExpression:
+		op, ok := prefixOps[node.Operator]
+		if !ok {
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+		if err := c.compile(node.Right); err != nil {
+			return err
+		}
+		c.emit(op)
+	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return c.compileLogicalExpression(node)
+		}
+		op, ok := infixOps[node.Operator]
+		if !ok {
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+		if err := c.compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.compile(node.Right); err != nil {
+			return err
+		}
+		c.emit(op)
+	case *ast.IfExpression:
+		return c.compileIfExpression(node)
+	case *ast.TryExpression:
+		return c.compileTryExpression(node)
+	case *ast.Identifier:
+		return c.compileIdentifier(node)
+	case *ast.BlockExpression:
+		return c.compileBlock(node.Body)
+	case *ast.FunctionLiteral:
+		return c.compileFunctionLiteral(node, "")
+	case *ast.CallExpression:
+		if len(node.Named) > 0 { // vm 只支持按位置传参
+			return fmt.Errorf("%w: named arguments", ErrUnsupported)
+		}
+		if len(node.Arguments) >= maxArgs {
+			return fmt.Errorf("too many arguments in call: %d", len(node.Arguments))
+		}
+		if err := c.compile(node.Function); err != nil {
+			return err
+		}
+		for _, a := range node.Arguments {
+			if err := c.compile(a); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpCall, len(node.Arguments))
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			if err := c.compile(el); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpArray, len(node.Elements))
+	case *ast.InterpolatedString:
+		for _, part := range node.Parts {
+			if err := c.compile(part); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpConcat, len(node.Parts))
+	case *ast.IndexExpression:
+		if err := c.compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.compile(node.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+	case *ast.HashLiteral:
+		// ast 中是 map, 排序保证每次编译出的指令一致
+		var keys []ast.Expression
+		for k := range node.Pairs {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].String() < keys[j].String()
+		})
+		for _, k := range keys {
+			if err := c.compile(k); err != nil {
+				return err
+			}
+			if err := c.compile(node.Pairs[k]); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpHash, len(node.Pairs)*2)
+	case *ast.SpreadExpression: // OpCall 和 OpArray 的操作数是编译期确定的个数
+		return fmt.Errorf("%w: spread arguments", ErrUnsupported)
+	default:
+		return fmt.Errorf("unsupported node %T", node)
+	}
+	return nil
+}
+
+func (c *Compiler) compileLetStatement(node *ast.LetStatement) error {
+	if node.Pattern != nil {
+		return fmt.Errorf("%w: destructuring in let statement", ErrUnsupported)
+	}
+	var sym Symbol
+	if fn, ok := node.Value.(*ast.FunctionLiteral); ok {
+		// 先定义再编译, 函数体内才能递归引用自己
+		sym = c.symbolTable.Define(node.Name.Value)
+		if err := c.compileFunctionLiteral(fn, node.Name.Value); err != nil {
+			return err
+		}
+	} else {
+		// 先编译再定义, `let a = a + 1` 中右边的 a 是外层的 a
+		if err := c.compile(node.Value); err != nil {
+			return err
+		}
+		sym = c.symbolTable.Define(node.Name.Value)
+	}
+	return c.storeSymbol(sym)
+}
+
+func (c *Compiler) compileIdentifier(node *ast.Identifier) error {
+	sym, ok := c.symbolTable.Resolve(node.Value)
+	if ok {
+		return c.loadSymbol(sym)
+	}
+	for i, name := range evaluator.BuiltinNames {
+		if name == node.Value {
+			c.emit(code.OpGetBuiltin, i)
+			return nil
+		}
+	}
+	// 可能在运行时才通过赋值定义, 先占一个全局槽位, 运行时没有值再报错
+	return c.loadSymbol(c.symbolTable.DefineGlobal(node.Value))
+}
+
+// 短路求值, 和 evaluator 一样结果是 boolean
+//
+//	a && b: a; JumpNotTruthy F; b; JumpNotTruthy F; True; Jump END; F: False; END:
+//	a || b: a; JumpNotTruthy R; True; Jump END; R: b; JumpNotTruthy F; True; Jump END; F: False; END:
+func (c *Compiler) compileLogicalExpression(node *ast.InfixExpression) error {
+	if err := c.compile(node.Left); err != nil {
+		return err
+	}
+	var falsePos, endPos []int // 需要回填的跳转
+	leftPos := c.emit(code.OpJumpNotTruthy, 9999)
+	if node.Operator == "&&" {
+		falsePos = append(falsePos, leftPos)
+	} else {
+		c.emit(code.OpTrue)
+		endPos = append(endPos, c.emit(code.OpJump, 9999))
+		c.changeOperand(leftPos, len(c.currentInstructions()))
+	}
+
+	if err := c.compile(node.Right); err != nil {
+		return err
+	}
+	falsePos = append(falsePos, c.emit(code.OpJumpNotTruthy, 9999))
+	c.emit(code.OpTrue)
+	endPos = append(endPos, c.emit(code.OpJump, 9999))
+
+	for _, pos := range falsePos {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+	c.emit(code.OpFalse)
+	for _, pos := range endPos {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+	return nil
+}
+
+func (c *Compiler) compileIfExpression(node *ast.IfExpression) error {
+	if err := c.compile(node.Condition); err != nil {
+		return err
+	}
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999) // 先占位, 后面回填
+
+	if err := c.compileBlock(node.Consequence); err != nil {
+		return err
+	}
+	jumpPos := c.emit(code.OpJump, 9999)
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+	if node.Alternative == nil {
+		c.emit(code.OpNull)
+	} else if err := c.compileBlock(node.Alternative); err != nil {
+		return err
+	}
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+// 循环语句的值是 null. 循环开始时记录一个块, break 和 continue 跳转到块中记录的位置
+//
+//	SetupLoop END COND; COND: cond; JumpNotTruthy END; body; Pop; Jump COND; END: PopBlock; Null; Pop
+func (c *Compiler) compileWhileStatement(node *ast.WhileStatement) error {
+	setupPos := c.emit(code.OpSetupLoop, 9999, 9999)
+	condPos := len(c.currentInstructions())
+	if err := c.compile(node.Condition); err != nil {
+		return err
+	}
+	exitPos := c.emit(code.OpJumpNotTruthy, 9999)
+	if err := c.compileLoopBody(node.Body, nil); err != nil {
+		return err
+	}
+	c.emit(code.OpJump, condPos)
+
+	endPos := c.endLoop()
+	c.changeOperand(exitPos, endPos)
+	c.changeOperand(setupPos, endPos, condPos)
+	return nil
+}
+
+// continue 跳转到 post 之前
+//
+//	init; SetupLoop END POST; COND: cond; JumpNotTruthy END; body; Pop; POST: post; Pop; Jump COND; END: ...
+func (c *Compiler) compileForStatement(node *ast.ForStatement) error {
+	// init 中定义的变量只在循环中可见, 和 evaluator 一样所有迭代共用一个绑定
+	c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+	defer func() { c.symbolTable = c.symbolTable.Outer }()
+
+	if node.Init != nil {
+		if err := c.compile(node.Init); err != nil {
+			return err
+		}
+	}
+	setupPos := c.emit(code.OpSetupLoop, 9999, 9999)
+	condPos := len(c.currentInstructions())
+	exitPos := -1
+	if node.Condition != nil {
+		if err := c.compile(node.Condition); err != nil {
+			return err
+		}
+		exitPos = c.emit(code.OpJumpNotTruthy, 9999)
+	}
+	if err := c.compileLoopBody(node.Body, nil); err != nil {
+		return err
+	}
+	postPos := len(c.currentInstructions())
+	if node.Post != nil {
+		if err := c.compile(node.Post); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+	}
+	c.emit(code.OpJump, condPos)
+
+	endPos := c.endLoop()
+	if exitPos >= 0 {
+		c.changeOperand(exitPos, endPos)
+	}
+	c.changeOperand(setupPos, endPos, postPos)
+	return nil
+}
+
+// 迭代器在循环期间留在栈上, 结束后弹出
+//
+//	iterable; Iter; SetupLoop END NEXT; NEXT: IterNext END n; body(绑定变量); Jump NEXT; END: PopBlock; Pop; ...
+func (c *Compiler) compileForInStatement(node *ast.ForInStatement) error {
+	if err := c.compile(node.Iterable); err != nil {
+		return err
+	}
+	c.emit(code.OpIter)
+	setupPos := c.emit(code.OpSetupLoop, 9999, 9999)
+	nextPos := c.emit(code.OpIterNext, 9999, len(node.Vars))
+	if err := c.compileLoopBody(node.Body, node.Vars); err != nil {
+		return err
+	}
+	c.emit(code.OpJump, nextPos)
+
+	endPos := len(c.currentInstructions())
+	c.emit(code.OpPopBlock)
+	c.emit(code.OpPop) // 迭代器
+	c.emit(code.OpNull)
+	c.emit(code.OpPop)
+	c.changeOperand(nextPos, endPos, len(node.Vars))
+	c.changeOperand(setupPos, endPos, nextPos)
+	return nil
+}
+
+// 循环体每次迭代都有新的槽位, vars 是迭代开始时栈上的循环变量
+//
+//	PushScope n; 绑定 vars; body; Pop; PopScope
+func (c *Compiler) compileLoopBody(body *ast.BlockStatement, vars []*ast.Identifier) error {
+	c.symbolTable = NewLoopSymbolTable(c.symbolTable)
+	defer func() { c.symbolTable = c.symbolTable.Outer }()
+
+	pushPos := c.emit(code.OpPushScope, 9999)
+	syms := make([]Symbol, len(vars))
+	for i, v := range vars {
+		syms[i] = c.symbolTable.Define(v.Value)
+	}
+	for i := len(syms) - 1; i >= 0; i-- { // 后压入的先绑定
+		if err := c.storeSymbol(syms[i]); err != nil {
+			return err
+		}
+	}
+	if err := c.compileBlock(body); err != nil {
+		return err
+	}
+	c.emit(code.OpPop)
+	c.emit(code.OpPopScope)
+
+	numVars := c.symbolTable.NumDefinitions()
+	if numVars > maxLocals {
+		return fmt.Errorf("too many variables in loop body: %d", numVars)
+	}
+	c.changeOperand(pushPos, numVars)
+	return nil
+}
+
+// 循环结束, 返回 break 跳转的位置
+func (c *Compiler) endLoop() int {
+	endPos := c.emit(code.OpPopBlock)
+	c.emit(code.OpNull)
+	c.emit(code.OpPop)
+	return endPos
+}
+
+// try, catch 正常结束或者出错时都会经过 finally, 没有 finally 时 finally 部分只有 EndFinally.
+// finally 的值被丢弃, EndFinally 之后栈顶是 try 或 catch 的值
+//
+//	SetupTry CATCH FINALLY; try; EndTry; CATCH: 绑定错误; catch; EndTry; FINALLY: finally; Pop; EndFinally
+func (c *Compiler) compileTryExpression(node *ast.TryExpression) error {
+	setupPos := c.emit(code.OpSetupTry, 0, 9999)
+	if err := c.compileBlock(node.Block); err != nil {
+		return err
+	}
+	c.emit(code.OpEndTry)
+
+	catchPos := 0
+	if node.Catch != nil {
+		catchPos = len(c.currentInstructions())
+		if err := c.compileCatch(node); err != nil {
+			return err
+		}
+		c.emit(code.OpEndTry)
+	}
+
+	finallyPos := len(c.currentInstructions())
+	if node.Finally != nil {
+		if err := c.compileBlock(node.Finally); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+	}
+	c.emit(code.OpEndFinally)
+	c.changeOperand(setupPos, catchPos, finallyPos)
+	return nil
+}
+
+// 进入 catch 时栈顶是错误转换成的 hash
+func (c *Compiler) compileCatch(node *ast.TryExpression) error {
+	c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+	defer func() { c.symbolTable = c.symbolTable.Outer }()
+
+	if node.Param != nil {
+		if err := c.storeSymbol(c.symbolTable.Define(node.Param.Value)); err != nil {
+			return err
+		}
+	} else {
+		c.emit(code.OpPop)
+	}
+	return c.compileBlock(node.Catch)
+}
+
+func (c *Compiler) compileFunctionLiteral(node *ast.FunctionLiteral, name string) error {
+	if node.Defaults != nil || node.Rest != nil { // 参数绑定在 vm 中是按位置的
+		return fmt.Errorf("%w: default or rest parameters", ErrUnsupported)
+	}
+	if node.Patterns != nil {
+		return fmt.Errorf("%w: destructuring parameters", ErrUnsupported)
+	}
+	c.enterScope()
+
+	for _, p := range node.Parameters {
+		c.symbolTable.Define(p.Value)
+	}
+	if err := c.compileBlock(node.Body); err != nil {
+		return err
+	}
+	c.emit(code.OpReturnValue) // 块的值就是函数的返回值
+
+	numLocals := c.symbolTable.NumDefinitions()
+	instructions := c.leaveScope()
+	if numLocals > maxLocals {
+		return fmt.Errorf("too many local variables in function: %d", numLocals)
+	}
+
+	compiledFn := &object.CompiledFunction{
+		Instructions:  instructions,
+		NumLocals:     numLocals,
+		NumParameters: len(node.Parameters),
+		Name:          name,
+	}
+	c.emit(code.OpClosure, c.addConstant(compiledFn))
+	return nil
+}
+
+// 编译块语句, 块执行完后栈顶留下最后一条表达式语句的值, 没有则为 null
+func (c *Compiler) compileBlock(block *ast.BlockStatement) error {
+	c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+	defer func() { c.symbolTable = c.symbolTable.Outer }()
+
+	start := len(c.currentInstructions())
+	for _, s := range block.Statements {
+		if err := c.compile(s); err != nil {
+			return err
+		}
+	}
+	last := c.scopes[c.scopeIndex].lastInstruction
+	if len(c.currentInstructions()) > start && last.Opcode == code.OpPop {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+	return nil
+}
+
+func (c *Compiler) loadSymbol(s Symbol) error {
+	switch s.Scope {
+	case GlobalScope:
+		if s.Index >= maxGlobal {
+			return fmt.Errorf("too many global variables")
+		}
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Depth, s.Index)
+	case LoopScope:
+		c.emit(code.OpGetLoop, s.Depth, s.Index)
+	}
+	return nil
+}
+
+func (c *Compiler) storeSymbol(s Symbol) error {
+	switch s.Scope {
+	case GlobalScope:
+		if s.Index >= maxGlobal {
+			return fmt.Errorf("too many global variables")
+		}
+		c.emit(code.OpSetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpSetLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpSetFree, s.Depth, s.Index)
+	case LoopScope:
+		c.emit(code.OpSetLoop, s.Depth, s.Index)
+	}
+	return nil
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	c.checkOperands(op, operands)
+	ins := code.Make(op, operands...)
+	pos := c.addInstruction(ins)
+
+	scope := &c.scopes[c.scopeIndex]
+	scope.previousInstruction = scope.lastInstruction
+	scope.lastInstruction = EmittedInstruction{Opcode: op, Position: pos}
+	return pos
+}
+
+// code.Make 会截断超出宽度的操作数, 例如常量池下标, 跳转位置和数组元素个数超过 65535,
+// 生成的字节码就是错的. 记录第一个错误, 编译结束时返回
+func (c *Compiler) checkOperands(op code.Opcode, operands []int) {
+	def, err := code.Lookup(byte(op))
+	if err != nil || c.err != nil {
+		return
+	}
+	for i, width := range def.OperandWidths {
+		if max := 1<<(8*width) - 1; operands[i] < 0 || operands[i] > max {
+			c.err = fmt.Errorf("operand of %s out of range: %d, max %d", def.Name, operands[i], max)
+			return
+		}
+	}
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	posNewInstruction := len(c.currentInstructions())
+	c.scopes[c.scopeIndex].instructions = append(c.currentInstructions(), ins...)
+	return posNewInstruction
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) removeLastPop() {
+	scope := &c.scopes[c.scopeIndex]
+	scope.instructions = scope.instructions[:scope.lastInstruction.Position]
+	scope.lastInstruction = scope.previousInstruction
+}
+
+// 回填跳转指令的操作数
+func (c *Compiler) changeOperand(opPos int, operands ...int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	c.checkOperands(op, operands)
+	newInstruction := code.Make(op, operands...)
+	copy(c.currentInstructions()[opPos:], newInstruction)
+}
+
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, CompilationScope{})
+	c.scopeIndex++
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+	c.symbolTable = c.symbolTable.Outer
+	return instructions
+}
@@ -0,0 +1,424 @@
+package compiler
+
+import (
+	"errors"
+	"fmt"
+	"github.com/qiuhoude/go-interpreter/ast"
+	"github.com/qiuhoude/go-interpreter/code"
+	"github.com/qiuhoude/go-interpreter/lexer"
+	"github.com/qiuhoude/go-interpreter/object"
+	"github.com/qiuhoude/go-interpreter/parser"
+	"strings"
+	"testing"
+)
+
+type compilerTestCase struct {
+	input                string
+	expectedConstants    []interface{}
+	expectedInstructions []code.Instructions
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "1 + 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1 <= 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpLessEqual),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "-1",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpMinus),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "if (true) { 10 }; 3333;",
+			expectedConstants: []interface{}{10, 3333},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),              // 0000
+				code.Make(code.OpJumpNotTruthy, 10), // 0001
+				code.Make(code.OpConstant, 0),       // 0004
+				code.Make(code.OpJump, 11),          // 0007
+				code.Make(code.OpNull),              // 0010
+				code.Make(code.OpPop),               // 0011
+				code.Make(code.OpConstant, 1),       // 0012
+				code.Make(code.OpPop),               // 0015
+			},
+		},
+		{
+			input:             "if (true) { let a = 1; }",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),              // 0000
+				code.Make(code.OpJumpNotTruthy, 14), // 0001
+				code.Make(code.OpConstant, 0),       // 0004
+				code.Make(code.OpSetGlobal, 0),      // 0007
+				code.Make(code.OpNull),              // 0010
+				code.Make(code.OpJump, 15),          // 0011
+				code.Make(code.OpNull),              // 0014
+				code.Make(code.OpPop),               // 0015
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestLogicalExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "true && false",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),              // 0000
+				code.Make(code.OpJumpNotTruthy, 12), // 0001
+				code.Make(code.OpFalse),             // 0004
+				code.Make(code.OpJumpNotTruthy, 12), // 0005
+				code.Make(code.OpTrue),              // 0008
+				code.Make(code.OpJump, 13),          // 0009
+				code.Make(code.OpFalse),             // 0012
+				code.Make(code.OpPop),               // 0013
+			},
+		},
+		{
+			input:             "true || false",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),              // 0000
+				code.Make(code.OpJumpNotTruthy, 8),  // 0001
+				code.Make(code.OpTrue),              // 0004
+				code.Make(code.OpJump, 17),          // 0005
+				code.Make(code.OpFalse),             // 0008
+				code.Make(code.OpJumpNotTruthy, 16), // 0009
+				code.Make(code.OpTrue),              // 0012
+				code.Make(code.OpJump, 17),          // 0013
+				code.Make(code.OpFalse),             // 0016
+				code.Make(code.OpPop),               // 0017
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestInterpolatedString(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `"a${1}b"`,
+			expectedConstants: []interface{}{"a", 1, "b"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConcat, 3),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let one = 1; let two = one; two;",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// 块中的同名变量使用新的槽位
+			input:             "let a = 1; { let a = 2; a }; a",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestFunctions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "fn(a) { let b = a; fn() { b } }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0, 1),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpClosure, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "len([])",
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetBuiltin, 3),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestLoops(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "while (true) { break }",
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpSetupLoop, 19, 5),
+				code.Make(code.OpTrue),
+				code.Make(code.OpJumpNotTruthy, 19),
+				code.Make(code.OpPushScope, 0),
+				code.Make(code.OpBreak),
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+				code.Make(code.OpPopScope),
+				code.Make(code.OpJump, 5),
+				code.Make(code.OpPopBlock),
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "for (x in [1]) { continue }",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpIter),
+				code.Make(code.OpSetupLoop, 29, 12),
+				code.Make(code.OpIterNext, 29, 1),
+				code.Make(code.OpPushScope, 1),
+				code.Make(code.OpSetLoop, 0, 0),
+				code.Make(code.OpContinue),
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+				code.Make(code.OpPopScope),
+				code.Make(code.OpJump, 12),
+				code.Make(code.OpPopBlock),
+				code.Make(code.OpPop),
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// 闭包通过 free 变量捕获当次迭代的槽位
+			input: "fn() { for (x in [1]) { let y = x; fn() { x + y } } }",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0, 0),
+					code.Make(code.OpGetFree, 0, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpArray, 1),
+					code.Make(code.OpIter),
+					code.Make(code.OpSetupLoop, 36, 12),
+					code.Make(code.OpIterNext, 36, 1),
+					code.Make(code.OpPushScope, 2),
+					code.Make(code.OpSetLoop, 0, 0),
+					code.Make(code.OpGetLoop, 0, 0),
+					code.Make(code.OpSetLoop, 0, 1),
+					code.Make(code.OpClosure, 1),
+					code.Make(code.OpPop),
+					code.Make(code.OpPopScope),
+					code.Make(code.OpJump, 12),
+					code.Make(code.OpPopBlock),
+					code.Make(code.OpPop),
+					code.Make(code.OpNull),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestTryExpression(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "try { 1 } catch (e) { 2 }",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpSetupTry, 9, 16),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpEndTry),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpEndTry),
+				code.Make(code.OpEndFinally),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestUnsupported(t *testing.T) {
+	inputs := []string{
+		"let [a, b] = [1, 2]",
+		"fn(a = 1) { a }",
+		"len(...[[1]])",
+	}
+	for _, input := range inputs {
+		err := New().Compile(parse(input))
+		if !errors.Is(err, ErrUnsupported) {
+			t.Fatalf("%s: want ErrUnsupported, got %v", input, err)
+		}
+	}
+}
+
+// 操作数超出指令中的宽度时返回错误, 而不是生成截断的字节码
+func TestOperandOverflow(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{strings.Repeat("1;", 1<<16+1), "operand of OpConstant out of range: 65536, max 65535"},
+		{"[" + strings.Repeat("true, ", 1<<16-1) + "true]", "operand of OpArray out of range: 65536, max 65535"},
+		{"hash{" + strings.Repeat("true: true, ", 1<<15-1) + "true: true}", "operand of OpHash out of range: 65536, max 65535"},
+		{"if (true) {" + strings.Repeat("true;", 1<<15) + "}", "operand of OpJumpNotTruthy out of range: 65542, max 65535"},
+	}
+	for _, tt := range tests {
+		err := New().Compile(parse(tt.input))
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%v", tt.expected, err)
+		}
+	}
+}
+
+func runCompilerTests(t *testing.T, tests []compilerTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		compiler := New()
+		if err := compiler.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		bytecode := compiler.Bytecode()
+		if err := testInstructions(tt.expectedInstructions, bytecode.Instructions); err != nil {
+			t.Fatalf("%s: testInstructions failed: %s", tt.input, err)
+		}
+		if err := testConstants(tt.expectedConstants, bytecode.Constants); err != nil {
+			t.Fatalf("%s: testConstants failed: %s", tt.input, err)
+		}
+	}
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func concatInstructions(s []code.Instructions) code.Instructions {
+	out := code.Instructions{}
+	for _, ins := range s {
+		out = append(out, ins...)
+	}
+	return out
+}
+
+func testInstructions(expected []code.Instructions, actual code.Instructions) error {
+	concatted := concatInstructions(expected)
+	if len(actual) != len(concatted) {
+		return fmt.Errorf("wrong instructions length.\nwant=%q\ngot =%q",
+			concatted, actual)
+	}
+	for i, ins := range concatted {
+		if actual[i] != ins {
+			return fmt.Errorf("wrong instruction at %d.\nwant=%q\ngot =%q",
+				i, concatted, actual)
+		}
+	}
+	return nil
+}
+
+func testConstants(expected []interface{}, actual []object.Object) error {
+	if len(expected) != len(actual) {
+		return fmt.Errorf("wrong number of constants. got=%d, want=%d",
+			len(actual), len(expected))
+	}
+	for i, constant := range expected {
+		switch constant := constant.(type) {
+		case int:
+			integer, ok := actual[i].(*object.Integer)
+			if !ok || integer.Value != int64(constant) {
+				return fmt.Errorf("constant %d - wrong integer. got=%+v, want=%d",
+					i, actual[i], constant)
+			}
+		case string:
+			str, ok := actual[i].(*object.String)
+			if !ok || str.Value != constant {
+				return fmt.Errorf("constant %d - wrong string. got=%+v, want=%q",
+					i, actual[i], constant)
+			}
+		case []code.Instructions:
+			fn, ok := actual[i].(*object.CompiledFunction)
+			if !ok {
+				return fmt.Errorf("constant %d - not a function: %T", i, actual[i])
+			}
+			if err := testInstructions(constant, fn.Instructions); err != nil {
+				return fmt.Errorf("constant %d - testInstructions failed: %s", i, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package compiler
+
+/*
+符号表
+编译期将 identifier 解析为存储位置, 运行时只需按下标访问, 不用再按名字查找 map
+
+层级关系:
+	全局 (level 0)
+	  └─ 函数 (level 1)
+	       └─ 函数 (level 2) ...
+每一层函数内部又可以有多个块级作用域 {}, 块级作用域与所在函数共享同一组存储槽位,
+只是名字的可见范围不同.
+循环体例外: 和 evaluator 一样每次迭代都是新的绑定, 所以循环体有自己的一组槽位,
+vm 在每次迭代开始时重新分配, 闭包捕获的是当次迭代的槽位. 循环体也算一层存储:
+	全局 (level 0)
+	  └─ 函数 (level 1)
+	       └─ 循环体 (level 2)
+	            └─ 函数 (level 3) ...
+*/
+
+type SymbolScope string
+
+const (
+	GlobalScope  SymbolScope = "GLOBAL"
+	LocalScope   SymbolScope = "LOCAL"
+	FreeScope    SymbolScope = "FREE"
+	LoopScope    SymbolScope = "LOOP"
+	BuiltinScope SymbolScope = "BUILTIN"
+)
+
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+	Depth int // FreeScope: 0 表示直接外层的函数或循环体; LoopScope: 0 表示当前函数中最内层的循环体
+}
+
+// 同一层函数, 循环体(或全局)的所有块级作用域共享的存储槽位
+type slots struct {
+	names []string // 下标 -> 名字, 同名变量在不同块中占用不同槽位
+}
+
+func (s *slots) alloc(name string) int {
+	s.names = append(s.names, name)
+	return len(s.names) - 1
+}
+
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store   map[string]Symbol
+	slots   *slots
+	level   int // 存储的层级, 0 为全局
+	fnLevel int // 所在函数的层级, 比它深的是当前函数中的循环体
+}
+
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{
+		store: make(map[string]Symbol),
+		slots: &slots{},
+	}
+}
+
+// 函数作用域
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	return &SymbolTable{
+		Outer:   outer,
+		store:   make(map[string]Symbol),
+		slots:   &slots{},
+		level:   outer.level + 1,
+		fnLevel: outer.level + 1,
+	}
+}
+
+// 块级作用域 {}, 与外层共享存储槽位
+func NewBlockSymbolTable(outer *SymbolTable) *SymbolTable {
+	return &SymbolTable{
+		Outer:   outer,
+		store:   make(map[string]Symbol),
+		slots:   outer.slots,
+		level:   outer.level,
+		fnLevel: outer.fnLevel,
+	}
+}
+
+// 循环体的作用域, 循环变量和循环体中定义的变量都在其中, 有自己的存储槽位
+func NewLoopSymbolTable(outer *SymbolTable) *SymbolTable {
+	return &SymbolTable{
+		Outer:   outer,
+		store:   make(map[string]Symbol),
+		slots:   &slots{},
+		level:   outer.level + 1,
+		fnLevel: outer.fnLevel,
+	}
+}
+
+// 在当前作用域定义变量, 当前作用域已经定义过则复用原来的槽位
+func (s *SymbolTable) Define(name string) Symbol {
+	if sym, ok := s.store[name]; ok {
+		return sym
+	}
+	sym := Symbol{Name: name, Index: s.slots.alloc(name), Scope: LocalScope}
+	switch {
+	case s.level == 0:
+		sym.Scope = GlobalScope
+	case s.level > s.fnLevel:
+		sym.Scope = LoopScope
+	}
+	s.store[name] = sym
+	return sym
+}
+
+// 在全局作用域定义变量
+func (s *SymbolTable) DefineGlobal(name string) Symbol {
+	global := s
+	for global.Outer != nil {
+		global = global.Outer
+	}
+	return global.Define(name)
+}
+
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	for table := s; table != nil; table = table.Outer {
+		sym, ok := table.store[name]
+		if !ok {
+			continue
+		}
+		switch {
+		case sym.Scope == GlobalScope:
+		case table.level < s.fnLevel: // 外层函数或外层函数中循环体的变量
+			sym.Scope = FreeScope
+			sym.Depth = s.fnLevel - table.level - 1
+		case sym.Scope == LoopScope: // 当前函数中的循环体
+			sym.Depth = s.level - table.level
+		}
+		return sym, true
+	}
+	return Symbol{}, false
+}
+
+// 当前函数, 循环体(或全局)已分配的槽位数
+func (s *SymbolTable) NumDefinitions() int {
+	return len(s.slots.names)
+}
+
+// 槽位对应的名字, 用于运行时报错
+func (s *SymbolTable) Names() []string {
+	return s.slots.names
+}
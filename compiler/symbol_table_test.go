@@ -0,0 +1,132 @@
+package compiler
+
+import "testing"
+
+func TestResolveNestedScopes(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	firstLocal := NewEnclosedSymbolTable(global)
+	firstLocal.Define("b")
+
+	block := NewBlockSymbolTable(firstLocal)
+	block.Define("c")
+
+	secondLocal := NewEnclosedSymbolTable(block)
+	secondLocal.Define("d")
+
+	tests := []struct {
+		table    *SymbolTable
+		expected []Symbol
+	}{
+		{
+			block,
+			[]Symbol{
+				{Name: "a", Scope: GlobalScope, Index: 0},
+				{Name: "b", Scope: LocalScope, Index: 0},
+				{Name: "c", Scope: LocalScope, Index: 1},
+			},
+		},
+		{
+			secondLocal,
+			[]Symbol{
+				{Name: "a", Scope: GlobalScope, Index: 0},
+				{Name: "b", Scope: FreeScope, Index: 0, Depth: 0},
+				{Name: "c", Scope: FreeScope, Index: 1, Depth: 0},
+				{Name: "d", Scope: LocalScope, Index: 0},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, sym := range tt.expected {
+			result, ok := tt.table.Resolve(sym.Name)
+			if !ok {
+				t.Errorf("name %s not resolvable", sym.Name)
+				continue
+			}
+			if result != sym {
+				t.Errorf("expected %s to resolve to %+v, got=%+v",
+					sym.Name, sym, result)
+			}
+		}
+	}
+	if firstLocal.NumDefinitions() != 2 {
+		t.Errorf("block should share slots with function. got=%d",
+			firstLocal.NumDefinitions())
+	}
+}
+
+func TestDefineShadowing(t *testing.T) {
+	global := NewSymbolTable()
+	a := global.Define("a")
+	if again := global.Define("a"); again != a {
+		t.Errorf("redefine in same scope should reuse slot. got=%+v", again)
+	}
+
+	block := NewBlockSymbolTable(global)
+	inner := block.Define("a")
+	if inner.Index == a.Index {
+		t.Errorf("shadowed variable should use a new slot. got=%+v", inner)
+	}
+	if len(global.Names()) != 2 {
+		t.Errorf("wrong global names. got=%v", global.Names())
+	}
+}
+
+func TestResolveLoopScopes(t *testing.T) {
+	global := NewSymbolTable()
+	fn := NewEnclosedSymbolTable(global)
+	fn.Define("a")
+
+	outerLoop := NewLoopSymbolTable(fn)
+	outerLoop.Define("i")
+	innerLoop := NewLoopSymbolTable(NewBlockSymbolTable(outerLoop))
+	innerLoop.Define("j")
+
+	closure := NewEnclosedSymbolTable(innerLoop)
+
+	tests := []struct {
+		table    *SymbolTable
+		expected []Symbol
+	}{
+		{
+			innerLoop,
+			[]Symbol{
+				{Name: "a", Scope: LocalScope, Index: 0},
+				{Name: "i", Scope: LoopScope, Index: 0, Depth: 1},
+				{Name: "j", Scope: LoopScope, Index: 0, Depth: 0},
+			},
+		},
+		{
+			closure,
+			[]Symbol{
+				{Name: "a", Scope: FreeScope, Index: 0, Depth: 2},
+				{Name: "i", Scope: FreeScope, Index: 0, Depth: 1},
+				{Name: "j", Scope: FreeScope, Index: 0, Depth: 0},
+			},
+		},
+	}
+	for _, tt := range tests {
+		for _, sym := range tt.expected {
+			result, ok := tt.table.Resolve(sym.Name)
+			if !ok {
+				t.Errorf("name %s not resolvable", sym.Name)
+				continue
+			}
+			if result != sym {
+				t.Errorf("expected %s to resolve to %+v, got=%+v",
+					sym.Name, sym, result)
+			}
+		}
+	}
+	if fn.NumDefinitions() != 1 {
+		t.Errorf("loop body should have its own slots. got=%d", fn.NumDefinitions())
+	}
+
+	// 顶层的循环变量不是全局变量
+	topLoop := NewLoopSymbolTable(global)
+	if sym := topLoop.Define("k"); sym.Scope != LoopScope {
+		t.Errorf("top level loop variable should be LoopScope. got=%+v", sym)
+	}
+}
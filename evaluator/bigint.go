@@ -0,0 +1,163 @@
+package evaluator
+
+import (
+	"github.com/qiuhoude/go-interpreter/object"
+	"math"
+	"math/big"
+)
+
+/*
+integer 运算溢出时提升为 BigInt, 结果能放进 int64 时再变回 Integer,
+脚本中两者可以混合运算
+*/
+
+// << 和 ** 的结果最多的 bit 数, 避免一次运算分配过大的内存
+const maxBigBits = 1 << 20
+
+// 带溢出检查的 int64 运算, ok 为 false 表示溢出. 供 vm 复用
+func AddInt(a, b int64) (int64, bool) {
+	c := a + b
+	return c, (c > a) == (b > 0)
+}
+
+func SubInt(a, b int64) (int64, bool) {
+	c := a - b
+	return c, (c < a) == (b > 0)
+}
+
+func MulInt(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	c := a * b
+	return c, (c < 0) == ((a < 0) != (b < 0)) && c/b == a
+}
+
+func isInteger(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.BIGINT_OBJ
+}
+
+func toBigInt(obj object.Object) *big.Int {
+	if i, ok := obj.(*object.Integer); ok {
+		return big.NewInt(i.Value)
+	}
+	return obj.(*object.BigInt).Value
+}
+
+// 能放进 int64 时返回 Integer
+func bigIntToObject(v *big.Int) object.Object {
+	if v.IsInt64() {
+		return object.NewInteger(v.Int64())
+	}
+	return &object.BigInt{Value: v}
+}
+
+func evalBigIntInfixExpression(operator string, left object.Object, right object.Object) object.Object {
+	leftVal := toBigInt(left)
+	rightVal := toBigInt(right)
+	switch operator {
+	case "+":
+		return bigIntToObject(new(big.Int).Add(leftVal, rightVal))
+	case "-":
+		return bigIntToObject(new(big.Int).Sub(leftVal, rightVal))
+	case "*":
+		return bigIntToObject(new(big.Int).Mul(leftVal, rightVal))
+	case "/":
+		if rightVal.Sign() == 0 {
+			return newTypedError(object.ArgumentErrorClass, "division by zero")
+		}
+		return bigIntToObject(new(big.Int).Quo(leftVal, rightVal)) // 与 int64 一样向零取整
+	case "%":
+		if rightVal.Sign() == 0 {
+			return newTypedError(object.ArgumentErrorClass, "division by zero")
+		}
+		return bigIntToObject(new(big.Int).Rem(leftVal, rightVal))
+	case "&":
+		return bigIntToObject(new(big.Int).And(leftVal, rightVal))
+	case "|":
+		return bigIntToObject(new(big.Int).Or(leftVal, rightVal))
+	case "^":
+		return bigIntToObject(new(big.Int).Xor(leftVal, rightVal))
+	case "<<", ">>":
+		return shiftBigInt(operator, leftVal, rightVal)
+	case "**":
+		return powBigInt(leftVal, rightVal)
+	case "<":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) < 0)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) > 0)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) <= 0)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) >= 0)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) == 0)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) != 0)
+	default:
+		return newTypedError(object.TypeErrorClass, "unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+}
+
+func shiftBigInt(operator string, x, n *big.Int) object.Object {
+	switch {
+	case n.Sign() < 0:
+		return newTypedError(object.ArgumentErrorClass, "negative shift count: %s", n)
+	case operator == ">>":
+		if !n.IsInt64() || n.Int64() > int64(x.BitLen()) {
+			return bigIntToObject(new(big.Int).Rsh(x, uint(x.BitLen()))) // 0 或 -1
+		}
+		return bigIntToObject(new(big.Int).Rsh(x, uint(n.Int64())))
+	case x.Sign() == 0:
+		return object.NewInteger(0)
+	case !n.IsInt64() || n.Int64()+int64(x.BitLen()) > maxBigBits:
+		return newTypedError(object.ArgumentErrorClass, "integer too large: shift count %s", n)
+	}
+	return bigIntToObject(new(big.Int).Lsh(x, uint(n.Int64())))
+}
+
+// 指数为负数时结果是 float
+func powInt(base, exp int64) object.Object {
+	if exp < 0 {
+		return &object.Float{Value: math.Pow(float64(base), float64(exp))}
+	}
+	result, b := int64(1), base
+	for e := exp; ; {
+		var ok bool
+		if e&1 == 1 {
+			if result, ok = MulInt(result, b); !ok {
+				return powBigInt(big.NewInt(base), big.NewInt(exp))
+			}
+		}
+		if e >>= 1; e == 0 {
+			return object.NewInteger(result)
+		}
+		if b, ok = MulInt(b, b); !ok {
+			return powBigInt(big.NewInt(base), big.NewInt(exp))
+		}
+	}
+}
+
+func powBigInt(x, y *big.Int) object.Object {
+	if y.Sign() < 0 {
+		xf, _ := new(big.Float).SetInt(x).Float64()
+		yf, _ := new(big.Float).SetInt(y).Float64()
+		return &object.Float{Value: math.Pow(xf, yf)}
+	}
+	// |x| >= 2 时结果至少有 (bitLen(x) - 1) * y 位
+	if bits := int64(x.BitLen() - 1); bits > 0 && (!y.IsInt64() || y.Int64() > maxBigBits/bits) {
+		return newTypedError(object.ArgumentErrorClass, "integer too large: exponent %s", y)
+	}
+	if !y.IsInt64() { // x 为 0, 1, -1, 只需要保留奇偶性
+		y = new(big.Int).Add(big.NewInt(2), new(big.Int).Rem(y, big.NewInt(2)))
+	}
+	return bigIntToObject(new(big.Int).Exp(x, y, nil))
+}
+
+func negateInteger(i *object.Integer) object.Object {
+	if i.Value == math.MinInt64 {
+		return &object.BigInt{Value: new(big.Int).Neg(big.NewInt(i.Value))}
+	}
+	return object.NewInteger(-i.Value)
+}
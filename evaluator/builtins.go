@@ -1,17 +1,48 @@
 package evaluator
 
 import (
+	"bufio"
 	"fmt"
 	"github.com/qiuhoude/go-interpreter/object"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
 )
 
-var builtins = map[string]object.Object{
-	"len":   makeBuiltin(builtinLen),
-	"first": makeBuiltin(builtinFirst),
-	"last":  makeBuiltin(builtinLast),
-	"rest":  makeBuiltin(builtinRest),
-	"push":  makeBuiltin(builtinPush),
-	"print": makeBuiltin(builtinPint),
+// 默认的内建函数表, 使用进程的标准输入输出
+var builtins = NewBuiltins(os.Stdout, os.Stdin)
+
+// 创建一份独立的内建函数表, print 输出到 out, input 从 in 读取
+func NewBuiltins(out io.Writer, in io.Reader) map[string]object.Object {
+	return map[string]object.Object{
+		"len":   makeBuiltin(builtinLen),
+		"first": makeBuiltin(builtinFirst),
+		"last":  makeBuiltin(builtinLast),
+		"rest":  makeBuiltin(builtinRest),
+		"push":  makeBuiltin(builtinPush),
+		"range": makeBuiltin(builtinRange),
+		"print": makeBuiltin(builtinPrint(out)),
+		"input": makeBuiltin(builtinInput(bufio.NewReader(in))),
+	}
+}
+
+// 内建函数名按字典序排列, 编译器通过下标引用内建函数
+var BuiltinNames = sortedBuiltinNames()
+
+func sortedBuiltinNames() []string {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func LookupBuiltin(name string) (object.Object, bool) {
+	builtin, ok := builtins[name]
+	return builtin, ok
 }
 
 func makeBuiltin(fn object.BuiltinFunction) *object.Builtin {
@@ -20,27 +51,27 @@ func makeBuiltin(fn object.BuiltinFunction) *object.Builtin {
 
 func builtinLen(args ...object.Object) object.Object {
 	if len(args) != 1 {
-		return newError("wrong number of arguments. got=%d, want=1",
+		return newTypedError(object.ArgumentErrorClass, "wrong number of arguments. got=%d, want=1",
 			len(args))
 	}
 	switch arg := args[0].(type) {
-	case *object.String:
-		return &object.Integer{Value: int64(len(arg.Value))}
+	case *object.String: // 字符数, 不是字节数
+		return object.NewInteger(int64(utf8.RuneCountInString(arg.Value)))
 	case *object.Array:
-		return &object.Integer{Value: int64(len(arg.Elements))}
+		return object.NewInteger(int64(len(arg.Elements)))
 
 	default:
-		return newError("argument to `len` not supported, got %s", args[0].Type())
+		return newTypedError(object.TypeErrorClass, "argument to `len` not supported, got %s", args[0].Type())
 	}
 }
 
 func arrayOp(op func(*object.Array) object.Object, args ...object.Object) object.Object {
 	if len(args) != 1 {
-		return newError("wrong number of arguments. got=%d, want=1",
+		return newTypedError(object.ArgumentErrorClass, "wrong number of arguments. got=%d, want=1",
 			len(args))
 	}
 	if args[0].Type() != object.ARRAY_OBJ {
-		return newError("argument to `array operate` must be ARRAY, got %s",
+		return newTypedError(object.TypeErrorClass, "argument to `array operate` must be ARRAY, got %s",
 			args[0].Type())
 	}
 	arr := args[0].(*object.Array)
@@ -79,11 +110,11 @@ func builtinRest(args ...object.Object) object.Object {
 
 func builtinPush(args ...object.Object) object.Object {
 	if len(args) != 2 {
-		return newError("wrong number of arguments. got=%d, want=2",
+		return newTypedError(object.ArgumentErrorClass, "wrong number of arguments. got=%d, want=2",
 			len(args))
 	}
 	if args[0].Type() != object.ARRAY_OBJ {
-		return newError("argument to `push` must be ARRAY, got %s",
+		return newTypedError(object.TypeErrorClass, "argument to `push` must be ARRAY, got %s",
 			args[0].Type())
 	}
 	arr := args[0].(*object.Array)
@@ -94,9 +125,56 @@ func builtinPush(args ...object.Object) object.Object {
 	return &object.Array{Elements: newElements}
 }
 
-func builtinPint(args ...object.Object) object.Object {
-	for _, arg := range args {
-		fmt.Println(arg.Inspect())
+// range(end), range(start, end), range(start, end, step), 生成 [start, end) 的整数区间
+func builtinRange(args ...object.Object) object.Object {
+	if len(args) < 1 || len(args) > 3 {
+		return newTypedError(object.ArgumentErrorClass, "wrong number of arguments. got=%d, want=1..3",
+			len(args))
+	}
+	nums := make([]int64, len(args))
+	for i, arg := range args {
+		n, ok := arg.(*object.Integer)
+		if !ok {
+			return newTypedError(object.TypeErrorClass, "argument to `range` must be INTEGER, got %s",
+				arg.Type())
+		}
+		nums[i] = n.Value
+	}
+	r := &object.Range{Step: 1}
+	switch len(nums) {
+	case 1:
+		r.End = nums[0]
+	case 2:
+		r.Start, r.End = nums[0], nums[1]
+	case 3:
+		r.Start, r.End, r.Step = nums[0], nums[1], nums[2]
+	}
+	if r.Step == 0 {
+		return newTypedError(object.ArgumentErrorClass, "`range` step must not be zero")
+	}
+	return r
+}
+
+func builtinPrint(out io.Writer) object.BuiltinFunction {
+	return func(args ...object.Object) object.Object {
+		for _, arg := range args {
+			_, _ = fmt.Fprintln(out, arg.Inspect())
+		}
+		return NULL
+	}
+}
+
+// 读取一行输入, 不包含换行符; 没有更多输入时返回 null
+func builtinInput(in *bufio.Reader) object.BuiltinFunction {
+	return func(args ...object.Object) object.Object {
+		if len(args) != 0 {
+			return newTypedError(object.ArgumentErrorClass, "wrong number of arguments. got=%d, want=0",
+				len(args))
+		}
+		line, err := in.ReadString('\n')
+		if err != nil && line == "" {
+			return NULL
+		}
+		return &object.String{Value: strings.TrimRight(line, "\r\n")}
 	}
-	return NULL
 }
@@ -0,0 +1,142 @@
+package evaluator
+
+import (
+	"github.com/qiuhoude/go-interpreter/object"
+	"strings"
+)
+
+/*
+比较语义
+	==, !=         任意类型之间都可以比较. 数字按数值比较, array 和 hash 逐个元素深度比较,
+	               类型不同时不相等, 函数等其他对象比较引用
+	<, >, <=, >=   数字按数值比较, 字符串按字典序, array 按元素逐个比较, 前面都相等时短的更小
+*/
+
+func isOrderOperator(operator string) bool {
+	switch operator {
+	case "<", ">", "<=", ">=":
+		return true
+	}
+	return false
+}
+
+func objectsEqual(left, right object.Object) bool {
+	if isNumber(left) && isNumber(right) {
+		return numbersEqual(left, right)
+	}
+	if left.Type() != right.Type() {
+		return false
+	}
+	switch l := left.(type) {
+	case *object.String:
+		return l.Value == right.(*object.String).Value
+	case *object.Boolean:
+		return l.Value == right.(*object.Boolean).Value
+	case *object.Null:
+		return true
+	case *object.Array:
+		r := right.(*object.Array)
+		if len(l.Elements) != len(r.Elements) {
+			return false
+		}
+		for i := range l.Elements {
+			if !objectsEqual(l.Elements[i], r.Elements[i]) {
+				return false
+			}
+		}
+		return true
+	case *object.Hash:
+		r := right.(*object.Hash)
+		if len(l.Pairs) != len(r.Pairs) {
+			return false
+		}
+		for key, lp := range l.Pairs {
+			rp, ok := r.Pairs[key]
+			if !ok || !objectsEqual(lp.Value, rp.Value) {
+				return false
+			}
+		}
+		return true
+	}
+	return left == right
+}
+
+func numbersEqual(left, right object.Object) bool {
+	switch {
+	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
+		return left.(*object.Integer).Value == right.(*object.Integer).Value
+	case isInteger(left) && isInteger(right):
+		return toBigInt(left).Cmp(toBigInt(right)) == 0
+	}
+	return toFloat(left) == toFloat(right) // NaN 与任何值都不相等
+}
+
+func evalOrderExpression(operator string, left, right object.Object) object.Object {
+	cmp, errObj := compareObjects(operator, left, right)
+	if errObj != nil {
+		return errObj
+	}
+	switch operator {
+	case "<":
+		return nativeBoolToBooleanObject(cmp < 0)
+	case ">":
+		return nativeBoolToBooleanObject(cmp > 0)
+	case "<=":
+		return nativeBoolToBooleanObject(cmp <= 0)
+	default:
+		return nativeBoolToBooleanObject(cmp >= 0)
+	}
+}
+
+// 返回 -1, 0, 1. 不能比较大小时返回错误, 错误中是第一对不能比较的值的类型
+func compareObjects(operator string, left, right object.Object) (int, *object.Error) {
+	if isNumber(left) && isNumber(right) {
+		return compareNumbers(left, right), nil
+	}
+	if left.Type() != right.Type() {
+		return 0, newTypedError(object.TypeErrorClass, "type mismatch: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+	switch l := left.(type) {
+	case *object.String:
+		return strings.Compare(l.Value, right.(*object.String).Value), nil
+	case *object.Array:
+		r := right.(*object.Array)
+		for i := 0; i < len(l.Elements) && i < len(r.Elements); i++ {
+			if cmp, errObj := compareObjects(operator, l.Elements[i], r.Elements[i]); errObj != nil || cmp != 0 {
+				return cmp, errObj
+			}
+		}
+		return compareInts(int64(len(l.Elements)), int64(len(r.Elements))), nil
+	}
+	return 0, newTypedError(object.TypeErrorClass, "unknown operator: %s %s %s",
+		left.Type(), operator, right.Type())
+}
+
+// NaN 在这里被当成与任何数相等
+func compareNumbers(left, right object.Object) int {
+	switch {
+	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
+		return compareInts(left.(*object.Integer).Value, right.(*object.Integer).Value)
+	case isInteger(left) && isInteger(right):
+		return toBigInt(left).Cmp(toBigInt(right))
+	}
+	l, r := toFloat(left), toFloat(right)
+	switch {
+	case l < r:
+		return -1
+	case l > r:
+		return 1
+	}
+	return 0
+}
+
+func compareInts(l, r int64) int {
+	switch {
+	case l < r:
+		return -1
+	case l > r:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,555 @@
+package evaltest
+
+/*
+evaluator 和 vm 共用的脚本用例, 两种后端执行同一段脚本的结果必须一致.
+Expected 是执行结果的 Inspect, 错误带有 evaluator 中的位置, eg: "ERROR: 1:1: division by zero"
+*/
+
+type Case struct {
+	Input    string
+	Expected string
+}
+
+type Suite struct {
+	Name  string
+	Cases []Case
+}
+
+// 所有用例, 按名字分组
+var Suites = []Suite{
+	{"Basics", Basics},
+	{"Unicode", Unicode},
+	{"InterpolatedString", InterpolatedString},
+	{"Float", Float},
+	{"BigInt", BigInt},
+	{"Comparison", Comparison},
+	{"Operators", Operators},
+	{"RuntimeErrors", RuntimeErrors},
+	{"NoMutation", NoMutation},
+	{"TryCatch", TryCatch},
+	{"Loops", Loops},
+	{"AbruptCompletions", AbruptCompletions},
+	{"ForIn", ForIn},
+	{"FunctionParameters", FunctionParameters},
+	{"NamedArguments", NamedArguments},
+	{"Destructuring", Destructuring},
+}
+
+// 基础的表达式, 函数和内建函数
+var Basics = []Case{
+	// 赋值表达式的值是赋给变量的值
+	{"let a = 1; a = 2", "2"},
+	{"let a = 1; let b = (a = 3); [a, b]", "[3, 3]"},
+	{"let a = 0; [a = 1]", "[1]"},
+	{"5", "5"},
+	{"-5", "-5"},
+	{"-(+5)", "-5"},
+	{"+(-5)", "-5"},
+	{"!5", "false"},
+	{"!!true", "true"},
+	{"5 + 5 + 5 + 5 - 10", "10"},
+	{"2 * (5 + 10)", "30"},
+	{"(5 + 10 * 2 + 15 / 3) * 2 + -10", "50"},
+	{"1 < 2", "true"},
+	{"1 > 2", "false"},
+	{"1 == 1", "true"},
+	{"1 != 1", "false"},
+	{"true == true", "true"},
+	{"true != false", "true"},
+	{"(1 < 2) == true", "true"},
+	{"-2.5", "-2.5"},
+	{`"pi=" + 3.14`, "pi=3.14"},
+	{"hash{1: 2}[1.0]", "2"},
+	{`"b" >= "abc"`, "true"},
+	{"[1, [2]] == [1, [2]]", "true"},
+	{`hash{"a": 1} != hash{"a": 2}`, "true"},
+	{"2.5 <= 2", "false"},
+	{"9223372036854775808 - 1", "9223372036854775807"},
+	{"9223372036854775808 > 1", "true"},
+	{"if (1 < 2 && 2 < 3) { 10 } else { 20 }", "10"},
+	{"let n = 0; let inc = fn() { n = n + 1; true }; false && inc(); true || inc(); true && inc(); n", "1"},
+	{"if (true) { 10 }", "10"},
+	{"if (false) { 10 }", "null"},
+	{"if (1) { 10 }", "10"},
+	{"if (1 > 2) { 10 } else { 20 }", "20"},
+	{"if (1 < 2) { 10 } else { 20 }", "10"},
+	{"return 10; 9;", "10"},
+	{"9; return 2 * 5; 9;", "10"},
+	{"if (10 > 1) { if (10 > 1) { return 10; } return 1; }", "10"},
+	{"5 + true;", "ERROR: 1:1: type mismatch: INTEGER + BOOLEAN"},
+	{"5 + true; 5;", "ERROR: 1:1: type mismatch: INTEGER + BOOLEAN"},
+	{"true + false;", "ERROR: 1:1: unknown operator: BOOLEAN + BOOLEAN"},
+	{"5; true + false; 5", "ERROR: 1:4: unknown operator: BOOLEAN + BOOLEAN"},
+	{"if (10 > 1) { true + false; }", "ERROR: 1:15: unknown operator: BOOLEAN + BOOLEAN"},
+	{"if (10 > 1) { if (10 > 1) { return true + false; } return 1; }", "ERROR: 1:36: unknown operator: BOOLEAN + BOOLEAN"},
+	{"foobar", "ERROR: 1:1: identifier not found: foobar"},
+	{`"Hello" - "World"`, "ERROR: 1:1: unknown operator: STRING - STRING"},
+	{`hash{"name": "Monkey"}[fn(x) { x }];`, "ERROR: 1:1: unusable as hash key: FUNCTION"},
+	{"let a = 5; a;", "5"},
+	{"let a = 5 * 5; a;", "25"},
+	{"let a = 5; let b = a; let c = a + b + 5; c;", "15"},
+	{"let a = 6; if( true ){ let a = 5; }  a;", "6"},
+	{"let a = 10; { let a = 5; };  a;", "10"},
+	{"let a = 10; { a = 5; };  a;", "5"},
+	{"{ b = 5; };  b;", "5"},
+	{"let identity = fn(x) { x; }; identity(5);", "5"},
+	{"let identity = fn(x) { return x; }; identity(5);", "5"},
+	{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", "20"},
+	{"fn(x) { x; }(5)", "5"},
+	{"let newAdder = fn(x) { fn(y) { x + y } }; let addTwo = newAdder(2); addTwo(3);", "5"},
+	{"let counter = fn() { let n = 0; fn() { n = n + 1; n } }; let c = counter(); c(); c(); c()", "3"},
+	{"fn() { let x = 1; let f = fn() { x }; x = 2; f() }()", "2"},
+	{"let f = fn(n) { if (n == 0) { 0 } else { n + f(n - 1) } }; f(100)", "5050"},
+	{"fn() { let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(15) }()", "610"},
+	{`len("hello world")`, "11"},
+	{"len(1)", "ERROR: 1:1: argument to `len` not supported, got INTEGER"},
+	{`len("one", "two")`, "ERROR: 1:1: wrong number of arguments. got=2, want=1"},
+	{"first([1, 2, 3])", "1"},
+	{"last([1, 2, 3])", "3"},
+	{"rest([1, 2, 3])", "[2, 3]"},
+	{"push([1], 2)", "[1, 2]"},
+	{"let len = fn(x) { 42 }; len([])", "42"},
+	{`"Hello" + " " + "World!"`, "Hello World!"},
+	{`"Hello" +" " +  1`, "Hello 1"},
+	{`"Hello" +" " + true`, "Hello true"},
+	{`"${1.0} ${first([])} ${[1, "a"]} ${true}"`, "1.0 null [1, a] true"},
+	{`"abc"[true]`, "ERROR: 1:1: index operator not supported: STRING"},
+	{"[1, 2 * 2, 3 + 3]", "[1, 4, 6]"},
+	{"[1, 2, 3][1 + 1];", "3"},
+	{"[1, 2, 3][3]", "null"},
+	{"[1, 2, 3][-1]", "null"},
+	{"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]", "2"},
+	{`hash{"foo": 5}["foo"]`, "5"},
+	{`hash{"foo": 5}["bar"]`, "null"},
+	{`hash{}["foo"]`, "null"},
+	{"hash{5: 5}[5]", "5"},
+	{"hash{true: 5}[true]", "5"},
+	{`let two = "two"; hash{"one": 10 - 9, two: 1 + 1, "thr" + "ee": 6 / 2}["three"]`, "3"},
+	{`
+let map = fn(arr, f) {
+	let iter = fn(arr, accumulated) {
+		if (len(arr) == 0) {
+			accumulated
+		} else {
+			iter(rest(arr), push(accumulated, f(first(arr))));
+		}
+	};
+	iter(arr, []);
+};
+map([1, 2, 3, 4], fn(x) { x * 2 });`, "[2, 4, 6, 8]"},
+}
+
+// 标识符和字符串中的 Unicode
+var Unicode = []Case{
+	{`let 名字 = "张三"; 名字`, "张三"},
+	{"let 计数x1 = fn(x) { x * 2 }; 计数x1(21)", "42"},
+	{`len("你好")`, "2"},
+	{`len("héllo")`, "5"},
+	{`len("")`, "0"},
+	{`"你好世界"[1]`, "好"},
+	{`"abc"[2]`, "c"},
+	{`"你好"[2]`, "null"},
+	{`"你好"[-1]`, "null"},
+	{`let s = ""; for (c in "你好") { s = c + s }; s`, "好你"},
+	{`let r = []; for (i, c in "中文") { r = push(r, i) }; r`, "[0, 1]"},
+	{`"你好"["a"]`, "ERROR: 1:1: index operator not supported: STRING"},
+}
+
+// 字符串插值
+var InterpolatedString = []Case{
+	{`let name = "张三"; "Hello ${name}!"`, "Hello 张三!"},
+	{`let a = 1; let b = 2; "total ${a + b}"`, "total 3"},
+	{`"${1.0} ${first([])} ${[1, "a"]} ${true} ${9223372036854775808}"`, "1.0 null [1, a] true 9223372036854775808"},
+	{`"${hash{"k": 1}}"`, "hash{k: 1}"},
+	{`"a${"b${1 + 1}"}c"`, "ab2c"},
+	{`let h = hash{"k": "v"}; "${h["k"]}"`, "v"},
+	{`"\${x} $y"`, "${x} $y"},
+	{`"${"a"}${"b"}"`, "ab"},
+	{`let f = fn(x) { "<${x}>" }; f(f(1))`, "<<1>>"},
+	{`"x${undefinedVar}"`, "ERROR: 1:5: identifier not found: undefinedVar"},
+	{`"${1 + true}"`, "ERROR: 1:4: type mismatch: INTEGER + BOOLEAN"},
+}
+
+// 浮点数
+var Float = []Case{
+	{"3.14", "3.14"},
+	{"1e-9", "1e-09"},
+	{"2.5E+3", "2500.0"},
+	{"-1.5", "-1.5"},
+	{"+1.5", "1.5"},
+	{"let f = 1.5; -f; f", "1.5"},
+	{"0.1 + 0.2", "0.30000000000000004"},
+	{"1.5 * 2", "3.0"},
+	{"2 * 1.5", "3.0"},
+	{"7 / 2.0", "3.5"},
+	{"7 / 2", "3"},
+	{"1 - 0.5", "0.5"},
+	{"1.0 / 0", "+Inf"},
+	{"1 == 1.0", "true"},
+	{"1.5 != 1.5", "false"},
+	{"0.5 < 1", "true"},
+	{"2 > 2.5", "false"},
+	{"!1.5", "false"},
+	{`"price: " + 9.99`, "price: 9.99"},
+	{"1.5 + true", "ERROR: 1:1: type mismatch: FLOAT + BOOLEAN"},
+	{"-true", "ERROR: 1:1: unknown operator: -BOOLEAN"},
+	{"hash{1: \"int\"}[1.0]", "int"},
+	{"hash{1.5: \"a\"}[1.5]", "a"},
+	{"let total = 0.0; for (p in [9.99, 0.01, 5]) { total = total + p }; total", "15.0"},
+}
+
+// 超出 int64 时提升为 BigInt
+var BigInt = []Case{
+	{"9223372036854775807 + 1", "9223372036854775808"},
+	{"-9223372036854775807 - 2", "-9223372036854775809"},
+	{"9223372036854775807 * 2", "18446744073709551614"},
+	{"-9223372036854775807 - 1", "-9223372036854775808"},
+	{"let m = -9223372036854775807 - 1; m / -1", "9223372036854775808"},
+	{"let m = -9223372036854775807 - 1; -m", "9223372036854775808"},
+	{"-9223372036854775808", "-9223372036854775808"},
+	{"123456789012345678901234567890", "123456789012345678901234567890"},
+	{"123456789012345678901234567890 * 0", "0"},
+	{"123456789012345678901234567890 / 10", "12345678901234567890123456789"},
+	{"-123456789012345678901234567890 / 7", "-17636684144620811271604938270"},
+	{"123456789012345678901234567890 / 0", "ERROR: 1:1: division by zero"},
+	// 结果能放进 int64 时变回 Integer
+	{"let b = 9223372036854775807 + 1; b - 1", "9223372036854775807"},
+	{"[9223372036854775807 + 1 - 1][0]", "9223372036854775807"},
+	{"9223372036854775808 > 9223372036854775807", "true"},
+	{"1 < 9223372036854775808", "true"},
+	{"9223372036854775808 == 9223372036854775808", "true"},
+	{"9223372036854775808 != 1", "true"},
+	{"9223372036854775808 * 0.5", "4.611686018427388e+18"},
+	{"18446744073709551616 == 1.8446744073709552e19", "true"},
+	{`"id-" + 123456789012345678901234567890`, "id-123456789012345678901234567890"},
+	{"9223372036854775808 + true", "ERROR: 1:1: type mismatch: BIGINT + BOOLEAN"},
+	{"let f = fn(n) { if (n == 0) { 1 } else { n * f(n - 1) } }; f(25)", "15511210043330985984000000"},
+	{"hash{123456789012345678901234567890: \"big\"}[123456789012345678901234567890]", "big"},
+	{"hash{9223372036854775807: \"max\"}[9223372036854775808 - 1]", "max"},
+	{"hash{18446744073709551616: \"float\"}[1.8446744073709552e19]", "float"},
+}
+
+// 比较运算
+var Comparison = []Case{
+	{"1 <= 1", "true"},
+	{"1 >= 2", "false"},
+	{"2 >= 1.5", "true"},
+	{"1.5 <= 1", "false"},
+	{"9223372036854775808 >= 9223372036854775808", "true"},
+	{`"a" == "a"`, "true"},
+	{`"a" != "b"`, "true"},
+	{`"apple" < "banana"`, "true"},
+	{`"b" > "abc"`, "true"},
+	{`"ab" <= "ab"`, "true"},
+	{`"" < "a"`, "true"},
+	// 不同类型之间 == 不报错
+	{`1 == "1"`, "false"},
+	{`"1" != 1`, "true"},
+	{"true == 1", "false"},
+	{"first([]) == first([])", "true"},
+	{"[] == first([])", "false"},
+	{"let f = fn() { }; f == f", "true"},
+	{"fn() { } == fn() { }", "false"},
+	{"len == len", "true"},
+	// array 和 hash 深度比较
+	{"[1, 2, [3]] == [1, 2, [3]]", "true"},
+	{"[1, 2] == [1, 2, 3]", "false"},
+	{"[1, 2.0] == [1.0, 2]", "true"},
+	{`hash{"a": [1], "b": 2} == hash{"b": 2, "a": [1]}`, "true"},
+	{`hash{"a": 1} == hash{"a": 2}`, "false"},
+	{`hash{"a": 1} != hash{"b": 1}`, "true"},
+	{"[1, 2] < [1, 3]", "true"},
+	{"[1, 2] < [1, 2, 0]", "true"},
+	{"[2] > [1, 9]", "true"},
+	{`["b", 1] >= ["a", 2]`, "true"},
+	{"[] <= []", "true"},
+	// 不能比较大小
+	{`1 < "a"`, "ERROR: 1:1: type mismatch: INTEGER < STRING"},
+	{"true < false", "ERROR: 1:1: unknown operator: BOOLEAN < BOOLEAN"},
+	{`[1, "a"] < [1, 2]`, "ERROR: 1:1: type mismatch: STRING < INTEGER"},
+	{`hash{} < hash{}`, "ERROR: 1:1: unknown operator: HASH < HASH"},
+	{"[1] < 1", "ERROR: 1:1: type mismatch: ARRAY < INTEGER"},
+	{`"a" - "b"`, "ERROR: 1:1: unknown operator: STRING - STRING"},
+	{"let max = fn(a, b) { if (a >= b) { a } else { b } }; max(\"pear\", \"apple\")", "pear"},
+}
+
+// 逻辑, 位运算, 取模和幂
+var Operators = []Case{
+	{"true && true", "true"},
+	{"true && false", "false"},
+	{"false || true", "true"},
+	{"false || false", "false"},
+	{"1 && \"a\"", "true"},
+	{"first([]) || 0", "true"},
+	{"first([]) && true", "false"},
+	// 短路, 右边不会求值
+	{"false && undefinedVar", "false"},
+	{"true || (1 / 0)", "true"},
+	{"let n = 0; let inc = fn() { n = n + 1; true }; false && inc(); true || inc(); n", "0"},
+	{"let n = 0; let inc = fn() { n = n + 1; true }; true && inc(); false || inc(); n", "2"},
+	{"true && undefinedVar", "ERROR: 1:9: identifier not found: undefinedVar"},
+	{"7 % 3", "1"},
+	{"-7 % 3", "-1"},
+	{"7 % -3", "1"},
+	{"7 % 0", "ERROR: 1:1: division by zero"},
+	{"7.5 % 2", "1.5"},
+	{"6 & 3", "2"},
+	{"6 | 3", "7"},
+	{"6 ^ 3", "5"},
+	{"-1 & 255", "255"},
+	{"1 << 10", "1024"},
+	{"1024 >> 3", "128"},
+	{"-16 >> 2", "-4"},
+	{"1 << 63", "9223372036854775808"},
+	{"1 << 64 >> 64", "1"},
+	{"-1 << 100", "-1267650600228229401496703205376"},
+	{"1 >> 100", "0"},
+	{"-1 >> 100", "-1"},
+	{"1 << -1", "ERROR: 1:1: negative shift count: -1"},
+	{"1 << 9223372036854775808", "ERROR: 1:1: integer too large: shift count 9223372036854775808"},
+	{"0 << 9223372036854775808", "0"},
+	{"2 ** 10", "1024"},
+	{"2 ** 3 ** 2", "512"},
+	{"-2 ** 2", "-4"},
+	{"(-2) ** 3", "-8"},
+	{"2 ** 0", "1"},
+	{"0 ** 0", "1"},
+	{"2 ** -1", "0.5"},
+	{"2 ** 64", "18446744073709551616"},
+	{"3 ** 40", "12157665459056928801"},
+	{"(2 ** 64) ** 2", "340282366920938463463374607431768211456"},
+	{"2.0 ** 0.5", "1.4142135623730951"},
+	{"4 ** 0.5", "2.0"},
+	{"2 ** 10000000", "ERROR: 1:1: integer too large: exponent 10000000"},
+	{"(-1) ** 123456789012345678901", "-1"},
+	{"1 ** 123456789012345678901", "1"},
+	{"(2 ** 64) % 10", "6"},
+	{"(2 ** 64) & 255", "0"},
+	{"(2 ** 64) | 1", "18446744073709551617"},
+	{"(2 ** 64) ^ (2 ** 64)", "0"},
+	{"(2 ** 64) >> 60", "16"},
+	{"(2 ** 64) % 0", "ERROR: 1:2: division by zero"},
+	{"1.5 & 1", "ERROR: 1:1: unknown operator: FLOAT & INTEGER"},
+	{`"a" % 2`, "ERROR: 1:1: unknown operator: STRING % INTEGER"},
+	{"true ^ false", "ERROR: 1:1: unknown operator: BOOLEAN ^ BOOLEAN"},
+	{"let x = 10; x % 2 == 0 && x & 1 == 0", "true"},
+	{"0xFF & 0b1010", "10"},
+	{"0o777 | 0x1000", "4607"},
+	{"1_000_000 / 1_000", "1000"},
+	{"0xFFFF_FFFF_FFFF_FFFF + 1", "18446744073709551616"},
+}
+
+// 运行时错误
+var RuntimeErrors = []Case{
+	{"1 / 0", "ERROR: 1:1: division by zero"},
+	{"let a = 0; 10 / a", "ERROR: 1:12: division by zero"},
+	{"9223372036854775808 / 0", "ERROR: 1:1: division by zero"},
+	{"1.0 / 0", "+Inf"},
+	{"let f = fn(a, b) { a + b }; f(1)", "ERROR: 1:29: wrong number of arguments: want=2, got=1"},
+	{"fn() { 1 }(1, 2)", "ERROR: 1:1: wrong number of arguments: want=0, got=2"},
+	{"+true", "ERROR: 1:1: unknown operator: +BOOLEAN"},
+	{`-"a"`, "ERROR: 1:1: unknown operator: -STRING"},
+	{"-[1]", "ERROR: 1:1: unknown operator: -ARRAY"},
+	{"try { 1 / 0 } catch (e) { e[\"message\"] }", "division by zero"},
+}
+
+// 运算不会修改操作数
+var NoMutation = []Case{
+	{"let a = 5; -a; a", "5"},
+	{"let a = 5000; let b = -a; [a, b]", "[5000, -5000]"},
+	{"let a = -9223372036854775807 - 1; -a; a", "-9223372036854775808"},
+	{"let a = 5; let h = hash{a: 1}; -a; h[a]", "1"},
+	{"let f = fn(x) { -x }; let a = 7; f(a); f(a); a", "7"},
+	{"let a = 1; let b = a; let c = -b; [a, b, c]", "[1, 1, -1]"},
+	{`let s = "ab"; let t = s + "c"; [s, t, len(s)]`, "[ab, abc, 2]"},
+	{"let xs = [1, 2]; push(xs, 3); rest(xs); xs", "[1, 2]"},
+}
+
+// try/catch/finally 和 throw
+var TryCatch = []Case{
+	{`try { 1 } catch (e) { 2 }`, "1"},
+	{`try { throw "boom"; 1 } catch (e) { e["message"] }`, "boom"},
+	{`try { throw 5 } catch (e) { e["value"] + 1 }`, "6"},
+	{`try { throw "boom" } catch (e) { e["type"] }`, "Error"},
+	{`try { 5 + true } catch (e) { e["type"] + ": " + e["message"] }`, "TypeError: type mismatch: INTEGER + BOOLEAN"},
+	{`try { foobar } catch (e) { e["type"] }`, "NameError"},
+	{`try { len(1, 2) } catch (e) { e["type"] }`, "ArgumentError"},
+	{`try { 1 / 0 } catch (e) { e["type"] + ": " + e["message"] }`, "ArgumentError: division by zero"},
+	{`try { 7 % 0 } catch (e) { e["type"] }`, "ArgumentError"},
+	{`try { (2 ** 64) / 0 } catch (e) { e["type"] }`, "ArgumentError"},
+	{`try { 1 << -1 } catch (e) { e["type"] }`, "ArgumentError"},
+	{"try { range(1, 2, 0) } catch (e) { e[\"type\"] + \": \" + e[\"message\"] }", "ArgumentError: `range` step must not be zero"},
+	{`try { throw hash{"type": "IOError", "message": "disk full"} } catch (e) { e["type"] + ": " + e["message"] }`, "IOError: disk full"},
+	// 再次 throw 保留类型和消息
+	{`try { try { foobar } catch (e) { throw e } } catch (e) { e["type"] + ": " + e["message"] }`, "NameError: identifier not found: foobar"},
+	{`try { throw "boom" } catch { 7 }`, "7"},
+	{`let f = fn() { throw "inner" }; try { f() } catch (e) { e["message"] }`, "inner"},
+	// finally
+	{`let a = 1; try { a = 2 } finally { a = a * 10 }; a`, "20"},
+	{`let a = 1; try { throw "x" } catch (e) { a = 2 } finally { a = a + 1 }; a`, "3"},
+	{`let f = fn() { try { return 1 } finally { 2 } }; f()`, "1"},
+	{`let f = fn() { try { return 1 } finally { return 2 } }; f()`, "2"},
+	{`try { 1 } finally { throw "fin" }`, "ERROR: 1:21: fin"},
+	{`try { throw "boom" } finally { 1 }`, "ERROR: 1:7: boom"},
+	{`throw "boom"`, "ERROR: 1:1: boom"},
+	{`try { throw "a" } catch (e) { throw "b" }`, "ERROR: 1:31: b"},
+	{`let e = 1; try { throw "x" } catch (e) { e }; e`, "1"},
+	{`if (missing) { 1 } else { 2 }`, "ERROR: 1:5: identifier not found: missing"},
+}
+
+// while 和 for 循环
+var Loops = []Case{
+	{"let n = 0; while (n < 10) { n = n + 1 }; n", "10"},
+	{"let n = 0; while (false) { n = 1 }; n", "0"},
+	{"let s = 0; for (let i = 0; i < 5; i = i + 1) { s = s + i }; s", "10"},
+	{"for (let i = 0; i < 5; i = i + 1) { }; i", "ERROR: 1:40: identifier not found: i"},
+	{"let i = 0; for (; i < 5;) { i = i + 2 }; i", "6"},
+	{"let i = 0; for (;;) { i = i + 1; if (i == 3) { break } }; i", "3"},
+	{"let s = 0; for (let i = 0; i < 10; i = i + 1) { if (i == 5) { continue }; if (i == 8) { break }; s = s + i }; s", "23"},
+	{"let s = 0; let i = 0; while (i < 10) { i = i + 1; if (i > 3) { continue; } s = s + i }; s", "6"},
+	// 嵌套循环中 break 只跳出最内层
+	{"let c = 0; for (let i = 0; i < 3; i = i + 1) { for (let j = 0; j < 3; j = j + 1) { if (j == 1) { break } c = c + 1 } }; c", "3"},
+	// return 跳出循环和函数
+	{"let f = fn() { let i = 0; while (true) { i = i + 1; if (i == 4) { return i } } }; f()", "4"},
+	{"let f = fn(arr) { let s = 0; for (let i = 0; i < len(arr); i = i + 1) { s = s + arr[i] }; s }; f([1, 2, 3])", "6"},
+	{"while (x) { 1 }", "ERROR: 1:8: identifier not found: x"},
+	{"let i = 0; try { while (true) { i = i + 1; if (i == 2) { throw \"stop\" } } } catch (e) { i }", "2"},
+	{"let i = 0; while (i < 3) { try { i = i + 1; continue } finally { i = i + 10 } }; i", "11"},
+	{"let n = 0; while (n < 100000) { n = n + 1 }; n", "100000"},
+}
+
+// 表达式中的 break/continue/return 不能被当成值绑定或者参与运算
+var AbruptCompletions = []Case{
+	{"let x = 1; while (true) { let y = if (x > 3) { break } else { x }; x = x + 1 }; x", "4"},
+	{"let x = 0; let s = 0; while (x < 5) { x = x + 1; let y = if (x == 2) { continue } else { x }; s = s + y }; s", "13"},
+	{"let x = 0; while (true) { x = if (x == 3) { break } else { x + 1 } }; x", "3"},
+	{"let x = 0; while (true) { x = x + 1; x + if (x == 2) { break } else { 0 } }; x", "2"},
+	{"let x = 0; while (true) { x = x + 1; -if (x == 2) { break } else { 0 } }; x", "2"},
+	{"let x = 0; while (true) { x = x + 1; [1, if (x == 2) { break } else { 0 }] }; x", "2"},
+	{"let x = 0; while (true) { x = x + 1; hash{\"k\": if (x == 2) { break } else { 0 }} }; x", "2"},
+	{"let x = 0; while (true) { x = x + 1; len(if (x == 2) { break } else { \"a\" }) }; x", "2"},
+	{"let x = 0; while (true) { x = x + 1; [1][if (x == 2) { break } else { 0 }] }; x", "2"},
+	{"let x = 0; while (true) { x = x + 1; \"${if (x == 2) { break } else { 0 }}\" }; x", "2"},
+	{"let x = 0; while (true) { x = x + 1; true && if (x == 2) { break } else { true } }; x", "2"},
+	{"let x = 0; while (true) { x = x + 1; try { 1 } finally { if (x == 2) { break } } }; x", "2"},
+	{"let f = fn() { let x = if (true) { return 5 } else { 0 }; 10 }; f()", "5"},
+	{"let f = fn() { [1, if (true) { return 5 } else { 0 }]; 10 }; f()", "5"},
+}
+
+// for-in 和迭代协议
+var ForIn = []Case{
+	{"let s = 0; for (x in [1, 2, 3]) { s = s + x }; s", "6"},
+	{"let s = 0; for (i, x in [10, 20, 30]) { s = s + i * x }; s", "80"},
+	{"let s = \"\"; for (c in \"abc\") { s = c + s }; s", "cba"},
+	{"let s = \"\"; for (i, c in \"ab\") { s = s + c + c }; s", "aabb"},
+	// hash 按键的顺序遍历, 一个变量时绑定键
+	{"let s = \"\"; for (k in hash{\"b\": 2, \"a\": 1, \"c\": 3}) { s = s + k }; s", "abc"},
+	{"let s = 0; for (k, v in hash{3: 30, 1: 10, 2: 20}) { s = s * 10 + k + v }; s", "1353"},
+	{"let s = 0; for (i in range(5)) { s = s + i }; s", "10"},
+	{"let s = 0; for (i in range(2, 5)) { s = s + i }; s", "9"},
+	{"let a = []; for (i in range(10, 0, -3)) { a = push(a, i) }; a", "[10, 7, 4, 1]"},
+	{"let n = 0; for (i in range(5, 0)) { n = n + 1 }; n", "0"},
+	{"let n = 0; for (i in range(9223372036854775806, 9223372036854775807, 2)) { n = n + 1 }; n", "1"},
+	{"range(1, 2, 0)", "ERROR: 1:1: `range` step must not be zero"},
+	{"range(\"a\")", "ERROR: 1:1: argument to `range` must be INTEGER, got STRING"},
+	{"let s = 0; for (i in range(100)) { if (i == 3) { continue }; if (i == 5) { break }; s = s + i }; s", "7"},
+	{"let f = fn(arr) { for (x in arr) { if (x > 1) { return x } } }; f([1, 5, 9])", "5"},
+	// 每次迭代的变量是独立的, 闭包捕获的是当次的值
+	{"let fs = []; for (i in range(3)) { fs = push(fs, fn() { i }) }; fs[0]() + fs[2]()", "2"},
+	{"let fs = []; let i = 0; while (i < 3) { let j = i; fs = push(fs, fn() { j }); i = i + 1 }; fs[0]() + fs[2]()", "2"},
+	{"let f = fn() { let fs = []; for (x in [1, 2]) { for (y in [10, 20]) { fs = push(fs, fn() { x * y }) } }; fs }; let fs = f(); [fs[0](), fs[3]()]", "[10, 40]"},
+	// 同一次迭代中创建的闭包共享变量
+	{"let fs = []; for (i in range(2)) { let n = 0; fs = push(fs, [fn() { n = n + 1 }, fn() { n }]) }; fs[0][0](); fs[0][0](); [fs[0][1](), fs[1][1]()]", "[2, 0]"},
+	// for 的 init 中定义的变量所有迭代共用
+	{"let fs = []; for (let i = 0; i < 3; i = i + 1) { fs = push(fs, fn() { i }) }; fs[0]()", "3"},
+	{"let fs = []; for (i in range(2)) { try { for (j in range(2)) { throw j } } catch (e) { fs = push(fs, fn() { i + e[\"value\"] }) } }; [fs[0](), fs[1]()]", "[0, 1]"},
+	{"let f = fn() { let g = 0; for (x in [1, 2, 3]) { try { g = fn() { x }; if (x == 2) { break } } finally { } }; g() }; f()", "2"},
+	{"for (x in [1]) { }; x", "ERROR: 1:21: identifier not found: x"},
+	{"for (x in 5) { }", "ERROR: 1:1: object is not iterable: INTEGER"},
+	{"for (x in y) { }", "ERROR: 1:11: identifier not found: y"},
+}
+
+// 默认值, 剩余参数和展开
+var FunctionParameters = []Case{
+	// 默认值
+	{"let f = fn(a, b = 10) { a + b }; [f(1), f(1, 2)]", "[11, 3]"},
+	{"let f = fn(a, b = a * 2) { b }; f(3)", "6"},
+	{"let n = 1; let f = fn(a = n) { a }; n = 5; f()", "5"}, // 调用时求值
+	{"let f = fn(xs = []) { push(xs, 1) }; f(); f()", "[1]"},
+	{"let f = fn(a = b) { a }; let g = fn(b) { f() }; g(1)", "ERROR: 1:16: identifier not found: b"},
+	{"let f = fn(a = 1, b = 2) { [a, b] }; f(5)", "[5, 2]"},
+	// 剩余参数
+	{"let f = fn(a, ...rest) { [a, rest] }; f(1, 2, 3)", "[1, [2, 3]]"},
+	{"let f = fn(a, ...rest) { rest }; f(1)", "[]"},
+	{"let f = fn(...xs) { len(xs) }; f()", "0"},
+	{"let f = fn(a, b = 2, ...rest) { [a, b, rest] }; [f(1), f(1, 3, 4, 5)]", "[[1, 2, []], [1, 3, [4, 5]]]"},
+	// 展开
+	{"let add = fn(a, b, c) { a + b + c }; let xs = [1, 2, 3]; add(...xs)", "6"},
+	{"let add = fn(a, b, c) { a + b + c }; add(1, ...[2], 3)", "6"},
+	{"let f = fn(...xs) { xs }; f(...range(0, 3), ...\"ab\")", "[0, 1, 2, a, b]"},
+	{"[0, ...[1, 2], ...[], 3]", "[0, 1, 2, 3]"},
+	{`[...hash{"a": 1, "b": 2}]`, "[a, b]"},
+	{"len(...[[1, 2]])", "2"},
+	{"let xs = [1, 2]; let ys = [...xs]; push(ys, 3); xs", "[1, 2]"},
+	// 错误
+	{"let f = fn(a, b = 1) { a }; f()", "ERROR: 1:29: wrong number of arguments: want=1..2, got=0"},
+	{"let f = fn(a, b = 1) { a }; f(1, 2, 3)", "ERROR: 1:29: wrong number of arguments: want=1..2, got=3"},
+	{"let f = fn(a, ...rest) { a }; f()", "ERROR: 1:31: wrong number of arguments: want>=1, got=0"},
+	{"let f = fn(a) { a }; f(...[1, 2])", "ERROR: 1:22: wrong number of arguments: want=1, got=2"},
+	{"let f = fn(a) { a }; f(...5)", "ERROR: 1:24: cannot spread non-iterable value: INTEGER"},
+	{"[1, ...x]", "ERROR: 1:8: identifier not found: x"},
+	{"let f = fn(a = 1 / 0) { a }; f()", "ERROR: 1:16: division by zero"},
+}
+
+// 命名参数
+var NamedArguments = []Case{
+	{"let f = fn(a, b) { [a, b] }; f(b: 2, a: 1)", "[1, 2]"},
+	{"let f = fn(a, b) { [a, b] }; f(1, b: 2)", "[1, 2]"},
+	{"let f = fn(url, timeout = 10, retries = 1) { [url, timeout, retries] }; f(\"x\", retries: 3)", "[x, 10, 3]"},
+	{"let f = fn(a, b = a + 1) { b }; f(a: 5)", "6"},
+	{"let f = fn(a, ...rest) { [a, rest] }; f(1, 2, 3, a: 0)", "ERROR: 1:39: argument a given by position and by name"},
+	{"let f = fn(a, ...rest) { [a, rest] }; f(a: 0)", "[0, []]"},
+	{"let n = 0; let f = fn(a) { a }; f(a: n = n + 1); n", "1"},
+	{"let f = fn(a, b) { a }; f(1, c: 2)", "ERROR: 1:25: unexpected named argument: c"},
+	{"let f = fn(a, b) { a }; f(1, a: 2)", "ERROR: 1:25: argument a given by position and by name"},
+	{"let f = fn(a, b) { a }; f(b: 2)", "ERROR: 1:25: missing argument: a"},
+	{"let f = fn(a) { a }; f(1, 2, a: 3)", "ERROR: 1:22: wrong number of arguments: want=1, got=2"},
+	{"let f = fn(a, ...rest) { a }; f(rest: [1])", "ERROR: 1:31: unexpected named argument: rest"},
+	{"let f = fn(a) { a }; f(a: x)", "ERROR: 1:27: identifier not found: x"},
+	{"len(\"ab\", x: 1)", "ERROR: 1:1: builtin function does not accept named arguments"},
+}
+
+// 解构
+var Destructuring = []Case{
+	{"let [a, b] = [1, 2]; a + b", "3"},
+	{"let [a, ...rest] = [1, 2, 3]; [a, rest]", "[1, [2, 3]]"},
+	{"let [a, ...rest] = [1]; rest", "[]"},
+	{"let [] = []; 1", "1"},
+	{"let [a, [b, c]] = [1, [2, 3]]; [c, b, a]", "[3, 2, 1]"},
+	{`let hash{"name": n, "age": a} = hash{"name": "xiqi", "age": 18, "x": 0}; [n, a]`, "[xiqi, 18]"},
+	{`let hash{"tags": [first, ...others]} = hash{"tags": [1, 2, 3]}; [first, others]`, "[1, [2, 3]]"},
+	{`let k = "b"; let hash{k: v, 1: w, true: x} = hash{"b": 2, 1: 3, true: 4}; [v, w, x]`, "[2, 3, 4]"},
+	{`let hash{"k": k, k: v} = hash{"k": "x", "x": 5}; v`, "5"}, // key 可以引用前面绑定的变量
+	{"let xs = [1, 2]; let [...ys] = xs; push(ys, 3); xs", "[1, 2]"},
+	{"let a = 1; { let [a] = [2]; a } + a", "3"},
+	// 函数参数
+	{"let f = fn([a, b], c) { a + b + c }; f([1, 2], 3)", "6"},
+	{`let name = fn(hash{"name": n}) { n }; name(hash{"name": "xiqi"})`, "xiqi"},
+	{"let f = fn([a, b] = [1, 2]) { a * b }; [f(), f([3, 4])]", "[2, 12]"},
+	{"let f = fn([a, b], ...rest) { [a, b, rest] }; f([1, 2], 3)", "[1, 2, [3]]"},
+	{"let f = fn(x, [a]) { a }; f(1)", "ERROR: 1:27: wrong number of arguments: want=2, got=1"},
+	{"let f = fn(x, [a]) { a }; f(x: 1)", "ERROR: 1:27: missing argument: [a]"},
+	// 结构不匹配
+	{"let [a, b] = [1]; a", "ERROR: 1:5: array destructuring: want 2 elements, got 1"},
+	{"let [a, b] = [1, 2, 3]; a", "ERROR: 1:5: array destructuring: want 2 elements, got 3"},
+	{"let [a, b, ...c] = [1]; a", "ERROR: 1:5: array destructuring: want at least 2 elements, got 1"},
+	{"let [a, [b]] = [1, 2]; a", "ERROR: 1:9: cannot destructure INTEGER as array"},
+	{"let [a] = \"a\"; a", "ERROR: 1:5: cannot destructure STRING as array"},
+	{`let hash{"a": a} = [1]; a`, "ERROR: 1:5: cannot destructure ARRAY as hash"},
+	{`let hash{"a": a, "b": b} = hash{"a": 1}; a`, `ERROR: 1:18: hash destructuring: missing key "b"`},
+	{`let hash{2: a} = hash{1: 1}; a`, "ERROR: 1:10: hash destructuring: missing key 2"},
+	{`let hash{[1]: a} = hash{}; a`, "ERROR: 1:10: unusable as hash key: ARRAY"},
+	{`let hash{x: a} = hash{}; a`, "ERROR: 1:10: identifier not found: x"},
+	{"let f = fn([a, b]) { a }; f([1])", "ERROR: 1:12: array destructuring: want 2 elements, got 1"},
+	{"try { let [a] = 1 } catch (e) { e[\"type\"] }", "TypeError"},
+}
@@ -1,125 +1,284 @@
 package evaluator
 
 import (
+	"context"
 	"fmt"
 	"github.com/qiuhoude/go-interpreter/ast"
 	"github.com/qiuhoude/go-interpreter/object"
 	"github.com/qiuhoude/go-interpreter/token"
+	"math"
+	"math/big"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 var (
 	NULL  = &object.Null{}
 	TRUE  = &object.Boolean{Value: true}
 	FALSE = &object.Boolean{Value: false}
+
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
+// 求值器, 每个实例有自己的内建函数表和执行限制.
+// 执行过程中会记录状态, 同一个实例不能并发使用
+type Evaluator struct {
+	builtins map[string]object.Object
+	limits   Limits
+	state    runState
+}
+
+func New(builtins map[string]object.Object) *Evaluator {
+	return &Evaluator{builtins: builtins}
+}
+
+// 使用默认内建函数表求值
 func Eval(node ast.Node, env object.Environment) object.Object {
-	return doEval(node, env)
+	return New(builtins).Eval(node, env)
+}
+
+func (e *Evaluator) Eval(node ast.Node, env object.Environment) object.Object {
+	return e.EvalContext(context.Background(), node, env)
+}
+
+// ctx 取消或超时后停止求值, 返回对应 Kind 的错误
+func (e *Evaluator) EvalContext(ctx context.Context, node ast.Node, env object.Environment) (result object.Object) {
+	defer e.begin(ctx)()
+	defer recoverInternalError(&result)
+	if errObj := e.checkContext(); errObj != nil {
+		return errObj
+	}
+	return e.doEval(node, env)
+}
+
+// 求值过程中没有预料到的 panic(包括宿主函数中的 panic) 转换成 InternalError,
+// 避免宿主程序崩溃
+func recoverInternalError(result *object.Object) {
+	if r := recover(); r != nil {
+		*result = &object.Error{
+			Message: fmt.Sprintf("internal error: %v", r),
+			Kind:    object.InternalError,
+			GoStack: string(debug.Stack()),
+		}
+	}
+}
+
+// 以下导出的方法供 vm 复用, 保证两种后端的运算语义一致
+
+// EvalInfix 中缀运算, eg: 1 + 2, "a" + "b"
+func EvalInfix(operator string, left, right object.Object) object.Object {
+	return evalInfixExpression(operator, left, right)
+}
+
+// EvalPrefix 前缀运算, eg: !true, -1
+func EvalPrefix(operator string, right object.Object) object.Object {
+	return evalPrefixExpression(operator, right)
+}
+
+// EvalIndex 下标运算, eg: arr[1], h["key"]
+func EvalIndex(left, index object.Object) object.Object {
+	return evalIndexExpression(left, index)
+}
+
+func IsTruthy(obj object.Object) bool {
+	return isTruthy(obj)
+}
+
+func NewError(format string, a ...interface{}) *object.Error {
+	return newError(format, a...)
+}
+
+// 带类型的错误, 脚本中可以根据 e["type"] 区分
+func NewTypedError(class, format string, a ...interface{}) *object.Error {
+	return newTypedError(class, format, a...)
+}
+
+// throw 的值转换成错误
+func NewThrownError(val object.Object) *object.Error {
+	return newThrownError(val)
+}
+
+// catch 绑定到变量上的值
+func ErrorToHash(errObj *object.Error) *object.Hash {
+	return errorToHash(errObj)
+}
+
+func IsCatchable(errObj *object.Error) bool {
+	return isCatchable(errObj)
+}
+
+func (e *Evaluator) doEval(node ast.Node, env object.Environment) object.Object {
+	if node == nil { // 有语法错误的 AST 中会缺少节点, 错误的位置由外层节点设置
+		return newError("missing expression")
+	}
+	var obj object.Object
+	if errObj := e.step(); errObj != nil {
+		obj = errObj
+	} else {
+		obj = e.evalNode(node, env)
+	}
+	// 错误向上传递时, 最内层的节点就是出错的位置
+	if errObj, ok := obj.(*object.Error); ok && !errObj.Pos.IsValid() {
+		errObj.Pos = node.Pos()
+	}
+	return obj
 }
 
-func doEval(node ast.Node, env object.Environment) object.Object {
+func (e *Evaluator) evalNode(node ast.Node, env object.Environment) object.Object {
 	switch node := node.(type) {
 	// statements
 	case *ast.Program: //AST root node
-		return evalStatements(node.Statements, env)
+		return e.evalStatements(node.Statements, env)
 	case *ast.ExpressionStatement:
-		return doEval(node.Expression, env)
+		return e.doEval(node.Expression, env)
 	case *ast.BlockStatement: // {}
-		return evalBlockStatements(node.Statements, object.WithLocalEnv(env)) // 创建本地的env 避免污染全局
+		return e.evalBlockStatements(node.Statements, object.WithLocalEnv(env)) // 创建本地的env 避免污染全局
 	case *ast.ReturnStatement:
-		val := doEval(node.Value, env)
-		if isError(val) {
+		val := e.doEval(node.Value, env)
+		if isAbrupt(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
+	case *ast.ThrowStatement:
+		val := e.doEval(node.Value, env)
+		if isAbrupt(val) {
+			return val
+		}
+		return newThrownError(val)
+	case *ast.WhileStatement:
+		return e.evalWhileStatement(node, env)
+	case *ast.ForStatement:
+		return e.evalForStatement(node, env)
+	case *ast.ForInStatement:
+		return e.evalForInStatement(node, env)
+	case *ast.BreakStatement:
+		return BREAK
+	case *ast.ContinueStatement:
+		return CONTINUE
 	case *ast.LetStatement: // let 语句, 将identifier的值绑定到 environment 中
-		val := doEval(node.Value, env)
-		if isError(val) {
+		val := e.doEval(node.Value, env)
+		if isAbrupt(val) {
 			return val
 		}
+		if node.Pattern != nil {
+			if errObj := e.bindPattern(node.Pattern, val, env); errObj != nil {
+				return errObj
+			}
+			break
+		}
+		if fn, ok := val.(*object.Function); ok && fn.Name == "" {
+			fn.Name = node.Name.Value
+		}
 		env.SetLocal(node.Name.Value, val)
 
 		// expressions
 	case *ast.AssignExpression:
-		val := doEval(node.Value, env)
-		if isError(val) {
+		val := e.doEval(node.Value, env)
+		if isAbrupt(val) {
 			return val
 		}
 		env.Set(node.Name.Value, val)
+		return val // 和 vm 一致, 赋值表达式的值是赋给变量的值
 	case *ast.IntegerLiteral:
-		return &object.Integer{Value: node.Value}
+		if node.Big != nil {
+			return &object.BigInt{Value: node.Big}
+		}
+		return object.NewInteger(node.Value)
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(node.Value)
 	case *ast.PrefixExpression:
-		right := doEval(node.Right, env)
-		if isError(right) {
+		right := e.doEval(node.Right, env)
+		if isAbrupt(right) {
 			return right
 		}
 		return evalPrefixExpression(node.Operator, right)
 	case *ast.InfixExpression:
-		left := doEval(node.Left, env)
-		if isError(left) {
+		if node.Operator == "&&" || node.Operator == "||" {
+			return e.evalLogicalExpression(node, env)
+		}
+		left := e.doEval(node.Left, env)
+		if isAbrupt(left) {
 			return left
 		}
-		right := doEval(node.Right, env)
-		if isError(right) {
+		right := e.doEval(node.Right, env)
+		if isAbrupt(right) {
 			return right
 		}
-		return evalInfixExpression(node.Operator, left, right)
+		result := evalInfixExpression(node.Operator, left, right)
+		if errObj := e.alloc(result); errObj != nil { // 字符串拼接
+			return errObj
+		}
+		return result
 	case *ast.IfExpression:
-		return evalIfExpression(node, env)
+		return e.evalIfExpression(node, env)
+	case *ast.TryExpression:
+		return e.evalTryExpression(node, env)
 	case *ast.Identifier:
-		return evalIdentifier(node, env)
+		return e.evalIdentifier(node, env)
 	case *ast.BlockExpression:
-		return doEval(node.Body, env)
+		return e.doEval(node.Body, env)
 	case *ast.FunctionLiteral:
 		return &object.Function{
 			Parameters: node.Parameters,
+			Patterns:   node.Patterns,
+			Defaults:   node.Defaults,
+			Rest:       node.Rest,
 			Body:       node.Body,
 			Env:        env,
 		}
 	case *ast.CallExpression:
-		return evalCallExpression(node, env)
+		return e.evalCallExpression(node, env)
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
+	case *ast.InterpolatedString:
+		return e.evalInterpolatedString(node, env)
 	case *ast.ArrayLiteral: // 解析数组
-		return evalArrayLiteral(node, env)
+		return e.evalArrayLiteral(node, env)
 	case *ast.IndexExpression:
-		left := doEval(node.Left, env)
-		if isError(left) {
+		left := e.doEval(node.Left, env)
+		if isAbrupt(left) {
 			return left
 		}
 		// 下标部分
-		index := doEval(node.Index, env)
-		if isError(index) {
+		index := e.doEval(node.Index, env)
+		if isAbrupt(index) {
 			return index
 		}
 		return evalIndexExpression(left, index)
 	case *ast.HashLiteral:
-		return evalHashLiteral(node, env)
+		return e.evalHashLiteral(node, env)
 	}
 	return nil
 }
 
-func evalHashLiteral(node *ast.HashLiteral, env object.Environment) object.Object {
+func (e *Evaluator) evalHashLiteral(node *ast.HashLiteral, env object.Environment) object.Object {
 	pairs := make(map[object.HashKey]object.HashPair)
 	for keyNode, valueNode := range node.Pairs {
-		key := Eval(keyNode, env)
-		if isError(key) {
+		key := e.doEval(keyNode, env)
+		if isAbrupt(key) {
 			return key
 		}
 		hashKey, ok := key.(object.Hashable)
 		if !ok {
-			return newError("unusable as hash key: %s", key.Type())
+			return newTypedError(object.TypeErrorClass, "unusable as hash key: %s", key.Type())
 		}
-		value := doEval(valueNode, env)
-		if isError(value) {
+		value := e.doEval(valueNode, env)
+		if isAbrupt(value) {
 			return value
 		}
 		hashed := hashKey.HashKey()
 		pairs[hashed] = object.HashPair{Key: key, Value: value}
 	}
-	return &object.Hash{Pairs: pairs}
+	hash := &object.Hash{Pairs: pairs}
+	if errObj := e.alloc(hash); errObj != nil {
+		return errObj
+	}
+	return hash
 }
 
 func evalIndexExpression(left, index object.Object) object.Object {
@@ -128,15 +287,17 @@ func evalIndexExpression(left, index object.Object) object.Object {
 		return evalArrayIndexExpression(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalStringIndexExpression(left, index)
 	default:
-		return newError("index operator not supported: %s", left.Type())
+		return newTypedError(object.TypeErrorClass, "index operator not supported: %s", left.Type())
 	}
 }
 func evalHashIndexExpression(hash, index object.Object) object.Object {
 	hashObject := hash.(*object.Hash)
 	key, ok := index.(object.Hashable)
 	if !ok {
-		return newError("unusable as hash key: %s", index.Type())
+		return newTypedError(object.TypeErrorClass, "unusable as hash key: %s", index.Type())
 	}
 	pair, ok := hashObject.Pairs[key.HashKey()]
 	if !ok {
@@ -145,6 +306,21 @@ func evalHashIndexExpression(hash, index object.Object) object.Object {
 	return pair.Value
 }
 
+// 按 rune 取下标, 越界时返回 null
+func evalStringIndexExpression(str, index object.Object) object.Object {
+	idx := index.(*object.Integer).Value
+	if idx < 0 {
+		return NULL
+	}
+	for _, r := range str.(*object.String).Value {
+		if idx == 0 {
+			return &object.String{Value: string(r)}
+		}
+		idx--
+	}
+	return NULL
+}
+
 func evalArrayIndexExpression(array, index object.Object) object.Object {
 	arrObj := array.(*object.Array)
 	idx := index.(*object.Integer).Value
@@ -155,45 +331,139 @@ func evalArrayIndexExpression(array, index object.Object) object.Object {
 	return arrObj.Elements[idx]
 }
 
-func evalArrayLiteral(node *ast.ArrayLiteral, env object.Environment) object.Object {
-	elements := evalExpressions(node.Elements, env)
-	if errObj, has := hasError(elements); has {
+func (e *Evaluator) evalArrayLiteral(node *ast.ArrayLiteral, env object.Environment) object.Object {
+	elements := e.evalExpressions(node.Elements, env)
+	if errObj, has := hasAbrupt(elements); has {
+		return errObj
+	}
+	// 展开的元素在 appendSpread 中已经计数, 这里只计算其余元素
+	n := 0
+	for _, el := range node.Elements {
+		if _, ok := el.(*ast.SpreadExpression); !ok {
+			n++
+		}
+	}
+	if errObj := e.allocN(int64(n)); errObj != nil {
 		return errObj
 	}
 	return &object.Array{Elements: elements}
 }
 
-func evalCallExpression(node *ast.CallExpression, env object.Environment) object.Object {
+func (e *Evaluator) evalCallExpression(node *ast.CallExpression, env object.Environment) object.Object {
 	var fnObj object.Object
 	//switch n := node.Function.(type) {
 	//case *ast.Identifier: // 之前使用let 声明的function. eg: add(1,2)
-	//	fnObj = evalIdentifier(n, env)
+	//	fnObj = e.evalIdentifier(n, env)
 	//case *ast.FunctionLiteral: // eg: fnObj(x,y){x+y}(1,2)
-	//	fnObj = doEval(node.Function, env)
+	//	fnObj = e.doEval(node.Function, env)
 	//}
 	// 合并程 doEval,因为doEval如时Identifier类型也会调用evalIdentifier()
-	fnObj = doEval(node.Function, env)
-	if isError(fnObj) {
+	fnObj = e.doEval(node.Function, env)
+	if isAbrupt(fnObj) {
 		return fnObj
 	}
 	// 评估参数
-	args := evalExpressions(node.Arguments, env)
-	if errObj, has := hasError(args); has { // 有错误就返回
+	args := e.evalExpressions(node.Arguments, env)
+	if errObj, has := hasAbrupt(args); has { // 有错误就返回
+		return errObj
+	}
+	var named map[string]object.Object
+	for _, arg := range node.Named {
+		val := e.doEval(arg.Value, env)
+		if isAbrupt(val) {
+			return val
+		}
+		if named == nil {
+			named = make(map[string]object.Object, len(node.Named))
+		}
+		named[arg.Name.Value] = val
+	}
+	result := e.applyFunction(fnObj, args, named)
+	if errObj, ok := result.(*object.Error); ok && isCallable(fnObj) {
+		// 错误离开函数时记录调用栈
+		if !errObj.Pos.IsValid() { // 内建函数返回的错误, 位置就是调用的位置
+			errObj.Pos = node.Pos()
+		}
+		errObj.Stack = append(errObj.Stack, object.StackFrame{
+			Function: functionName(fnObj, node.Function),
+			Pos:      node.Pos(),
+		})
+	}
+	return result
+}
+
+func copyError(errObj *object.Error) *object.Error {
+	cp := *errObj
+	cp.Stack = append([]object.StackFrame(nil), errObj.Stack...)
+	return &cp
+}
+
+func isCallable(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Function, *object.Builtin:
+		return true
+	}
+	return false
+}
+
+// 调用栈中显示的函数名
+func functionName(fnObj object.Object, callee ast.Expression) string {
+	if fn, ok := fnObj.(*object.Function); ok && fn.Name != "" {
+		return fn.Name
+	}
+	if ident, ok := callee.(*ast.Identifier); ok {
+		return ident.Value
+	}
+	return "<anonymous>"
+}
+
+// 在 Go 代码中调用脚本函数或内建函数
+func Call(fn object.Object, args ...object.Object) object.Object {
+	return New(builtins).Call(fn, args...)
+}
+
+func (e *Evaluator) Call(fn object.Object, args ...object.Object) object.Object {
+	return e.CallContext(context.Background(), fn, args...)
+}
+
+func (e *Evaluator) CallContext(ctx context.Context, fn object.Object, args ...object.Object) (result object.Object) {
+	defer e.begin(ctx)()
+	defer recoverInternalError(&result)
+	if errObj := e.checkContext(); errObj != nil {
 		return errObj
 	}
-	return applyFunction(fnObj, args)
+	return e.applyFunction(fn, args, nil)
 }
 
-func applyFunction(fnObj object.Object, args []object.Object) object.Object {
+func (e *Evaluator) applyFunction(fnObj object.Object, args []object.Object, named map[string]object.Object) object.Object {
 	switch fn := fnObj.(type) {
 	case *object.Function:
-		env := extendFunctionEnv(fn, args)
-		evaluated := doEval(fn.Body, env)   // eval 函数体求值
+		// 默认值在新的调用中求值, 可能递归调用, 所以先计入调用深度
+		if errObj := e.enterCall(); errObj != nil {
+			return errObj
+		}
+		defer e.leaveCall()
+		env, errObj := e.extendFunctionEnv(fn, args, named)
+		if errObj != nil {
+			return errObj
+		}
+		evaluated := e.doEval(fn.Body, env) // eval 函数体求值
 		return unwrapReturnValue(evaluated) // 如果有 return语句,进行解包后得到实际的obj值返回
 	case *object.Builtin:
-		return fn.Fn(args...)
+		result := fn.Call(args, named)
+		if result == nil { // 宿主提供的内建函数可能返回 nil
+			return NULL
+		}
+		if errObj, ok := result.(*object.Error); ok {
+			// 宿主返回的错误可能是共享的, 复制之后再记录位置和调用栈
+			return copyError(errObj)
+		}
+		if errObj := e.alloc(result); errObj != nil {
+			return errObj
+		}
+		return result
 	default:
-		return newError("not a function: %s", fnObj.Type())
+		return newTypedError(object.TypeErrorClass, "not a function: %s", fnObj.Type())
 	}
 }
 
@@ -204,20 +474,199 @@ func unwrapReturnValue(obj object.Object) object.Object {
 	return obj
 }
 
-func extendFunctionEnv(fn *object.Function, args []object.Object) object.Environment {
+func (e *Evaluator) extendFunctionEnv(fn *object.Function, args []object.Object,
+	named map[string]object.Object) (object.Environment, *object.Error) {
+	if len(named) == 0 {
+		if errObj := checkArity(fn, len(args)); errObj != nil {
+			return nil, errObj
+		}
+	} else if errObj := checkNamedArgs(fn, len(args), named); errObj != nil {
+		return nil, errObj
+	}
 	env := object.WithLocalEnv(fn.Env)
-	// 绑定参数值到本地env中
+	// 绑定参数值到本地env中, 先按位置再按名字, 缺少的参数使用默认值, 默认值可以引用前面的参数
 	for paramIdx, param := range fn.Parameters {
-		env.Set(param.Value, args[paramIdx])
+		var val object.Object
+		if paramIdx < len(args) {
+			val = args[paramIdx]
+		} else if v, ok := named[param.Value]; ok {
+			val = v
+		} else if paramIdx < len(fn.Defaults) && fn.Defaults[paramIdx] != nil {
+			val = e.doEval(fn.Defaults[paramIdx], env)
+			if errObj, ok := val.(*object.Error); ok {
+				return nil, errObj
+			}
+		} else {
+			return nil, newTypedError(object.ArgumentErrorClass, "missing argument: %s", param.Value)
+		}
+		if paramIdx < len(fn.Patterns) && fn.Patterns[paramIdx] != nil {
+			if errObj := e.bindPattern(fn.Patterns[paramIdx], val, env); errObj != nil {
+				return nil, errObj
+			}
+			continue
+		}
+		env.SetLocal(param.Value, val)
+	}
+	if fn.Rest != nil {
+		rest := &object.Array{}
+		if len(args) > len(fn.Parameters) {
+			rest.Elements = append(rest.Elements, args[len(fn.Parameters):]...)
+		}
+		if errObj := e.alloc(rest); errObj != nil {
+			return nil, errObj
+		}
+		env.SetLocal(fn.Rest.Value, rest)
+	}
+	return env, nil
+}
+
+// 按模式把 val 绑定到 env 中, 结构不匹配时返回 TypeError, 位置是不匹配的模式
+func (e *Evaluator) bindPattern(pat ast.Pattern, val object.Object, env object.Environment) *object.Error {
+	var errObj *object.Error
+	switch pat := pat.(type) {
+	case *ast.Identifier:
+		env.SetLocal(pat.Value, val)
+	case *ast.ArrayPattern:
+		errObj = e.bindArrayPattern(pat, val, env)
+	case *ast.HashPattern:
+		errObj = e.bindHashPattern(pat, val, env)
+	}
+	if errObj != nil && !errObj.Pos.IsValid() {
+		errObj.Pos = pat.Pos()
+	}
+	return errObj
+}
+
+func (e *Evaluator) bindArrayPattern(pat *ast.ArrayPattern, val object.Object, env object.Environment) *object.Error {
+	arr, ok := val.(*object.Array)
+	if !ok {
+		return newTypedError(object.TypeErrorClass, "cannot destructure %s as array", val.Type())
+	}
+	want, got := len(pat.Elements), len(arr.Elements)
+	if pat.Rest == nil && got != want {
+		return newTypedError(object.TypeErrorClass, "array destructuring: want %d elements, got %d", want, got)
 	}
-	return env
+	if got < want {
+		return newTypedError(object.TypeErrorClass, "array destructuring: want at least %d elements, got %d", want, got)
+	}
+	for i, el := range pat.Elements {
+		if errObj := e.bindPattern(el, arr.Elements[i], env); errObj != nil {
+			return errObj
+		}
+	}
+	if pat.Rest != nil {
+		rest := &object.Array{Elements: append([]object.Object{}, arr.Elements[want:]...)}
+		if errObj := e.alloc(rest); errObj != nil {
+			return errObj
+		}
+		env.SetLocal(pat.Rest.Value, rest)
+	}
+	return nil
 }
 
-func evalExpressions(exps []ast.Expression, env object.Environment) []object.Object {
+// 模式中的 key 在当前 env 中求值, 可以引用前面绑定的变量
+func (e *Evaluator) bindHashPattern(pat *ast.HashPattern, val object.Object, env object.Environment) *object.Error {
+	hash, ok := val.(*object.Hash)
+	if !ok {
+		return newTypedError(object.TypeErrorClass, "cannot destructure %s as hash", val.Type())
+	}
+	for i, keyNode := range pat.Keys {
+		key := e.doEval(keyNode, env)
+		if errObj, ok := key.(*object.Error); ok {
+			return errObj
+		}
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			errObj := newTypedError(object.TypeErrorClass, "unusable as hash key: %s", key.Type())
+			errObj.Pos = keyNode.Pos()
+			return errObj
+		}
+		pair, ok := hash.Pairs[hashKey.HashKey()]
+		if !ok {
+			name := key.Inspect()
+			if str, ok := key.(*object.String); ok {
+				name = strconv.Quote(str.Value)
+			}
+			errObj := newTypedError(object.TypeErrorClass, "hash destructuring: missing key %s", name)
+			errObj.Pos = keyNode.Pos()
+			return errObj
+		}
+		if errObj := e.bindPattern(pat.Values[i], pair.Value, env); errObj != nil {
+			return errObj
+		}
+	}
+	return nil
+}
+
+// 有默认值的参数可以省略, 有剩余参数时不限制参数的个数
+func checkArity(fn *object.Function, got int) *object.Error {
+	want := len(fn.Parameters)
+	required := want
+	for i := range fn.Defaults {
+		if fn.Defaults[i] != nil {
+			required = i
+			break
+		}
+	}
+	switch {
+	case fn.Rest != nil:
+		if got < required {
+			return newTypedError(object.ArgumentErrorClass, "wrong number of arguments: want>=%d, got=%d",
+				required, got)
+		}
+	case required < want:
+		if got < required || got > want {
+			return newTypedError(object.ArgumentErrorClass, "wrong number of arguments: want=%d..%d, got=%d",
+				required, want, got)
+		}
+	case got != want:
+		return newTypedError(object.ArgumentErrorClass, "wrong number of arguments: want=%d, got=%d",
+			want, got)
+	}
+	return nil
+}
+
+// 命名参数必须对应一个没有按位置传入的参数, 缺少的参数在绑定时检查
+func checkNamedArgs(fn *object.Function, got int, named map[string]object.Object) *object.Error {
+	if fn.Rest == nil && got > len(fn.Parameters) {
+		return checkArity(fn, got)
+	}
+	names := make([]string, 0, len(named))
+	for name := range named {
+		names = append(names, name)
+	}
+	sort.Strings(names) // 错误信息稳定
+	for _, name := range names {
+		idx := -1
+		for i, param := range fn.Parameters {
+			if param.Value == name {
+				idx = i
+				break
+			}
+		}
+		switch {
+		case idx < 0:
+			return newTypedError(object.ArgumentErrorClass, "unexpected named argument: %s", name)
+		case idx < got:
+			return newTypedError(object.ArgumentErrorClass, "argument %s given by position and by name", name)
+		}
+	}
+	return nil
+}
+
+// 调用参数和数组元素中的 ...expr 展开成多个值
+func (e *Evaluator) evalExpressions(exps []ast.Expression, env object.Environment) []object.Object {
 	var result []object.Object
-	for _, e := range exps {
-		evaluated := doEval(e, env)
-		if isError(evaluated) {
+	for _, exp := range exps {
+		if spread, ok := exp.(*ast.SpreadExpression); ok {
+			var errObj object.Object
+			if result, errObj = e.appendSpread(result, spread, env); errObj != nil {
+				return []object.Object{errObj}
+			}
+			continue
+		}
+		evaluated := e.doEval(exp, env)
+		if isAbrupt(evaluated) {
 			return []object.Object{evaluated}
 		}
 		result = append(result, evaluated)
@@ -226,19 +675,50 @@ func evalExpressions(exps []ast.Expression, env object.Environment) []object.Obj
 
 }
 
-func evalIdentifier(node *ast.Identifier, env object.Environment) object.Object {
+// 实现了 object.Iterable 的对象都可以展开, 与 for-in 一样 hash 展开的是 key
+func (e *Evaluator) appendSpread(dst []object.Object, node *ast.SpreadExpression, env object.Environment) ([]object.Object, object.Object) {
+	value := e.doEval(node.Value, env)
+	if isAbrupt(value) {
+		return nil, value
+	}
+	it, ok := value.(object.Iterable)
+	if !ok {
+		errObj := newTypedError(object.TypeErrorClass, "cannot spread non-iterable value: %s", value.Type())
+		errObj.Pos = node.Pos()
+		return nil, errObj
+	}
+	iter := it.Iter()
+	for {
+		key, val, ok := iter.Next()
+		if !ok {
+			return dst, nil
+		}
+		if errObj := e.step(); errObj != nil { // range 可能很大
+			return nil, errObj
+		}
+		if errObj := e.allocN(1); errObj != nil { // 边展开边计数, 不能等整个数组建好之后再检查
+			return nil, errObj
+		}
+		if value.Type() == object.HASH_OBJ {
+			val = key
+		}
+		dst = append(dst, val)
+	}
+}
+
+func (e *Evaluator) evalIdentifier(node *ast.Identifier, env object.Environment) object.Object {
 	if val, ok := env.Get(node.Value); ok {
 		return val
 	}
-	if builtin, ok := builtins[node.Value]; ok {
+	if builtin, ok := e.builtins[node.Value]; ok {
 		return builtin
 	}
-	return newError("identifier not found: " + node.Value)
+	return newTypedError(object.NameErrorClass, "identifier not found: %s", node.Value)
 }
 
-func hasError(objs []object.Object) (object.Object, bool) {
+func hasAbrupt(objs []object.Object) (object.Object, bool) {
 	for i := range objs {
-		if objs[i].Type() == object.ERROR_OBJ {
+		if isAbrupt(objs[i]) {
 			return objs[i], true
 		}
 	}
@@ -246,6 +726,18 @@ func hasError(objs []object.Object) (object.Object, bool) {
 
 }
 
+// 错误, return, break 和 continue 都会中断当前表达式的求值, 需要原样向外传递
+func isAbrupt(obj object.Object) bool {
+	if obj == nil {
+		return false
+	}
+	switch obj.Type() {
+	case object.ERROR_OBJ, object.RETURN_VALUE_OBJ, object.BREAK_OBJ, object.CONTINUE_OBJ:
+		return true
+	}
+	return false
+}
+
 func isError(obj object.Object) bool {
 	if obj != nil {
 		return obj.Type() == object.ERROR_OBJ
@@ -253,19 +745,186 @@ func isError(obj object.Object) bool {
 	return false
 }
 
-func evalIfExpression(ie *ast.IfExpression, env object.Environment) object.Object {
-	condition := doEval(ie.Condition, env)
+func (e *Evaluator) evalIfExpression(ie *ast.IfExpression, env object.Environment) object.Object {
+	condition := e.doEval(ie.Condition, env)
+	if isAbrupt(condition) {
+		return condition
+	}
 
 	switch {
 	case isTruthy(condition):
-		return doEval(ie.Consequence, env)
+		return e.doEval(ie.Consequence, env)
 	case ie.Alternative != nil:
-		return doEval(ie.Alternative, env)
+		return e.doEval(ie.Alternative, env)
 	default:
 		return NULL
 	}
 }
 
+func (e *Evaluator) evalWhileStatement(ws *ast.WhileStatement, env object.Environment) object.Object {
+	for {
+		condition := e.doEval(ws.Condition, env)
+		if isAbrupt(condition) {
+			return condition
+		}
+		if !isTruthy(condition) {
+			return NULL
+		}
+		if result, exit := e.evalLoopBody(ws.Body, env); exit {
+			return result
+		}
+	}
+}
+
+func (e *Evaluator) evalForStatement(fs *ast.ForStatement, env object.Environment) object.Object {
+	loopEnv := object.WithLocalEnv(env) // init 中定义的变量只在循环中可见
+	if fs.Init != nil {
+		if init := e.doEval(fs.Init, loopEnv); isAbrupt(init) {
+			return init
+		}
+	}
+	for {
+		if fs.Condition != nil {
+			condition := e.doEval(fs.Condition, loopEnv)
+			if isAbrupt(condition) {
+				return condition
+			}
+			if !isTruthy(condition) {
+				return NULL
+			}
+		}
+		if result, exit := e.evalLoopBody(fs.Body, loopEnv); exit {
+			return result
+		}
+		if fs.Post != nil {
+			if post := e.doEval(fs.Post, loopEnv); isAbrupt(post) {
+				return post
+			}
+		}
+	}
+}
+
+// 实现了 object.Iterable 的对象都可以遍历.
+// 两个变量时绑定 key 和 value, 一个变量时 hash 绑定 key, 其他绑定 value
+func (e *Evaluator) evalForInStatement(fs *ast.ForInStatement, env object.Environment) object.Object {
+	iterable := e.doEval(fs.Iterable, env)
+	if isAbrupt(iterable) {
+		return iterable
+	}
+	it, ok := iterable.(object.Iterable)
+	if !ok {
+		return newTypedError(object.TypeErrorClass, "object is not iterable: %s", iterable.Type())
+	}
+	iter := it.Iter()
+	for {
+		key, value, ok := iter.Next()
+		if !ok {
+			return NULL
+		}
+		loopEnv := object.WithLocalEnv(env) // 每次迭代重新绑定, 闭包捕获的是当次的值
+		switch {
+		case len(fs.Vars) == 2:
+			loopEnv.SetLocal(fs.Vars[0].Value, key)
+			loopEnv.SetLocal(fs.Vars[1].Value, value)
+		case iterable.Type() == object.HASH_OBJ:
+			loopEnv.SetLocal(fs.Vars[0].Value, key)
+		default:
+			loopEnv.SetLocal(fs.Vars[0].Value, value)
+		}
+		if result, exit := e.evalLoopBody(fs.Body, loopEnv); exit {
+			return result
+		}
+	}
+}
+
+// 执行一次循环体, exit 为 true 时循环结束并返回 result
+func (e *Evaluator) evalLoopBody(body *ast.BlockStatement, env object.Environment) (result object.Object, exit bool) {
+	result = e.doEval(body, env)
+	if result == nil {
+		return nil, false
+	}
+	switch result.Type() {
+	case object.BREAK_OBJ:
+		return NULL, true
+	case object.RETURN_VALUE_OBJ, object.ERROR_OBJ:
+		return result, true
+	}
+	return nil, false
+}
+
+func (e *Evaluator) evalTryExpression(te *ast.TryExpression, env object.Environment) object.Object {
+	result := e.doEval(te.Block, env)
+	if errObj, ok := result.(*object.Error); ok && te.Catch != nil && isCatchable(errObj) {
+		catchEnv := object.WithLocalEnv(env)
+		if te.Param != nil {
+			catchEnv.SetLocal(te.Param.Value, errorToHash(errObj))
+		}
+		result = e.evalBlockStatements(te.Catch.Statements, catchEnv)
+	}
+	if te.Finally != nil {
+		// finally 中的错误, return, break 和 continue 会覆盖 try/catch 的结果
+		finResult := e.doEval(te.Finally, env)
+		if finResult != nil && isAbrupt(finResult) {
+			return finResult
+		}
+	}
+	if result == nil {
+		return NULL
+	}
+	return result
+}
+
+// 超出执行限制的错误不能被脚本 catch, 否则脚本可以绕过限制
+func isCatchable(errObj *object.Error) bool {
+	return errObj.Kind == object.RuntimeError
+}
+
+// throw 的值转换成错误. 抛出带有 message 的 hash 时使用其中的 type 和 message,
+// 因此 catch 到的错误可以直接再次 throw
+func newThrownError(val object.Object) *object.Error {
+	errObj := &object.Error{Message: val.Inspect(), Value: val}
+	hash, ok := val.(*object.Hash)
+	if !ok {
+		return errObj
+	}
+	if msg, ok := hashGet(hash, "message").(*object.String); ok {
+		errObj.Message = msg.Value
+		if class, ok := hashGet(hash, "type").(*object.String); ok {
+			errObj.Class = class.Value
+		}
+		if value := hashGet(hash, "value"); value != nil {
+			errObj.Value = value
+		}
+	}
+	return errObj
+}
+
+// catch 到的错误以 hash{"type": ..., "message": ..., "value": ...} 的形式绑定到变量上
+func errorToHash(errObj *object.Error) *object.Hash {
+	value := errObj.Value
+	if value == nil {
+		value = NULL
+	}
+	hash := &object.Hash{Pairs: map[object.HashKey]object.HashPair{}}
+	hashSet(hash, "type", &object.String{Value: errObj.ClassName()})
+	hashSet(hash, "message", &object.String{Value: errObj.Message})
+	hashSet(hash, "value", value)
+	return hash
+}
+
+func hashGet(hash *object.Hash, key string) object.Object {
+	pair, ok := hash.Pairs[(&object.String{Value: key}).HashKey()]
+	if !ok {
+		return nil
+	}
+	return pair.Value
+}
+
+func hashSet(hash *object.Hash, key string, value object.Object) {
+	k := &object.String{Value: key}
+	hash.Pairs[k.HashKey()] = object.HashPair{Key: k, Value: value}
+}
+
 func isTruthy(obj object.Object) bool {
 	// “truthy” means: it’s not null and it’s not false
 	switch obj {
@@ -279,68 +938,200 @@ func evalInfixExpression(operator string, left object.Object, right object.Objec
 	switch {
 	case left.Type() == object.INTEGER_OBJ && right.Type() == left.Type(): // 左右都是integer数据类型直接进行运算
 		return evalIntegerInfixExpression(operator, left, right)
-	case left.Type() == object.BOOLEAN_OBJ && right.Type() == left.Type(): // 左右都是Boolean数据类型
-		return evalBooleanInfixExpression(operator, left, right)
+	case isInteger(left) && isInteger(right): // 有一边是 BigInt
+		return evalBigIntInfixExpression(operator, left, right)
+	case isNumber(left) && isNumber(right): // integer 和 float 混合运算时提升为 float
+		return evalFloatInfixExpression(operator, left, right)
+	case operator == "==": // 其他类型深度比较, 类型不同时不相等
+		return nativeBoolToBooleanObject(objectsEqual(left, right))
+	case operator == "!=":
+		return nativeBoolToBooleanObject(!objectsEqual(left, right))
 	case left.Type() == object.STRING_OBJ || right.Type() == object.STRING_OBJ: // 只要有一边是String类型
 		return evalStringInfixExpression(operator, left, right)
 	case right.Type() != left.Type(): // 左右两边类型不相等
-		return newError("type mismatch: %s %s %s",
+		return newTypedError(object.TypeErrorClass, "type mismatch: %s %s %s",
 			left.Type(), operator, right.Type())
+	case isOrderOperator(operator):
+		return evalOrderExpression(operator, left, right)
 
 	default:
-		return newError("unknown operator: %s %s %s",
+		return newTypedError(object.TypeErrorClass, "unknown operator: %s %s %s",
 			left.Type(), operator, right.Type())
 	}
 }
 
+// && 和 || 短路求值, 结果是 boolean
+func (e *Evaluator) evalLogicalExpression(node *ast.InfixExpression, env object.Environment) object.Object {
+	left := e.doEval(node.Left, env)
+	if isAbrupt(left) {
+		return left
+	}
+	if node.Operator == "&&" && !isTruthy(left) {
+		return FALSE
+	}
+	if node.Operator == "||" && isTruthy(left) {
+		return TRUE
+	}
+	right := e.doEval(node.Right, env)
+	if isAbrupt(right) {
+		return right
+	}
+	return nativeBoolToBooleanObject(isTruthy(right))
+}
+
+// 字符串拼接和插值时把对象转换成字符串: STRING 使用原本的内容, 其他类型使用 Inspect(),
+// 如 1.0 -> "1.0", null -> "null", [1, "a"] -> "[1, a]"
+func ToString(obj object.Object) string {
+	if str, ok := obj.(*object.String); ok {
+		return str.Value
+	}
+	return obj.Inspect()
+}
+
+func (e *Evaluator) evalInterpolatedString(node *ast.InterpolatedString, env object.Environment) object.Object {
+	var out strings.Builder
+	for _, part := range node.Parts {
+		val := e.doEval(part, env)
+		if isAbrupt(val) {
+			return val
+		}
+		out.WriteString(ToString(val))
+	}
+	result := &object.String{Value: out.String()}
+	if errObj := e.alloc(result); errObj != nil {
+		return errObj
+	}
+	return result
+}
+
 func evalStringInfixExpression(operator string, left object.Object, right object.Object) object.Object {
-	switch operator {
-	case "+":
-		return &object.String{Value: left.Inspect() + right.Inspect()}
+	switch {
+	case operator == "+":
+		return &object.String{Value: ToString(left) + ToString(right)}
+	case isOrderOperator(operator):
+		return evalOrderExpression(operator, left, right)
 	default:
-		return newError("unknown operator: %s %s %s",
+		return newTypedError(object.TypeErrorClass, "unknown operator: %s %s %s",
 			left.Type(), operator, right.Type())
 	}
 }
-func evalBooleanInfixExpression(operator string, left object.Object, right object.Object) object.Object {
-	leftVal := left.(*object.Boolean).Value
-	rightVal := right.(*object.Boolean).Value
-	switch operator {
-	case "!=":
-		return nativeBoolToBooleanObject(leftVal != rightVal)
+
+func evalIntegerInfixExpression(operator string, left object.Object, right object.Object) object.Object {
+	leftVal := left.(*object.Integer).Value
+	rightVal := right.(*object.Integer).Value
+	switch operator { // 溢出时提升为 BigInt
+	case "+":
+		if v, ok := AddInt(leftVal, rightVal); ok {
+			return object.NewInteger(v)
+		}
+		return evalBigIntInfixExpression(operator, left, right)
+	case "-":
+		if v, ok := SubInt(leftVal, rightVal); ok {
+			return object.NewInteger(v)
+		}
+		return evalBigIntInfixExpression(operator, left, right)
+	case "*":
+		if v, ok := MulInt(leftVal, rightVal); ok {
+			return object.NewInteger(v)
+		}
+		return evalBigIntInfixExpression(operator, left, right)
+	case "/":
+		if rightVal == 0 {
+			return newTypedError(object.ArgumentErrorClass, "division by zero")
+		}
+		if leftVal == math.MinInt64 && rightVal == -1 {
+			return evalBigIntInfixExpression(operator, left, right)
+		}
+		return object.NewInteger(leftVal / rightVal)
+	case "%":
+		if rightVal == 0 {
+			return newTypedError(object.ArgumentErrorClass, "division by zero")
+		}
+		return object.NewInteger(leftVal % rightVal)
+	case "&":
+		return object.NewInteger(leftVal & rightVal)
+	case "|":
+		return object.NewInteger(leftVal | rightVal)
+	case "^":
+		return object.NewInteger(leftVal ^ rightVal)
+	case "<<":
+		if rightVal >= 0 && rightVal < 64 && leftVal<<rightVal>>rightVal == leftVal {
+			return object.NewInteger(leftVal << rightVal)
+		}
+		return evalBigIntInfixExpression(operator, left, right)
+	case ">>":
+		if rightVal < 0 {
+			return newTypedError(object.ArgumentErrorClass, "negative shift count: %d", rightVal)
+		}
+		return object.NewInteger(leftVal >> rightVal)
+	case "**":
+		return powInt(leftVal, rightVal)
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
 	case "==":
 		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
 	default:
-		return newError("unknown operator: %s %s %s",
+		return newTypedError(object.TypeErrorClass, "unknown operator: %s %s %s",
 			left.Type(), operator, right.Type())
+
 	}
 }
 
-func evalIntegerInfixExpression(operator string, left object.Object, right object.Object) object.Object {
-	leftVal := left.(*object.Integer).Value
-	rightVal := right.(*object.Integer).Value
+func evalFloatInfixExpression(operator string, left object.Object, right object.Object) object.Object {
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
 	switch operator {
 	case "+":
-		return &object.Integer{Value: leftVal + rightVal}
+		return &object.Float{Value: leftVal + rightVal}
 	case "-":
-		return &object.Integer{Value: leftVal - rightVal}
+		return &object.Float{Value: leftVal - rightVal}
 	case "*":
-		return &object.Integer{Value: leftVal * rightVal}
+		return &object.Float{Value: leftVal * rightVal}
 	case "/":
-		return &object.Integer{Value: leftVal / rightVal}
+		return &object.Float{Value: leftVal / rightVal}
+	case "%":
+		return &object.Float{Value: math.Mod(leftVal, rightVal)}
+	case "**":
+		return &object.Float{Value: math.Pow(leftVal, rightVal)}
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
 	case ">":
 		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
 	case "==":
 		return nativeBoolToBooleanObject(leftVal == rightVal)
 	case "!=":
 		return nativeBoolToBooleanObject(leftVal != rightVal)
 	default:
-		return newError("unknown operator: %s %s %s",
+		return newTypedError(object.TypeErrorClass, "unknown operator: %s %s %s",
 			left.Type(), operator, right.Type())
+	}
+}
+
+func isNumber(obj object.Object) bool {
+	return isInteger(obj) || obj.Type() == object.FLOAT_OBJ
+}
 
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value)
+	case *object.BigInt:
+		f, _ := new(big.Float).SetInt(obj.Value).Float64()
+		return f
 	}
+	return obj.(*object.Float).Value
 }
 
 func evalPrefixExpression(operator string, right object.Object) object.Object {
@@ -352,18 +1143,30 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 	case "-":
 		return evalMinusOrPlusOperatorExpression(token.MINUS, right)
 	default:
-		return newError("unknown operator: %s%s", operator, right.Type())
+		return newTypedError(object.TypeErrorClass, "unknown operator: %s%s", operator, right.Type())
 
 	}
 }
 
 func evalMinusOrPlusOperatorExpression(op token.TokenType, right object.Object) object.Object {
+	if f, ok := right.(*object.Float); ok {
+		if op == token.MINUS {
+			return &object.Float{Value: -f.Value}
+		}
+		return f
+	}
+	if b, ok := right.(*object.BigInt); ok {
+		if op == token.MINUS {
+			return bigIntToObject(new(big.Int).Neg(b.Value))
+		}
+		return b
+	}
 	r, ok := right.(*object.Integer)
 	if !ok {
-		return newError("unknown operator: -%s", right.Type())
+		return newTypedError(object.TypeErrorClass, "unknown operator: %s%s", op, right.Type())
 	}
 	if op == token.MINUS {
-		r.Value = -r.Value
+		return negateInteger(r)
 	}
 	return r
 }
@@ -397,11 +1200,11 @@ return 10;
 return 1;
 }
 */
-func evalStatements(stmts []ast.Statement, env object.Environment) object.Object {
+func (e *Evaluator) evalStatements(stmts []ast.Statement, env object.Environment) object.Object {
 	var result object.Object
 
 	for _, s := range stmts {
-		result = doEval(s, env) // 解析最后一条语句才是返回值
+		result = e.doEval(s, env) // 解析最后一条语句才是返回值
 		switch result := result.(type) {
 		case *object.ReturnValue:
 			// 此处运用于只有一层return语句时有效,套会导致只有最外层的return语句有效
@@ -413,13 +1216,14 @@ func evalStatements(stmts []ast.Statement, env object.Environment) object.Object
 	return result
 }
 
-func evalBlockStatements(stmts []ast.Statement, env object.Environment) object.Object {
+func (e *Evaluator) evalBlockStatements(stmts []ast.Statement, env object.Environment) object.Object {
 	var result object.Object
 
 	for _, s := range stmts {
-		result = doEval(s, env)
+		result = e.doEval(s, env)
 		if result != nil {
-			if result.Type() == object.RETURN_VALUE_OBJ || result.Type() == object.ERROR_OBJ {
+			switch result.Type() {
+			case object.RETURN_VALUE_OBJ, object.ERROR_OBJ, object.BREAK_OBJ, object.CONTINUE_OBJ:
 				// 返回return本身, 表示外层也是获得statement的object也是return,不往下继续进行解析到此结束
 				return result
 			}
@@ -432,6 +1236,10 @@ func newError(format string, a ...interface{}) *object.Error {
 	return &object.Error{Message: fmt.Sprintf(format, a...)}
 }
 
+func newTypedError(class, format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...), Class: class}
+}
+
 /*
 pseudocode
 function eval(astNode) {
@@ -2,10 +2,12 @@ package evaluator
 
 import (
 	"fmt"
+	"github.com/qiuhoude/go-interpreter/evaluator/evaltest"
 	"github.com/qiuhoude/go-interpreter/lexer"
 	"github.com/qiuhoude/go-interpreter/object"
 	"github.com/qiuhoude/go-interpreter/parser"
 	. "github.com/smartystreets/goconvey/convey"
+	"math"
 	"testing"
 )
 
@@ -13,7 +15,22 @@ func testEval(input string) object.Object {
 	l := lexer.New(input)
 	p := parser.New(l)
 	program := p.ParseProgram()
-	return Eval(program, object.GlobalEnv())
+	return Eval(program, object.NewGlobalEnv()) // 每个用例使用独立的全局 env, 互不影响
+}
+
+// evaltest 中和 vm 共用的用例
+func runCases(cases []evaltest.Case) {
+	for _, tt := range cases {
+		Convey(tt.Input, func() {
+			So(testEval(tt.Input).Inspect(), ShouldEqual, tt.Expected)
+		})
+	}
+}
+
+func TestBasics(t *testing.T) {
+	Convey("TestBasics", t, func() {
+		runCases(evaltest.Basics)
+	})
 }
 
 func TestEvaluator(t *testing.T) {
@@ -238,6 +255,14 @@ return 1;
 				`hash{"name": "Monkey"}[fn(x) { x }];`,
 				"unusable as hash key: FUNCTION",
 			},
+			{
+				"fn(a, b) { a }(1)",
+				"wrong number of arguments: want=2, got=1",
+			},
+			{
+				"let f = fn(x) { f(x) }; f(1)",
+				"max call depth exceeded: 10000",
+			},
 		}
 		for _, tt := range cases {
 			actual := testEval(tt.input)
@@ -248,6 +273,45 @@ return 1;
 		}
 	})
 
+	Convey("TestErrorPosition", t, func() {
+		cases := []struct {
+			input       string
+			expectedPos string
+		}{
+			{"5 + true;", "1:1"},
+			{"let a = 1;\nlet f = fn(x) {\n  x + foobar\n};\nf(a)", "3:7"},
+			{"let a = 1;\n  len(1)", "2:3"},
+		}
+		for _, tt := range cases {
+			errObj, ok := testEval(tt.input).(*object.Error)
+			So(ok, ShouldBeTrue)
+			So(errObj.Pos.String(), ShouldEqual, tt.expectedPos)
+		}
+	})
+
+	Convey("TestStackTrace", t, func() {
+		input := `let inner = fn(x) {
+  x + missing
+};
+let outer = fn(x) { inner(x) };
+let run = fn() { outer(1) };
+run()`
+		errObj, ok := testEval(input).(*object.Error)
+		So(ok, ShouldBeTrue)
+		So(errObj.Stack, ShouldResemble, []object.StackFrame{
+			{Function: "inner", Pos: errObj.Stack[0].Pos},
+			{Function: "outer", Pos: errObj.Stack[1].Pos},
+			{Function: "run", Pos: errObj.Stack[2].Pos},
+		})
+		So(errObj.StackTrace(), ShouldEqual, "\tat inner (4:21)\n\tat outer (5:18)\n\tat run (6:1)\n")
+
+		errObj = testEval("fn(x) { len(x) }(1)").(*object.Error)
+		So(errObj.StackTrace(), ShouldEqual, "\tat len (1:9)\n\tat <anonymous> (1:1)\n")
+
+		errObj = testEval("let x = 1; x(2)").(*object.Error)
+		So(errObj.Stack, ShouldBeEmpty)
+	})
+
 	Convey("TestLetStatements", t, func() {
 		cases := []struct {
 			input    string
@@ -331,7 +395,11 @@ func TestStringLiteral(t *testing.T) {
 			expected string
 		}{
 			{`"Hello World!"`, "Hello World!"},
-			{`"H@@@__@`, "H@@@__@"},
+			{`"H@@@__@"`, "H@@@__@"},
+			{`"a\tb\nc"`, "a\tb\nc"},
+			{`"say \"hi\" \\ bye"`, `say "hi" \ bye`},
+			{`"\u4e2d\u6587\x41\U0001F600"`, "中文A😀"},
+			{"`raw \\n \"q\"\r\nline2`", "raw \\n \"q\"\nline2"},
 			{`"Hello" + " " + "World!"`, "Hello World!"},
 			{`"Hello" +" " +  1`, "Hello 1"},
 			{`"Hello" +" " + true`, "Hello true"},
@@ -343,6 +411,18 @@ func TestStringLiteral(t *testing.T) {
 	})
 }
 
+func TestUnicode(t *testing.T) {
+	Convey("TestUnicode", t, func() {
+		runCases(evaltest.Unicode)
+	})
+}
+
+func TestInterpolatedString(t *testing.T) {
+	Convey("TestInterpolatedString", t, func() {
+		runCases(evaltest.InterpolatedString)
+	})
+}
+
 func TestArray(t *testing.T) {
 	Convey("TestArrayLiterals", t, func() {
 		input := "[1, 2 * 2, 3 + 3]"
@@ -521,6 +601,207 @@ func TestHashIndexExpressions(t *testing.T) {
 	})
 }
 
+func TestTryCatch(t *testing.T) {
+	Convey("TestTryCatch", t, func() {
+		runCases(evaltest.TryCatch)
+	})
+}
+
+func TestFloat(t *testing.T) {
+	Convey("TestFloat", t, func() {
+		runCases(evaltest.Float)
+	})
+}
+
+func TestBigInt(t *testing.T) {
+	Convey("TestBigInt", t, func() {
+		runCases(evaltest.BigInt)
+	})
+}
+
+func TestComparison(t *testing.T) {
+	Convey("TestComparison", t, func() {
+		runCases(evaltest.Comparison)
+	})
+}
+
+func TestOperators(t *testing.T) {
+	Convey("TestOperators", t, func() {
+		runCases(evaltest.Operators)
+	})
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	Convey("TestRuntimeErrors", t, func() {
+		runCases(evaltest.RuntimeErrors)
+
+		Convey("有语法错误的 AST 不会 panic", func() {
+			program := parser.New(lexer.New("let a = ; a")).ParseProgram()
+			So(Eval(program, object.NewGlobalEnv()).Inspect(), ShouldEqual, "ERROR: 1:1: missing expression")
+		})
+
+		Convey("内部的 panic 转换成 InternalError", func() {
+			e := New(map[string]object.Object{
+				"boom": &object.Builtin{Fn: func(args ...object.Object) object.Object {
+					return args[0] // 没有参数时越界
+				}},
+				"none": &object.Builtin{Fn: func(args ...object.Object) object.Object { return nil }},
+			})
+			env := object.NewGlobalEnv()
+			program := parser.New(lexer.New("try { boom() } catch (e) { 0 }")).ParseProgram()
+			errObj, ok := e.Eval(program, env).(*object.Error)
+			So(ok, ShouldBeTrue)
+			So(errObj.Kind, ShouldEqual, object.InternalError)
+			So(errObj.Message, ShouldStartWith, "internal error: runtime error: index out of range")
+			So(errObj.GoStack, ShouldNotBeEmpty)
+
+			result := e.Call(e.builtins["boom"])
+			So(result.(*object.Error).Kind, ShouldEqual, object.InternalError)
+
+			// 出错后可以继续使用
+			program = parser.New(lexer.New("let x = none(); [x, boom(1)]")).ParseProgram()
+			So(e.Eval(program, env).Inspect(), ShouldEqual, "[null, 1]")
+		})
+	})
+}
+
+func TestNoMutation(t *testing.T) {
+	Convey("TestNoMutation", t, func() {
+		operands := func() []object.Object {
+			return []object.Object{
+				object.NewInteger(5), object.NewInteger(-3), object.NewInteger(0),
+				object.NewInteger(100000), object.NewInteger(math.MinInt64),
+				testEval("9223372036854775808"), &object.Float{Value: 2.5},
+				&object.String{Value: "ab"}, TRUE, FALSE, NULL,
+				testEval("[1, 2]"), testEval(`hash{"a": 1}`),
+			}
+		}
+		// 记录运算前的值和 hash key
+		snapshot := func(objs []object.Object) []string {
+			var out []string
+			for _, o := range objs {
+				s := o.Inspect()
+				if h, ok := o.(object.Hashable); ok {
+					s += fmt.Sprintf("#%v", h.HashKey())
+				}
+				out = append(out, s)
+			}
+			return out
+		}
+
+		Convey("前缀运算符", func() {
+			for _, op := range []string{"-", "+", "!"} {
+				objs := operands()
+				before := snapshot(objs)
+				for _, o := range objs {
+					EvalPrefix(op, o)
+				}
+				So(snapshot(objs), ShouldResemble, before)
+			}
+		})
+
+		Convey("中缀运算符和下标", func() {
+			ops := []string{"+", "-", "*", "/", "%", "**", "&", "|", "^", "<<", ">>",
+				"<", ">", "<=", ">=", "==", "!="}
+			for _, op := range ops {
+				objs := operands()
+				before := snapshot(objs)
+				for _, l := range objs {
+					for _, r := range objs {
+						EvalInfix(op, l, r)
+						EvalIndex(l, r)
+					}
+				}
+				So(snapshot(objs), ShouldResemble, before)
+			}
+		})
+
+		runCases(evaltest.NoMutation)
+
+		Convey("小整数使用缓存", func() {
+			So(testEval("2 + 3"), ShouldEqual, testEval("5"))
+			So(testEval("let a = 1; -a"), ShouldEqual, object.NewInteger(-1))
+		})
+	})
+}
+
+func TestFunctionParameters(t *testing.T) {
+	Convey("TestFunctionParameters", t, func() {
+		runCases(evaltest.FunctionParameters)
+
+		Convey("Inspect 显示默认值和剩余参数", func() {
+			So(testEval("fn(a, b = 1, ...c) { a }").Inspect(), ShouldEqual, "fn(a, b = 1, ...c) {\na\n}")
+		})
+
+		Convey("在 Go 中调用时同样使用默认值", func() {
+			fn := testEval("fn(a, b = 2, ...rest) { [a, b, rest] }")
+			So(Call(fn, object.NewInteger(1)).Inspect(), ShouldEqual, "[1, 2, []]")
+			So(Call(fn, object.NewInteger(1), object.NewInteger(3), TRUE).Inspect(), ShouldEqual, "[1, 3, [true]]")
+		})
+	})
+}
+
+func TestNamedArguments(t *testing.T) {
+	Convey("TestNamedArguments", t, func() {
+		runCases(evaltest.NamedArguments)
+
+		Convey("NamedFn 内建函数收到命名参数", func() {
+			var gotArgs []object.Object
+			var gotNamed map[string]object.Object
+			e := New(map[string]object.Object{
+				"opts": &object.Builtin{NamedFn: func(args []object.Object, named map[string]object.Object) object.Object {
+					gotArgs, gotNamed = args, named
+					return NULL
+				}},
+			})
+			program := parser.New(lexer.New("opts(1, ...[2], timeout: 30, retries: 3)")).ParseProgram()
+			So(e.Eval(program, object.NewGlobalEnv()), ShouldEqual, NULL)
+			So(len(gotArgs), ShouldEqual, 2)
+			So(gotNamed["timeout"].Inspect(), ShouldEqual, "30")
+			So(gotNamed["retries"].Inspect(), ShouldEqual, "3")
+
+			program = parser.New(lexer.New("opts()")).ParseProgram()
+			e.Eval(program, object.NewGlobalEnv())
+			So(gotNamed, ShouldBeNil)
+		})
+	})
+}
+
+func TestDestructuring(t *testing.T) {
+	Convey("TestDestructuring", t, func() {
+		runCases(evaltest.Destructuring)
+
+		Convey("失败时不会部分绑定后面的变量", func() {
+			env := object.NewGlobalEnv()
+			program := parser.New(lexer.New("let [a, [b], c] = [1, 2, 3];")).ParseProgram()
+			So(isError(Eval(program, env)), ShouldBeTrue)
+			_, ok := env.Get("c")
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
+
+func TestLoops(t *testing.T) {
+	Convey("TestLoops", t, func() {
+		runCases(evaltest.Loops)
+
+		for _, tt := range evaltest.AbruptCompletions {
+			Convey(tt.Input, func() {
+				e := New(builtins)
+				e.SetLimits(Limits{MaxSteps: 100000}) // 修复前这些循环不会结束
+				program := parser.New(lexer.New(tt.Input)).ParseProgram()
+				So(e.Eval(program, object.NewGlobalEnv()).Inspect(), ShouldEqual, tt.Expected)
+			})
+		}
+	})
+}
+
+func TestForIn(t *testing.T) {
+	Convey("TestForIn", t, func() {
+		runCases(evaltest.ForIn)
+	})
+}
+
 func shouldIsHashObjectType(actual interface{}, _ ...interface{}) string {
 	_, ok := actual.(*object.Hash)
 	if !ok {
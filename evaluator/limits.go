@@ -0,0 +1,117 @@
+package evaluator
+
+import (
+	"context"
+	"github.com/qiuhoude/go-interpreter/object"
+)
+
+// 没有设置调用深度限制时使用, 避免无限递归撑爆 Go 的栈
+const DefaultMaxCallDepth = 10000
+
+// 每执行多少步检查一次 context
+const contextCheckInterval = 256
+
+// 执行限制, 0 表示不限制
+type Limits struct {
+	MaxSteps     int64 // 求值步数, 每求值一个节点算一步
+	MaxCallDepth int   // 函数调用深度, 0 时使用 DefaultMaxCallDepth
+	MaxAllocs    int64 // 分配的元素数(数组元素, hash 键值对, 字符串字节, BigInt 的字), 是一个近似值
+}
+
+// 一次执行过程中的状态, Eval/Call 开始时重置
+type runState struct {
+	ctx     context.Context
+	running bool
+	steps   int64
+	depth   int
+	allocs  int64
+}
+
+func (e *Evaluator) SetLimits(limits Limits) {
+	e.limits = limits
+}
+
+// 开始一次执行, 返回结束时的清理函数.
+// 在执行过程中再次进入(如内建函数回调脚本函数)时共享同一份计数
+func (e *Evaluator) begin(ctx context.Context) func() {
+	if e.state.running {
+		return func() {}
+	}
+	e.state = runState{ctx: ctx, running: true}
+	return func() { e.state = runState{} }
+}
+
+// 每求值一个节点调用一次
+func (e *Evaluator) step() *object.Error {
+	e.state.steps++
+	if e.limits.MaxSteps > 0 && e.state.steps > e.limits.MaxSteps {
+		return limitError(object.StepLimitError, "max steps exceeded: %d", e.limits.MaxSteps)
+	}
+	if e.state.steps%contextCheckInterval == 1 {
+		return e.checkContext()
+	}
+	return nil
+}
+
+func (e *Evaluator) checkContext() *object.Error {
+	if e.state.ctx == nil {
+		return nil
+	}
+	switch e.state.ctx.Err() {
+	case nil:
+		return nil
+	case context.DeadlineExceeded:
+		return limitError(object.DeadlineExceededError, "deadline exceeded")
+	default:
+		return limitError(object.CanceledError, "context canceled")
+	}
+}
+
+func (e *Evaluator) enterCall() *object.Error {
+	maxDepth := e.limits.MaxCallDepth
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxCallDepth
+	}
+	if e.state.depth >= maxDepth {
+		return limitError(object.CallDepthError, "max call depth exceeded: %d", maxDepth)
+	}
+	e.state.depth++
+	return nil
+}
+
+func (e *Evaluator) leaveCall() {
+	e.state.depth--
+}
+
+// 记录新分配的元素, 超过限制时返回错误
+func (e *Evaluator) alloc(obj object.Object) *object.Error {
+	var n int
+	switch obj := obj.(type) {
+	case *object.Array:
+		n = len(obj.Elements)
+	case *object.Hash:
+		n = len(obj.Pairs)
+	case *object.String:
+		n = len(obj.Value)
+	case *object.BigInt:
+		n = len(obj.Value.Bits())
+	default:
+		return nil
+	}
+	return e.allocN(int64(n))
+}
+
+// 记录新分配的 n 个元素
+func (e *Evaluator) allocN(n int64) *object.Error {
+	e.state.allocs += n
+	if e.limits.MaxAllocs > 0 && e.state.allocs > e.limits.MaxAllocs {
+		return limitError(object.AllocLimitError, "max allocs exceeded: %d", e.limits.MaxAllocs)
+	}
+	return nil
+}
+
+func limitError(kind object.ErrorKind, format string, a ...interface{}) *object.Error {
+	err := newError(format, a...)
+	err.Kind = kind
+	return err
+}
@@ -3,7 +3,7 @@ module github.com/qiuhoude/go-interpreter
 go 1.15
 
 require (
-	github.com/golang/mock v1.6.0 // indirect
-	github.com/prashantv/gostub v1.0.0 // indirect
-	github.com/smartystreets/goconvey v1.6.4 // indirect
+	github.com/golang/mock v1.6.0
+	github.com/prashantv/gostub v1.0.0
+	github.com/smartystreets/goconvey v1.6.4
 )
@@ -0,0 +1,310 @@
+package interp
+
+import (
+	"fmt"
+	"github.com/qiuhoude/go-interpreter/evaluator"
+	"github.com/qiuhoude/go-interpreter/object"
+	"math/big"
+	"reflect"
+)
+
+/*
+Go 值与 object 之间的转换
+	int*, uint*    <-> INTEGER
+	*big.Int       <-> INTEGER, BIGINT
+	float*         <-> FLOAT
+	string         <-> STRING
+	bool           <-> BOOLEAN
+	slice, array   <-> ARRAY
+	map            <-> HASH
+	nil            <-> NULL
+object.Object 类型的值原样传递
+*/
+
+var (
+	objectType = reflect.TypeOf((*object.Object)(nil)).Elem()
+	bigIntType = reflect.TypeOf((*big.Int)(nil))
+)
+
+// 把 Go 值转换成 object
+func ToObject(v interface{}) (object.Object, error) {
+	if v == nil {
+		return evaluator.NULL, nil
+	}
+	return toObject(reflect.ValueOf(v))
+}
+
+func toObject(v reflect.Value) (object.Object, error) {
+	if v.Type().Implements(objectType) {
+		if v.IsNil() {
+			return evaluator.NULL, nil
+		}
+		return v.Interface().(object.Object), nil
+	}
+	if v.Type() == bigIntType {
+		if v.IsNil() {
+			return evaluator.NULL, nil
+		}
+		b := v.Interface().(*big.Int)
+		if b.IsInt64() {
+			return object.NewInteger(b.Int64()), nil
+		}
+		return &object.BigInt{Value: new(big.Int).Set(b)}, nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return evaluator.TRUE, nil
+		}
+		return evaluator.FALSE, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return object.NewInteger(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := v.Uint()
+		if int64(u) < 0 {
+			return &object.BigInt{Value: new(big.Int).SetUint64(u)}, nil
+		}
+		return object.NewInteger(int64(u)), nil
+	case reflect.Float32, reflect.Float64:
+		return &object.Float{Value: v.Float()}, nil
+	case reflect.String:
+		return &object.String{Value: v.String()}, nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return evaluator.NULL, nil
+		}
+		elements := make([]object.Object, v.Len())
+		for i := range elements {
+			elem, err := toObject(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = elem
+		}
+		return &object.Array{Elements: elements}, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return evaluator.NULL, nil
+		}
+		pairs := make(map[object.HashKey]object.HashPair, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := toObject(iter.Key())
+			if err != nil {
+				return nil, err
+			}
+			hashKey, ok := key.(object.Hashable)
+			if !ok {
+				return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+			}
+			value, err := toObject(iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			pairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+		}
+		return &object.Hash{Pairs: pairs}, nil
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return evaluator.NULL, nil
+		}
+		return toObject(v.Elem())
+	}
+	return nil, fmt.Errorf("unsupported go type: %s", v.Type())
+}
+
+// 把 object 转换成 Go 值. 目标类型为 interface{} 时按 object 的类型选择:
+// INTEGER -> int64, BIGINT -> *big.Int, FLOAT -> float64, STRING -> string, BOOLEAN -> bool, NULL -> nil,
+// ARRAY -> []interface{}, HASH -> map[interface{}]interface{}, 其余原样返回
+func FromObject(obj object.Object) interface{} {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return obj.Value
+	case *object.BigInt:
+		return new(big.Int).Set(obj.Value)
+	case *object.Float:
+		return obj.Value
+	case *object.String:
+		return obj.Value
+	case *object.Boolean:
+		return obj.Value
+	case *object.Null:
+		return nil
+	case *object.Array:
+		elements := make([]interface{}, len(obj.Elements))
+		for i, e := range obj.Elements {
+			elements[i] = FromObject(e)
+		}
+		return elements
+	case *object.Hash:
+		m := make(map[interface{}]interface{}, len(obj.Pairs))
+		for _, pair := range obj.Pairs {
+			m[FromObject(pair.Key)] = FromObject(pair.Value)
+		}
+		return m
+	}
+	return obj
+}
+
+// 把 object 转换成指定类型的 Go 值
+func fromObject(obj object.Object, t reflect.Type) (reflect.Value, error) {
+	if t.Kind() == reflect.Interface && t.NumMethod() == 0 {
+		v := FromObject(obj)
+		if v == nil {
+			return reflect.Zero(t), nil
+		}
+		return reflect.ValueOf(v), nil
+	}
+	if reflect.TypeOf(obj).AssignableTo(t) {
+		return reflect.ValueOf(obj), nil
+	}
+	if t == bigIntType {
+		switch obj := obj.(type) {
+		case *object.Integer:
+			return reflect.ValueOf(big.NewInt(obj.Value)), nil
+		case *object.BigInt:
+			return reflect.ValueOf(new(big.Int).Set(obj.Value)), nil
+		}
+	}
+	if obj == evaluator.NULL {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+			return reflect.Zero(t), nil
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		if b, ok := obj.(*object.Boolean); ok {
+			return reflect.ValueOf(b.Value).Convert(t), nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if i, ok := obj.(*object.Integer); ok {
+			v := reflect.New(t).Elem()
+			if v.OverflowInt(i.Value) {
+				return v, fmt.Errorf("%d overflows %s", i.Value, t)
+			}
+			v.SetInt(i.Value)
+			return v, nil
+		}
+		if b, ok := obj.(*object.BigInt); ok { // BigInt 一定超出 int64
+			return reflect.Value{}, fmt.Errorf("%s overflows %s", b.Inspect(), t)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if i, ok := obj.(*object.Integer); ok {
+			v := reflect.New(t).Elem()
+			if i.Value < 0 || v.OverflowUint(uint64(i.Value)) {
+				return v, fmt.Errorf("%d overflows %s", i.Value, t)
+			}
+			v.SetUint(uint64(i.Value))
+			return v, nil
+		}
+		if b, ok := obj.(*object.BigInt); ok {
+			v := reflect.New(t).Elem()
+			if !b.Value.IsUint64() || v.OverflowUint(b.Value.Uint64()) {
+				return v, fmt.Errorf("%s overflows %s", b.Inspect(), t)
+			}
+			v.SetUint(b.Value.Uint64())
+			return v, nil
+		}
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		switch obj := obj.(type) {
+		case *object.Float:
+			f = obj.Value
+		case *object.Integer: // integer 也可以传给 float 参数
+			f = float64(obj.Value)
+		default:
+			return reflect.Value{}, fmt.Errorf("must be %s, got %s", typeName(t), obj.Type())
+		}
+		v := reflect.New(t).Elem()
+		if v.OverflowFloat(f) {
+			return v, fmt.Errorf("%s overflows %s", obj.Inspect(), t)
+		}
+		v.SetFloat(f)
+		return v, nil
+	case reflect.String:
+		if s, ok := obj.(*object.String); ok {
+			return reflect.ValueOf(s.Value).Convert(t), nil
+		}
+	case reflect.Slice:
+		if arr, ok := obj.(*object.Array); ok {
+			v := reflect.MakeSlice(t, len(arr.Elements), len(arr.Elements))
+			for i, e := range arr.Elements {
+				elem, err := fromObject(e, t.Elem())
+				if err != nil {
+					return v, err
+				}
+				v.Index(i).Set(elem)
+			}
+			return v, nil
+		}
+	case reflect.Array:
+		if arr, ok := obj.(*object.Array); ok {
+			v := reflect.New(t).Elem()
+			if len(arr.Elements) != t.Len() {
+				return v, fmt.Errorf("array length mismatch. got=%d, want=%d",
+					len(arr.Elements), t.Len())
+			}
+			for i, e := range arr.Elements {
+				elem, err := fromObject(e, t.Elem())
+				if err != nil {
+					return v, err
+				}
+				v.Index(i).Set(elem)
+			}
+			return v, nil
+		}
+	case reflect.Map:
+		if hash, ok := obj.(*object.Hash); ok {
+			v := reflect.MakeMapWithSize(t, len(hash.Pairs))
+			for _, pair := range hash.Pairs {
+				key, err := fromObject(pair.Key, t.Key())
+				if err != nil {
+					return v, err
+				}
+				value, err := fromObject(pair.Value, t.Elem())
+				if err != nil {
+					return v, err
+				}
+				v.SetMapIndex(key, value)
+			}
+			return v, nil
+		}
+	case reflect.Ptr:
+		elem, err := fromObject(obj, t.Elem())
+		if err != nil {
+			return elem, err
+		}
+		v := reflect.New(t.Elem())
+		v.Elem().Set(elem)
+		return v, nil
+	}
+	return reflect.Value{}, fmt.Errorf("must be %s, got %s", typeName(t), obj.Type())
+}
+
+// Go 类型对应的脚本类型名, 用于错误信息
+func typeName(t reflect.Type) string {
+	if t == bigIntType {
+		return string(object.INTEGER_OBJ)
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return string(object.BOOLEAN_OBJ)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return string(object.INTEGER_OBJ)
+	case reflect.Float32, reflect.Float64:
+		return string(object.FLOAT_OBJ)
+	case reflect.String:
+		return string(object.STRING_OBJ)
+	case reflect.Slice, reflect.Array:
+		return string(object.ARRAY_OBJ)
+	case reflect.Map:
+		return string(object.HASH_OBJ)
+	case reflect.Ptr:
+		return typeName(t.Elem())
+	}
+	return t.String()
+}
@@ -0,0 +1,251 @@
+package interp
+
+import (
+	"context"
+	"fmt"
+	"github.com/qiuhoude/go-interpreter/evaluator"
+	"github.com/qiuhoude/go-interpreter/object"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// 通过反射把 Go 函数包装成内建函数, 参数和返回值自动转换.
+// 返回值可以是 (), (T), (error) 或 (T, error), 返回的 error 会变成脚本中的错误
+func WrapFunc(name string, fn interface{}) (*object.Builtin, error) {
+	fv, ft, err := checkFunc(name, fn)
+	if err != nil {
+		return nil, err
+	}
+	return &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		in, errObj := convertArgs(name, ft, ft.NumIn(), args)
+		if errObj != nil {
+			return errObj
+		}
+		return convertResults(name, fv.Call(in))
+	}}, nil
+}
+
+// 和 WrapFunc 相同, 但 fn 的最后一个参数接收脚本中的命名参数, 类型可以是 struct, struct 指针或 map[string]T.
+// struct 字段按 `interp:"name"` tag 匹配, 没有 tag 时按字段名匹配 (不区分大小写), 没有传的字段保持零值
+func WrapNamedFunc(name string, fn interface{}) (*object.Builtin, error) {
+	fv, ft, err := checkFunc(name, fn)
+	if err != nil {
+		return nil, err
+	}
+	if ft.NumIn() == 0 || ft.IsVariadic() {
+		return nil, fmt.Errorf("%s: last parameter must receive named arguments: %s", name, ft)
+	}
+	optType := ft.In(ft.NumIn() - 1)
+	if !isNamedArgsType(optType) {
+		return nil, fmt.Errorf("%s: named arguments must be struct, *struct or map[string]T, got %s", name, optType)
+	}
+
+	return &object.Builtin{NamedFn: func(args []object.Object, named map[string]object.Object) object.Object {
+		in, errObj := convertArgs(name, ft, ft.NumIn()-1, args)
+		if errObj != nil {
+			return errObj
+		}
+		opts, errObj := convertNamedArgs(name, optType, named)
+		if errObj != nil {
+			return errObj
+		}
+		return convertResults(name, fv.Call(append(in, opts)))
+	}}, nil
+}
+
+func checkFunc(name string, fn interface{}) (reflect.Value, reflect.Type, error) {
+	fv := reflect.ValueOf(fn)
+	if fn == nil || fv.Kind() != reflect.Func {
+		return fv, nil, fmt.Errorf("%s: not a function: %T", name, fn)
+	}
+	ft := fv.Type()
+	switch {
+	case ft.NumOut() > 2:
+		return fv, ft, fmt.Errorf("%s: too many return values: %s", name, ft)
+	case ft.NumOut() == 2 && ft.Out(1) != errorType:
+		return fv, ft, fmt.Errorf("%s: second return value must be error: %s", name, ft)
+	}
+	return fv, ft, nil
+}
+
+func isNamedArgsType(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct || t.Kind() == reflect.Map && t.Key().Kind() == reflect.String
+}
+
+// 把命名参数转换成 struct 或 map, 按名字排序处理, 保证错误信息稳定
+func convertNamedArgs(name string, t reflect.Type, named map[string]object.Object) (reflect.Value, *object.Error) {
+	keys := make([]string, 0, len(named))
+	for k := range named {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	if t.Kind() == reflect.Map {
+		v := reflect.MakeMapWithSize(t, len(named))
+		for _, k := range keys {
+			value, err := fromObject(named[k], t.Elem())
+			if err != nil {
+				return v, evaluator.NewTypedError(object.TypeErrorClass, "named argument %s to `%s` %s", k, name, err)
+			}
+			v.SetMapIndex(reflect.ValueOf(k).Convert(t.Key()), value)
+		}
+		return v, nil
+	}
+
+	structType := t
+	if t.Kind() == reflect.Ptr {
+		structType = t.Elem()
+	}
+	v := reflect.New(structType).Elem()
+	for _, k := range keys {
+		field, ok := namedField(structType, k)
+		if !ok {
+			return v, evaluator.NewTypedError(object.ArgumentErrorClass, "unexpected named argument: %s", k)
+		}
+		value, err := fromObject(named[k], field.Type)
+		if err != nil {
+			return v, evaluator.NewTypedError(object.TypeErrorClass, "named argument %s to `%s` %s", k, name, err)
+		}
+		v.FieldByIndex(field.Index).Set(value)
+	}
+	if t.Kind() == reflect.Ptr {
+		return v.Addr(), nil
+	}
+	return v, nil
+}
+
+func namedField(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" { // 未导出的字段不能设置
+			continue
+		}
+		switch tag := f.Tag.Get("interp"); {
+		case tag == "-":
+		case tag != "":
+			if tag == name {
+				return f, true
+			}
+		case strings.EqualFold(f.Name, name):
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// 转换前 numIn 个参数对应的位置参数
+func convertArgs(name string, ft reflect.Type, numIn int, args []object.Object) ([]reflect.Value, *object.Error) {
+	if ft.IsVariadic() {
+		if len(args) < numIn-1 {
+			return nil, evaluator.NewTypedError(object.ArgumentErrorClass, "wrong number of arguments. got=%d, want>=%d",
+				len(args), numIn-1)
+		}
+	} else if len(args) != numIn {
+		return nil, evaluator.NewTypedError(object.ArgumentErrorClass, "wrong number of arguments. got=%d, want=%d",
+			len(args), numIn)
+	}
+
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		var t reflect.Type
+		if ft.IsVariadic() && i >= numIn-1 {
+			t = ft.In(numIn - 1).Elem()
+		} else {
+			t = ft.In(i)
+		}
+		v, err := fromObject(arg, t)
+		if err != nil {
+			return nil, evaluator.NewTypedError(object.TypeErrorClass, "argument %d to `%s` %s", i+1, name, err)
+		}
+		in[i] = v
+	}
+	return in, nil
+}
+
+func convertResults(name string, out []reflect.Value) object.Object {
+	if n := len(out); n > 0 && out[n-1].Type() == errorType {
+		if !out[n-1].IsNil() {
+			return errorToObject(out[n-1].Interface().(error))
+		}
+		out = out[:n-1]
+	}
+	if len(out) == 0 {
+		return evaluator.NULL
+	}
+	result, err := toObject(out[0])
+	if err != nil {
+		return evaluator.NewError("result of `%s` %s", name, err)
+	}
+	return result
+}
+
+func errorToObject(err error) *object.Error {
+	if errObj, ok := err.(*object.Error); ok {
+		return errObj
+	}
+	return evaluator.NewError("%s", err)
+}
+
+// 注册 Go 函数, 脚本中可以按 name 调用, 同名时覆盖内建函数
+func (i *Interpreter) RegisterFunc(name string, fn interface{}) error {
+	builtin, err := WrapFunc(name, fn)
+	if err != nil {
+		return err
+	}
+	i.setBuiltin(name, builtin)
+	return nil
+}
+
+// 注册接收命名参数的 Go 函数, fn 的要求见 WrapNamedFunc
+func (i *Interpreter) RegisterNamedFunc(name string, fn interface{}) error {
+	builtin, err := WrapNamedFunc(name, fn)
+	if err != nil {
+		return err
+	}
+	i.setBuiltin(name, builtin)
+	return nil
+}
+
+func (i *Interpreter) setBuiltin(name string, builtin *object.Builtin) {
+	defer i.lock()()
+	i.builtins[name] = builtin
+}
+
+// 在 Go 中调用脚本函数或内建函数, 脚本中的错误以 *object.Error 返回.
+// 注册的 Go 函数可以通过它回调传入的脚本函数, 回调与外层的执行共享限制的计数
+func (i *Interpreter) Call(fn object.Object, args ...object.Object) (object.Object, error) {
+	return i.CallContext(context.Background(), fn, args...)
+}
+
+func (i *Interpreter) CallContext(ctx context.Context, fn object.Object, args ...object.Object) (object.Object, error) {
+	defer i.lock()()
+
+	result := i.evaluator.CallContext(ctx, fn, args...)
+	if errObj, ok := result.(*object.Error); ok {
+		return nil, errObj
+	}
+	return result, nil
+}
+
+// Call 的 Go 值版本, 参数通过 ToObject 转换, 返回值通过 FromObject 转换
+func (i *Interpreter) CallValue(fn object.Object, args ...interface{}) (interface{}, error) {
+	objs := make([]object.Object, len(args))
+	for n, arg := range args {
+		obj, err := ToObject(arg)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %s", n+1, err)
+		}
+		objs[n] = obj
+	}
+	result, err := i.Call(fn, objs...)
+	if err != nil {
+		return nil, err
+	}
+	return FromObject(result), nil
+}
@@ -0,0 +1,301 @@
+package interp
+
+import (
+	"errors"
+	"fmt"
+	"github.com/qiuhoude/go-interpreter/object"
+	. "github.com/smartystreets/goconvey/convey"
+	"math/big"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegisterFunc(t *testing.T) {
+	Convey("TestRegisterFunc", t, func() {
+		in := New()
+		So(in.RegisterFunc("repeat", func(n int64, s string) (string, error) {
+			if n < 0 {
+				return "", errors.New("negative count")
+			}
+			return strings.Repeat(s, int(n)), nil
+		}), ShouldBeNil)
+		So(in.RegisterFunc("sum", func(nums ...int) int {
+			total := 0
+			for _, n := range nums {
+				total += n
+			}
+			return total
+		}), ShouldBeNil)
+		So(in.RegisterFunc("keys", func(m map[string]int) []string {
+			var keys []string
+			for k := range m {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			return keys
+		}), ShouldBeNil)
+		So(in.RegisterFunc("not", func(b bool) bool { return !b }), ShouldBeNil)
+		So(in.RegisterFunc("byte", func(b uint8) uint8 { return b }), ShouldBeNil)
+		So(in.RegisterFunc("typeOf", func(v interface{}) string { return fmt.Sprintf("%T", v) }), ShouldBeNil)
+		So(in.RegisterFunc("noop", func() {}), ShouldBeNil)
+		So(in.RegisterFunc("raw", func(obj object.Object) object.Object { return obj }), ShouldBeNil)
+		So(in.RegisterFunc("counts", func() map[string]int { return map[string]int{"a": 1} }), ShouldBeNil)
+		So(in.RegisterFunc("price", func(n int, unit float64) float64 { return float64(n) * unit }), ShouldBeNil)
+		So(in.RegisterFunc("half", func(f float32) float32 { return f / 2 }), ShouldBeNil)
+		So(in.RegisterFunc("checksum", func(s string) *big.Int {
+			sum := new(big.Int)
+			for _, c := range s {
+				sum.Mul(sum, big.NewInt(1000003)).Add(sum, big.NewInt(int64(c)))
+			}
+			return sum
+		}), ShouldBeNil)
+		So(in.RegisterFunc("digits", func(n *big.Int) int { return len(n.String()) }), ShouldBeNil)
+		So(in.RegisterFunc("ulong", func(n uint64) uint64 { return n }), ShouldBeNil)
+
+		tests := []struct {
+			input    string
+			expected string
+		}{
+			{`repeat(3, "ab")`, "ababab"},
+			{`repeat(-1, "ab")`, "ERROR: 1:1: negative count"},
+			{`repeat("3", "ab")`, "ERROR: 1:1: argument 1 to `repeat` must be INTEGER, got STRING"},
+			{`repeat(3)`, "ERROR: 1:1: wrong number of arguments. got=1, want=2"},
+			{`repeat(3, s: "ab")`, "ERROR: 1:1: builtin function does not accept named arguments"},
+			{`sum()`, "0"},
+			{`sum(1, 2, 3)`, "6"},
+			{`sum(1, true)`, "ERROR: 1:1: argument 2 to `sum` must be INTEGER, got BOOLEAN"},
+			{`keys(hash{"b": 2, "a": 1})`, "[a, b]"},
+			{`keys(hash{"a": "x"})`, "ERROR: 1:1: argument 1 to `keys` must be INTEGER, got STRING"},
+			{`not(true) == false`, "true"},
+			{`byte(255)`, "255"},
+			{`byte(256)`, "ERROR: 1:1: argument 1 to `byte` 256 overflows uint8"},
+			{`typeOf(1) + typeOf([1, "a"])`, "int64[]interface {}"},
+			{`noop()`, "null"},
+			{`raw(fn(x) { x })(5)`, "5"},
+			{`counts()["a"]`, "1"},
+			{`price(3, 0.5)`, "1.5"},
+			{`price(3, 2)`, "6.0"},
+			{`price(1.5, 2)`, "ERROR: 1:1: argument 1 to `price` must be INTEGER, got FLOAT"},
+			{`half(1)`, "0.5"},
+			{`half(1e39)`, "ERROR: 1:1: argument 1 to `half` 1e+39 overflows float32"},
+			{`checksum("abcd")`, "97000971003306003898"},
+			{`checksum("ab")`, "97000389"},
+			{`digits(checksum("abcd")) + digits(5)`, "21"},
+			{`ulong(18446744073709551615)`, "18446744073709551615"},
+			{`ulong(18446744073709551616)`, "ERROR: 1:1: argument 1 to `ulong` 18446744073709551616 overflows uint64"},
+			{`byte(100000000000000000000)`, "ERROR: 1:1: argument 1 to `byte` 100000000000000000000 overflows uint8"},
+			{`repeat(100000000000000000000, "a")`, "ERROR: 1:1: argument 1 to `repeat` 100000000000000000000 overflows int64"},
+		}
+		for _, tt := range tests {
+			result, err := in.Eval(tt.input)
+			if err != nil {
+				result = err.(*object.Error)
+			}
+			So(result.Inspect(), ShouldEqual, tt.expected)
+		}
+
+		Convey("NamedFn 接收命名参数", func() {
+			in.Set("fetch", &object.Builtin{NamedFn: func(args []object.Object, named map[string]object.Object) object.Object {
+				timeout, ok := named["timeout"]
+				if !ok {
+					timeout = object.NewInteger(10)
+				}
+				return &object.String{Value: fmt.Sprintf("%s %s", args[0].Inspect(), timeout.Inspect())}
+			}})
+			result, err := in.Eval(`[fetch("a"), fetch("b", timeout: 30)]`)
+			So(err, ShouldBeNil)
+			So(result.Inspect(), ShouldEqual, "[a 10, b 30]")
+		})
+
+		Convey("不支持的函数签名", func() {
+			So(in.RegisterFunc("bad", 5), ShouldNotBeNil)
+			So(in.RegisterFunc("bad", func() (int, int) { return 0, 0 }), ShouldNotBeNil)
+			So(in.RegisterFunc("bad", func() (int, int, error) { return 0, 0, nil }), ShouldNotBeNil)
+		})
+
+		Convey("宿主返回的错误对象不会被修改", func() {
+			errNotFound := &object.Error{Message: "not found"}
+			So(in.RegisterFunc("find", func() error { return errNotFound }), ShouldBeNil)
+			_, err := in.Eval("let lookup = fn() { find() };")
+			So(err, ShouldBeNil)
+			for n := 0; n < 2; n++ {
+				_, err := in.Eval("lookup()")
+				So(err.(*object.Error).Stack, ShouldHaveLength, 2)        // find, lookup
+				So(err.(*object.Error).Pos.String(), ShouldEqual, "1:21") // find() 在 lookup 中的位置
+			}
+			So(errNotFound.Stack, ShouldBeEmpty)
+			So(errNotFound.Pos.IsValid(), ShouldBeFalse)
+		})
+
+		Convey("RegisterNamedFunc 接收命名参数", func() {
+			type fetchOptions struct {
+				Timeout int
+				Retry   bool   `interp:"retry"`
+				Method  string `interp:"method"`
+				secret  string
+			}
+			So(in.RegisterNamedFunc("fetch", func(url string, opts fetchOptions) string {
+				return fmt.Sprintf("%s %s %d %v", opts.Method, url, opts.Timeout, opts.Retry)
+			}), ShouldBeNil)
+			So(in.RegisterNamedFunc("tags", func(opts *fetchOptions) string { return opts.Method }), ShouldBeNil)
+			So(in.RegisterNamedFunc("query", func(table string, where map[string]interface{}) (string, error) {
+				keys := make([]string, 0, len(where))
+				for k, v := range where {
+					keys = append(keys, fmt.Sprintf("%s=%v", k, v))
+				}
+				sort.Strings(keys)
+				return table + "?" + strings.Join(keys, "&"), nil
+			}), ShouldBeNil)
+
+			tests := []struct {
+				input    string
+				expected string
+			}{
+				{`fetch("/a")`, " /a 0 false"},
+				{`fetch("/a", timeout: 30, method: "GET")`, "GET /a 30 false"},
+				{`fetch("/a", TIMEOUT: 5, retry: true)`, " /a 5 true"},
+				{`let f = fn(url) { fetch(url, method: "POST") }; f("/b")`, "POST /b 0 false"},
+				{`tags(method: "PUT")`, "PUT"},
+				{`query("users", id: 1, name: "xiqi")`, "users?id=1&name=xiqi"},
+				{`query("users")`, "users?"},
+				{`fetch("/a", secret: "x")`, "ERROR: 1:1: unexpected named argument: secret"},
+				{`fetch("/a", Retry: true)`, "ERROR: 1:1: unexpected named argument: Retry"},
+				{`fetch("/a", timeout: "1")`, "ERROR: 1:1: named argument timeout to `fetch` must be INTEGER, got STRING"},
+				{`fetch(timeout: 1)`, "ERROR: 1:1: wrong number of arguments. got=0, want=1"},
+				{`fetch("/a", "/b")`, "ERROR: 1:1: wrong number of arguments. got=2, want=1"},
+			}
+			for _, tt := range tests {
+				result, err := in.Eval(tt.input)
+				if err != nil {
+					result = err.(*object.Error)
+				}
+				So(result.Inspect(), ShouldEqual, tt.expected)
+			}
+
+			So(in.RegisterNamedFunc("bad", func() {}), ShouldNotBeNil)
+			So(in.RegisterNamedFunc("bad", func(n int) {}), ShouldNotBeNil)
+			So(in.RegisterNamedFunc("bad", func(opts ...fetchOptions) {}), ShouldNotBeNil)
+			So(in.RegisterNamedFunc("bad", func(opts map[int]int) {}), ShouldNotBeNil)
+		})
+
+		Convey("注册的函数只在当前实例可见", func() {
+			_, err := New().Eval(`repeat(1, "a")`)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestConvert(t *testing.T) {
+	Convey("TestConvert", t, func() {
+		obj, err := ToObject(map[string][]int{"a": {1, 2}})
+		So(err, ShouldBeNil)
+		So(obj.Type(), ShouldEqual, object.HASH_OBJ)
+		So(FromObject(obj), ShouldResemble, map[interface{}]interface{}{
+			"a": []interface{}{int64(1), int64(2)},
+		})
+
+		obj, err = ToObject([]float32{1.5})
+		So(err, ShouldBeNil)
+		So(obj.Inspect(), ShouldEqual, "[1.5]")
+		So(FromObject(&object.Float{Value: 0.5}), ShouldEqual, 0.5)
+
+		_, err = ToObject(complex(1, 2))
+		So(err, ShouldNotBeNil)
+		obj, err = ToObject(uint64(1 << 63))
+		So(err, ShouldBeNil)
+		So(obj.Type(), ShouldEqual, object.BIGINT_OBJ)
+		So(FromObject(obj), ShouldResemble, new(big.Int).SetUint64(1<<63))
+	})
+}
+
+func TestCall(t *testing.T) {
+	Convey("TestCall", t, func() {
+		in := New()
+		_, err := in.Eval(`
+let validate = fn(req) { if (len(req["name"]) > 0) { true } else { false } };
+let count = 0;
+let inc = fn(n) { count = count + n; count };`)
+		So(err, ShouldBeNil)
+
+		Convey("调用脚本函数", func() {
+			validate, _ := in.Get("validate")
+			req, _ := ToObject(map[string]string{"name": "xiqi"})
+			result, err := in.Call(validate, req)
+			So(err, ShouldBeNil)
+			So(result.Inspect(), ShouldEqual, "true")
+
+			value, err := in.CallValue(validate, map[string]string{"name": ""})
+			So(err, ShouldBeNil)
+			So(value, ShouldEqual, false)
+		})
+
+		Convey("解构宿主函数返回的记录", func() {
+			So(in.RegisterFunc("user", func(id int) map[string]interface{} {
+				return map[string]interface{}{"name": "xiqi", "roles": []string{"admin", "dev"}, "id": id}
+			}), ShouldBeNil)
+			result, err := in.Eval(`let hash{"name": n, "roles": [role, ..._]} = user(7); n + ":" + role`)
+			So(err, ShouldBeNil)
+			So(result.Inspect(), ShouldEqual, "xiqi:admin")
+		})
+
+		Convey("多次调用共享全局状态", func() {
+			inc, _ := in.Get("inc")
+			for n := 1; n <= 3; n++ {
+				_, err := in.CallValue(inc, n)
+				So(err, ShouldBeNil)
+			}
+			count, _ := in.Get("count")
+			So(count.Inspect(), ShouldEqual, "6")
+		})
+
+		Convey("调用内建函数", func() {
+			length, _ := in.Eval("len")
+			value, err := in.CallValue(length, []int{1, 2, 3})
+			So(err, ShouldBeNil)
+			So(value, ShouldEqual, int64(3))
+		})
+
+		Convey("错误", func() {
+			inc, _ := in.Get("inc")
+			_, err := in.CallValue(inc)
+			So(err.Error(), ShouldEqual, "wrong number of arguments: want=1, got=0")
+			_, err = in.CallValue(inc, true)
+			So(err.Error(), ShouldEqual, "4:27: type mismatch: INTEGER + BOOLEAN")
+			_, err = in.CallValue(inc, struct{}{})
+			So(err, ShouldNotBeNil)
+			_, err = in.Call(&object.Integer{Value: 1})
+			So(err.Error(), ShouldEqual, "not a function: INTEGER")
+		})
+
+		Convey("注册的函数回调脚本函数", func() {
+			So(in.RegisterFunc("apply", func(f object.Object, x int64) (object.Object, error) {
+				count, _ := in.Get("count")
+				in.Set("seen", count)
+				return in.Call(f, &object.Integer{Value: x})
+			}), ShouldBeNil)
+
+			done := make(chan struct{})
+			var result object.Object
+			var err error
+			go func() {
+				defer close(done)
+				result, err = in.Eval(`let count = 5; apply(fn(x) { inc(x) * 2 }, 3)`)
+			}()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("回调同一个解释器时死锁")
+			}
+			So(err, ShouldBeNil)
+			So(result.Inspect(), ShouldEqual, "16")
+			seen, _ := in.Get("seen")
+			So(seen.Inspect(), ShouldEqual, "5")
+
+			// 回调中的错误照常返回给 Go 函数
+			_, err = in.Eval(`apply(fn(x) { x + true }, 1)`)
+			So(err.Error(), ShouldEqual, "1:15: type mismatch: INTEGER + BOOLEAN")
+		})
+	})
+}
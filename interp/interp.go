@@ -0,0 +1,176 @@
+package interp
+
+import (
+	"bytes"
+	"context"
+	"github.com/qiuhoude/go-interpreter/ast"
+	"github.com/qiuhoude/go-interpreter/evaluator"
+	"github.com/qiuhoude/go-interpreter/lexer"
+	"github.com/qiuhoude/go-interpreter/object"
+	"github.com/qiuhoude/go-interpreter/parser"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+可嵌入的解释器, 每个实例拥有独立的全局 env 和内建函数表,
+多个实例之间互不影响. 同一个实例的方法可以并发调用, 执行会被串行化.
+注册的 Go 函数在执行过程中可以回调同一个实例(Call, Eval, Get, Set), 不会死锁.
+*/
+
+type Interpreter struct {
+	mu    sync.Mutex
+	owner int64 // 持有 mu 的 goroutine, 0 表示没有
+
+	env       object.Environment
+	builtins  map[string]object.Object
+	evaluator *evaluator.Evaluator
+
+	stdout    io.Writer
+	stdin     io.Reader
+	filename  string // 用于错误位置
+	maxErrors int    // 解析错误上限
+	limits    evaluator.Limits
+}
+
+type Option func(*Interpreter)
+
+// print 的输出, 默认 os.Stdout
+func WithStdout(w io.Writer) Option {
+	return func(i *Interpreter) { i.stdout = w }
+}
+
+// input 的输入, 默认 os.Stdin
+func WithStdin(r io.Reader) Option {
+	return func(i *Interpreter) { i.stdin = r }
+}
+
+// 错误信息中显示的文件名
+func WithFilename(name string) Option {
+	return func(i *Interpreter) { i.filename = name }
+}
+
+// 解析错误上限, 0 表示不限制
+func WithMaxParseErrors(n int) Option {
+	return func(i *Interpreter) { i.maxErrors = n }
+}
+
+// 最多求值的步数, 0 表示不限制
+func WithMaxSteps(n int64) Option {
+	return func(i *Interpreter) { i.limits.MaxSteps = n }
+}
+
+// 最大函数调用深度, 0 表示使用 evaluator.DefaultMaxCallDepth
+func WithMaxCallDepth(n int) Option {
+	return func(i *Interpreter) { i.limits.MaxCallDepth = n }
+}
+
+// 每次执行最多分配的元素数(数组元素, hash 键值对, 字符串字节), 0 表示不限制
+func WithMaxAllocs(n int64) Option {
+	return func(i *Interpreter) { i.limits.MaxAllocs = n }
+}
+
+func New(opts ...Option) *Interpreter {
+	i := &Interpreter{
+		env:       object.NewGlobalEnv(),
+		stdout:    os.Stdout,
+		stdin:     os.Stdin,
+		maxErrors: parser.DefaultMaxErrors,
+	}
+	for _, opt := range opts {
+		opt(i)
+	}
+	i.builtins = evaluator.NewBuiltins(i.stdout, i.stdin)
+	i.evaluator = evaluator.New(i.builtins)
+	i.evaluator.SetLimits(i.limits)
+	return i
+}
+
+// 解析阶段的错误
+type ParseError struct {
+	Errors []*parser.Error
+}
+
+func (e *ParseError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// 解析并执行一段脚本, 全局变量在多次调用之间保留.
+// 解析失败返回 *ParseError, 运行出错返回 *object.Error
+func (i *Interpreter) Eval(src string) (object.Object, error) {
+	return i.EvalContext(context.Background(), src)
+}
+
+// ctx 取消或超时后停止执行, 返回 Kind 为 CanceledError/DeadlineExceededError 的 *object.Error
+func (i *Interpreter) EvalContext(ctx context.Context, src string) (object.Object, error) {
+	p := parser.New(lexer.NewFile(i.filename, src))
+	p.SetMaxErrors(i.maxErrors)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, &ParseError{Errors: p.Errors()}
+	}
+	return i.EvalProgramContext(ctx, program)
+}
+
+// 执行已经解析好的 AST, 同一个 program 可以在多个解释器中执行
+func (i *Interpreter) EvalProgram(program *ast.Program) (object.Object, error) {
+	return i.EvalProgramContext(context.Background(), program)
+}
+
+func (i *Interpreter) EvalProgramContext(ctx context.Context, program *ast.Program) (object.Object, error) {
+	defer i.lock()()
+
+	result := i.evaluator.EvalContext(ctx, program, i.env)
+	if errObj, ok := result.(*object.Error); ok {
+		return nil, errObj
+	}
+	return result, nil
+}
+
+// 获取全局变量
+func (i *Interpreter) Get(name string) (object.Object, bool) {
+	defer i.lock()()
+	return i.env.Get(name)
+}
+
+// 设置全局变量, 脚本中可以直接使用
+func (i *Interpreter) Set(name string, val object.Object) {
+	defer i.lock()()
+	i.env.Set(name, val)
+}
+
+// 加锁, 返回解锁函数. 当前 goroutine 已经持有锁时不再加锁,
+// 说明是注册的 Go 函数在执行过程中回调解释器, 直接使用正在执行的 evaluator
+func (i *Interpreter) lock() func() {
+	id := goroutineID()
+	if atomic.LoadInt64(&i.owner) == id {
+		return func() {}
+	}
+	i.mu.Lock()
+	atomic.StoreInt64(&i.owner, id)
+	return func() {
+		atomic.StoreInt64(&i.owner, 0)
+		i.mu.Unlock()
+	}
+}
+
+// Go 没有公开 goroutine 的 id, 从 runtime.Stack 的第一行 "goroutine 18 [running]:" 中解析
+func goroutineID() int64 {
+	var buf [64]byte
+	stack := buf[:runtime.Stack(buf[:], false)]
+	stack = bytes.TrimPrefix(stack, []byte("goroutine "))
+	if n := bytes.IndexByte(stack, ' '); n > 0 {
+		stack = stack[:n]
+	}
+	id, _ := strconv.ParseInt(string(stack), 10, 64)
+	return id
+}
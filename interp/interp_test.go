@@ -0,0 +1,310 @@
+package interp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/qiuhoude/go-interpreter/object"
+	. "github.com/smartystreets/goconvey/convey"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInterpreter(t *testing.T) {
+	Convey("TestInterpreter", t, func() {
+		Convey("全局变量在多次 Eval 之间保留", func() {
+			in := New()
+			_, err := in.Eval("let a = 5;")
+			So(err, ShouldBeNil)
+			result, err := in.Eval("a * 2")
+			So(err, ShouldBeNil)
+			So(result.Inspect(), ShouldEqual, "10")
+		})
+
+		Convey("不同实例互相隔离", func() {
+			first, second := New(), New()
+			_, _ = first.Eval("let a = 5; b = 6;")
+			_, err := second.Eval("a")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "1:1: identifier not found: a")
+			_, ok := second.Get("b")
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("print 和 input 使用实例的输入输出", func() {
+			var out bytes.Buffer
+			in := New(WithStdout(&out), WithStdin(strings.NewReader("monkey\nxiqi")))
+			result, err := in.Eval(`print("hello " + input()); input(); input()`)
+			So(err, ShouldBeNil)
+			So(out.String(), ShouldEqual, "hello monkey\n")
+			So(result.Inspect(), ShouldEqual, "null")
+		})
+
+		Convey("解析错误", func() {
+			in := New(WithFilename("main.xq"))
+			_, err := in.Eval("let = 5;")
+			perr, ok := err.(*ParseError)
+			So(ok, ShouldBeTrue)
+			So(len(perr.Errors), ShouldEqual, 1)
+			So(perr.Error(), ShouldStartWith, "main.xq:1:5: ")
+		})
+
+		Convey("解析错误上限", func() {
+			in := New(WithMaxParseErrors(1))
+			_, err := in.Eval("let = 1; let = 2; let = 3;")
+			So(len(err.(*ParseError).Errors), ShouldEqual, 2) // 外加一条 too many errors
+			So(err.(*ParseError).Errors[1].Msg, ShouldEqual, "too many errors")
+		})
+
+		Convey("运行时错误", func() {
+			in := New()
+			_, err := in.Eval("5 + true")
+			errObj, ok := err.(*object.Error)
+			So(ok, ShouldBeTrue)
+			So(errObj.Message, ShouldEqual, "type mismatch: INTEGER + BOOLEAN")
+		})
+
+		Convey("宿主函数 panic 时返回 InternalError, 解释器可以继续使用", func() {
+			in := New()
+			So(in.RegisterFunc("boom", func(s string) string { panic("boom: " + s) }), ShouldBeNil)
+			_, err := in.Eval(`let a = 1; try { boom("x") } catch (e) { 0 }`)
+			errObj, ok := err.(*object.Error)
+			So(ok, ShouldBeTrue)
+			So(errObj.Kind, ShouldEqual, object.InternalError)
+			So(errObj.Message, ShouldEqual, "internal error: boom: x")
+			So(errObj.GoStack, ShouldContainSubstring, "panic")
+			result, err := in.Eval("a + 1")
+			So(err, ShouldBeNil)
+			So(result.Inspect(), ShouldEqual, "2")
+		})
+
+		Convey("Set 的变量在脚本中可见", func() {
+			in := New()
+			in.Set("x", &object.Integer{Value: 3})
+			result, err := in.Eval("x + 1")
+			So(err, ShouldBeNil)
+			So(result.Inspect(), ShouldEqual, "4")
+		})
+
+		Convey("宿主提供的集合可以用 for-in 遍历", func() {
+			in := New()
+			in.Set("words", &wordList{words: []string{"a", "b", "c"}})
+			result, err := in.Eval(`let s = ""; for (i, w in words) { s = s + w }; s`)
+			So(err, ShouldBeNil)
+			So(result.Inspect(), ShouldEqual, "abc")
+		})
+	})
+}
+
+// 实现 object.Iterable 的宿主类型
+type wordList struct {
+	words []string
+}
+
+func (w *wordList) Type() object.ObjectType { return "WORDS" }
+func (w *wordList) Inspect() string         { return strings.Join(w.words, " ") }
+func (w *wordList) Iter() object.Iterator   { return &wordIterator{words: w.words} }
+
+type wordIterator struct {
+	words []string
+	idx   int
+}
+
+func (it *wordIterator) Next() (object.Object, object.Object, bool) {
+	if it.idx >= len(it.words) {
+		return nil, nil, false
+	}
+	it.idx++
+	return &object.Integer{Value: int64(it.idx - 1)}, &object.String{Value: it.words[it.idx-1]}, true
+}
+
+func TestConcurrentInterpreters(t *testing.T) {
+	var wg sync.WaitGroup
+	results := make([]string, 16)
+	for n := 0; n < len(results); n++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			in := New()
+			// true/false 和小整数是共享的对象, 用作 hash 的键时不能有并发写
+			src := fmt.Sprintf(`let x = %d; let f = fn(n) { if (n == 0) { x } else { f(n - 1) } };
+let h = hash{true: 1, false: 2, 3: 4}; h[true] + h[false] + h[3] - 7 + f(50)`, n)
+			result, err := in.Eval(src)
+			if err != nil {
+				results[n] = err.Error()
+				return
+			}
+			results[n] = result.Inspect()
+		}(n)
+	}
+	wg.Wait()
+
+	for n, got := range results {
+		if got != fmt.Sprint(n) {
+			t.Errorf("interpreter %d got=%s", n, got)
+		}
+	}
+}
+
+// true/false 和小整数是所有解释器共享的对象, 用作 hash 的键时不能有并发写.
+// 需要用 go test -race 运行
+func TestConcurrentSharedObjects(t *testing.T) {
+	var wg sync.WaitGroup
+	results := make([]string, 4)
+	for n := 0; n < len(results); n++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			result, err := New().Eval("hash{true: 1, false: 2, 3: 4}[true]")
+			if err != nil {
+				results[n] = err.Error()
+				return
+			}
+			results[n] = result.Inspect()
+		}(n)
+	}
+	wg.Wait()
+
+	for n, got := range results {
+		if got != "1" {
+			t.Errorf("interpreter %d got=%s", n, got)
+		}
+	}
+}
+
+// 宿主把同一个对象交给多个解释器时, 对象第一次用作 hash 的键才计算 hash key, 不能有并发写.
+// 需要用 go test -race 运行
+func TestConcurrentHostObjects(t *testing.T) {
+	shared := []object.Object{
+		&object.String{Value: "k"},
+		&object.Integer{Value: 1 << 40},
+		&object.Float{Value: 1.5},
+	}
+	for _, obj := range shared {
+		var wg sync.WaitGroup
+		results := make([]string, 4)
+		for n := 0; n < len(results); n++ {
+			wg.Add(1)
+			go func(n int) {
+				defer wg.Done()
+				in := New()
+				in.Set("k", obj)
+				result, err := in.Eval("hash{k: 1}[k]")
+				if err != nil {
+					results[n] = err.Error()
+					return
+				}
+				results[n] = result.Inspect()
+			}(n)
+		}
+		wg.Wait()
+
+		for n, got := range results {
+			if got != "1" {
+				t.Errorf("interpreter %d got=%s", n, got)
+			}
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	const fib = "let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };"
+
+	Convey("TestLimits", t, func() {
+		Convey("默认限制调用深度, 不会撑爆 Go 的栈", func() {
+			_, err := New().Eval("let f = fn(x) { f(x) }; f(1)")
+			So(err.(*object.Error).Kind, ShouldEqual, object.CallDepthError)
+			So(err.(*object.Error).Message, ShouldEqual, "max call depth exceeded: 10000")
+		})
+
+		Convey("调用深度", func() {
+			in := New(WithMaxCallDepth(10))
+			result, err := in.Eval("let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(9)")
+			So(err, ShouldBeNil)
+			So(result.Inspect(), ShouldEqual, "0")
+			_, err = in.Eval("f(10)")
+			So(err.(*object.Error).Kind, ShouldEqual, object.CallDepthError)
+			// 出错后状态被重置, 可以继续使用
+			_, err = in.Eval("f(9)")
+			So(err, ShouldBeNil)
+			// 超出限制的错误不能被 catch
+			_, err = in.Eval("try { f(10) } catch (e) { 0 }")
+			So(err.(*object.Error).Kind, ShouldEqual, object.CallDepthError)
+			// 在默认值中递归也计入调用深度
+			result, err = in.Eval("let g = fn(n, r = if (n == 0) { 0 } else { g(n - 1) }) { r }; g(9)")
+			So(err, ShouldBeNil)
+			So(result.Inspect(), ShouldEqual, "0")
+			_, err = in.Eval("g(10)")
+			So(err.(*object.Error).Kind, ShouldEqual, object.CallDepthError)
+			_, err = New().Eval("let h = fn(n, r = h(n)) { r }; h(1)")
+			So(err.(*object.Error).Kind, ShouldEqual, object.CallDepthError)
+		})
+
+		Convey("求值步数", func() {
+			in := New(WithMaxSteps(1000))
+			_, err := in.Eval(fib + "fib(5)")
+			So(err, ShouldBeNil)
+			_, err = in.Eval("fib(15)")
+			So(err.(*object.Error).Kind, ShouldEqual, object.StepLimitError)
+			// 每次执行单独计数
+			_, err = in.Eval("fib(5)")
+			So(err, ShouldBeNil)
+		})
+
+		Convey("死循环", func() {
+			_, err := New(WithMaxSteps(10000)).Eval("while (true) { }")
+			So(err.(*object.Error).Kind, ShouldEqual, object.StepLimitError)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			_, err = New().EvalContext(ctx, "for (;;) { }")
+			So(err.(*object.Error).Kind, ShouldEqual, object.DeadlineExceededError)
+		})
+
+		Convey("分配元素数", func() {
+			in := New(WithMaxAllocs(100))
+			_, err := in.Eval(`let s = "0123456789"; s + s + s`)
+			So(err, ShouldBeNil)
+			_, err = in.Eval(`let grow = fn(arr, n) { if (n == 0) { arr } else { grow(push(arr, n), n - 1) } }; grow([], 20)`)
+			So(err.(*object.Error).Kind, ShouldEqual, object.AllocLimitError)
+			So(err.Error(), ShouldEqual, "1:57: max allocs exceeded: 100")
+
+			// BigInt 按字计算
+			_, err = in.Eval(`let n = 2; while (true) { n = n * n }`)
+			So(err.(*object.Error).Kind, ShouldEqual, object.AllocLimitError)
+
+			// 展开的元素逐个计算, 不会先建好整个数组
+			in = New(WithMaxAllocs(1000))
+			_, err = in.Eval(`[...range(100000000)]`)
+			So(err.(*object.Error).Kind, ShouldEqual, object.AllocLimitError)
+			_, err = in.Eval(`let f = fn(...xs) { 1 }; f(...range(100000000))`)
+			So(err.(*object.Error).Kind, ShouldEqual, object.AllocLimitError)
+			result, err := in.Eval(`len([0, ...range(998)])`)
+			So(err, ShouldBeNil)
+			So(result.Inspect(), ShouldEqual, "999")
+		})
+
+		Convey("context 超时", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			_, err := New().EvalContext(ctx, fib+"fib(30)")
+			So(err.(*object.Error).Kind, ShouldEqual, object.DeadlineExceededError)
+			So(err.(*object.Error).Message, ShouldEqual, "deadline exceeded")
+		})
+
+		Convey("context 取消", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			in := New()
+			_, err := in.EvalContext(ctx, "1")
+			So(err.(*object.Error).Kind, ShouldEqual, object.CanceledError)
+
+			_, _ = in.Eval(fib)
+			fn, _ := in.Get("fib")
+			_, err = in.CallContext(ctx, fn, &object.Integer{Value: 10})
+			So(err.(*object.Error).Kind, ShouldEqual, object.CanceledError)
+		})
+	})
+}
@@ -1,12 +1,26 @@
 package lexer
 
 import (
+	"fmt"
 	"github.com/qiuhoude/go-interpreter/token"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 /*
-脚本代码目前只支持 ASCII
-number类型只支持 Integer
+脚本代码使用 UTF-8 编码, 按 rune 读取
+标识符由 Unicode 字母, 数字和 `_` 组成, 不能以数字开头, 如 `名字`, `x1`
+number类型支持 Integer 和 Float(3.14, 1e-9)
+	Integer 可以是 0x1F, 0o17, 0b1010, 数字之间可以用 `_` 分隔, 如 1_000_000
+字符串:
+	"..."  支持转义 \n \t \r \\ \" \' \$ \a \b \f \v \0 \xHH \uHHHH \UHHHHHHHH,
+	       以及插值 "total ${a + b}", 见 token.INTERP_HEAD
+	`...`  原样保留, 可以跨行, 会去掉其中的 \r
+不合法的字符, 未结束或转义错误的字符串返回 ILLEGAL token, Msg 中是错误原因
+注释:
+	// 行注释, /* 开始的块注释, 以及文件开头的 #! 行
+	默认跳过注释, 开启 ScanComments 后作为 COMMENT token 返回, 供格式化和文档工具使用
 */
 
 // 词法分析器
@@ -14,50 +28,105 @@ type ILexer interface {
 	NextToken() token.Token
 }
 
+type Mode uint
+
+const (
+	ScanComments Mode = 1 << iota // 返回 COMMENT token
+)
+
 type Lexer struct {
+	filename     string
+	mode         Mode
 	input        string
-	position     int  // 当前的位置
-	readPosition int  // 当前读到的位置
-	ch           byte // 当前char
+	position     int  // 当前的位置(字节)
+	readPosition int  // 当前读到的位置(字节)
+	ch           rune // 当前char
+	line         int  // 当前char所在行
+	column       int  // 当前char所在列, 按 rune 计数
+
+	interps []int // 每层未结束的字符串插值中 `{` 的嵌套数, 遇到匹配的 `}` 时继续读字符串
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	return NewFile("", input)
+}
+
+// 带文件名, 错误信息中会显示文件名
+func NewFile(filename, input string) *Lexer {
+	l := &Lexer{filename: filename, input: input, line: 1}
 	l.readChar()
 	return l
+}
 
+func (l *Lexer) SetMode(mode Mode) {
+	l.mode = mode
 }
 
 func (l *Lexer) readChar() {
+	if l.readPosition > len(l.input) { // 已经到达末尾, 位置不再变化
+		return
+	}
+	if l.ch == '\n' { // 换行
+		l.line++
+		l.column = 0
+	}
+	l.column++
+	l.position = l.readPosition
 	if l.readPosition >= len(l.input) {
 		l.ch = 0 // 0 -> ASCII code is NUL
-	} else {
-		l.ch = l.input[l.readPosition]
+		l.readPosition++
+		return
 	}
-	l.position = l.readPosition
-	l.readPosition++
+	// 不合法的 UTF-8 字节得到 utf8.RuneError, size 为 1
+	ch, size := utf8.DecodeRuneInString(l.input[l.readPosition:])
+	l.ch = ch
+	l.readPosition += size
 }
 
-func (l *Lexer) peekChar() byte {
+func (l *Lexer) peekChar() rune {
 	if l.readPosition >= len(l.input) {
 		return 0
-	} else {
-		return l.input[l.readPosition]
+	}
+	ch, _ := utf8.DecodeRuneInString(l.input[l.readPosition:])
+	return ch
+}
+
+// 当前char的位置
+func (l *Lexer) pos() token.Position {
+	return token.Position{
+		Filename: l.filename,
+		Offset:   l.position,
+		Line:     l.line,
+		Column:   l.column,
 	}
 }
 
 func (l *Lexer) NextToken() token.Token {
-	var tok token.Token
+	for {
+		// 跳过空格
+		l.skipWhitespace()
 
-	// 跳过空格
-	l.skipWhitespace()
+		pos := l.pos()
+		tok := l.readToken()
+		if tok.Type == token.COMMENT && l.mode&ScanComments == 0 {
+			continue
+		}
+		tok.Pos = pos
+		tok.End = l.pos()
+		if tok.Type == token.EOF {
+			tok.End = pos
+		}
+		return tok
+	}
+}
+
+func (l *Lexer) readToken() token.Token {
+	var tok token.Token
 
 	switch l.ch {
 	case '=': // = , ==
 		if l.peekChar() == '=' { // ==
-			preCh := l.ch
-			l.readChar()
-			tok = makeStrCharToken(token.EQ, string(preCh)+string(l.ch))
+			tok = l.readTwoCharToken(token.EQ)
 		} else {
 			tok = newToken(token.ASSIGN, l.ch)
 		}
@@ -67,30 +136,57 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.MINUS, l.ch)
 	case '!': // !, !=
 		if l.peekChar() == '=' { // !=
-			preCh := l.ch
-			l.readChar()
-			tok = makeStrCharToken(token.NOT_EQ, string(preCh)+string(l.ch))
+			tok = l.readTwoCharToken(token.NOT_EQ)
 		} else { // !
 			tok = newToken(token.BANG, l.ch)
 		}
-	case '/':
-		tok = newToken(token.SLASH, l.ch)
-	case '*':
-		tok = newToken(token.ASTERISK, l.ch)
-	case '<':
-		if l.peekChar() == '=' { // <=
-			preCh := l.ch
-			l.readChar()
-			tok = makeStrCharToken(token.LEQ, string(preCh)+string(l.ch))
+	case '/': // /, //, /*
+		switch l.peekChar() {
+		case '/':
+			return l.readLineComment()
+		case '*':
+			tok = l.readBlockComment()
+		default:
+			tok = newToken(token.SLASH, l.ch)
+		}
+	case '*': // *, **
+		if l.peekChar() == '*' {
+			tok = l.readTwoCharToken(token.POW)
+		} else {
+			tok = newToken(token.ASTERISK, l.ch)
+		}
+	case '%':
+		tok = newToken(token.PERCENT, l.ch)
+	case '&': // &, &&
+		if l.peekChar() == '&' {
+			tok = l.readTwoCharToken(token.AND)
+		} else {
+			tok = newToken(token.BIT_AND, l.ch)
+		}
+	case '|': // |, ||
+		if l.peekChar() == '|' {
+			tok = l.readTwoCharToken(token.OR)
 		} else {
+			tok = newToken(token.BIT_OR, l.ch)
+		}
+	case '^':
+		tok = newToken(token.BIT_XOR, l.ch)
+	case '<':
+		switch l.peekChar() {
+		case '=': // <=
+			tok = l.readTwoCharToken(token.LEQ)
+		case '<': // <<
+			tok = l.readTwoCharToken(token.SHL)
+		default:
 			tok = newToken(token.LT, l.ch)
 		}
 	case '>':
-		if l.peekChar() == '=' { // >=
-			preCh := l.ch
-			l.readChar()
-			tok = makeStrCharToken(token.GEQ, string(preCh)+string(l.ch))
-		} else {
+		switch l.peekChar() {
+		case '=': // >=
+			tok = l.readTwoCharToken(token.GEQ)
+		case '>': // >>
+			tok = l.readTwoCharToken(token.SHR)
+		default:
 			tok = newToken(token.GT, l.ch)
 		}
 	case ';':
@@ -102,66 +198,366 @@ func (l *Lexer) NextToken() token.Token {
 	case ')':
 		tok = newToken(token.RPAREN, l.ch)
 	case '{':
+		if n := len(l.interps); n > 0 {
+			l.interps[n-1]++
+		}
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
-		tok = newToken(token.RBRACE, l.ch)
+		if n := len(l.interps); n > 0 && l.interps[n-1] == 0 { // 插值结束
+			l.interps = l.interps[:n-1]
+			tok = l.readString(true)
+		} else {
+			if n > 0 {
+				l.interps[n-1]--
+			}
+			tok = newToken(token.RBRACE, l.ch)
+		}
 	case '"':
-		tok = makeStrCharToken(token.STRING, l.readString())
+		tok = l.readString(false)
+	case '`':
+		tok = l.readRawString()
 	case '[':
 		tok = newToken(token.LBRACKET, l.ch)
 	case ']':
 		tok = newToken(token.RBRACKET, l.ch)
 	case ':':
 		tok = newToken(token.COLON, l.ch)
+	case '.':
+		if strings.HasPrefix(l.input[l.readPosition:], "..") { // ...
+			l.readChar()
+			l.readChar()
+			tok = makeStrCharToken(token.ELLIPSIS, "...")
+		} else {
+			tok = illegalToken(string(l.ch), fmt.Sprintf("illegal character %q", l.ch))
+		}
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
+	case '#':
+		if l.position == 0 && l.peekChar() == '!' { // shebang
+			return l.readLineComment()
+		}
+		tok = illegalToken(string(l.ch), fmt.Sprintf("illegal character %q", l.ch))
 	default:
 		if isLetter(l.ch) { // 字母
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
 			return tok // readIdentifier()里面已经 调用了 l.readChar() 所以要return
 		} else if isDigit(l.ch) { // 数字
-			tok.Literal = l.readNumber()
-			tok.Type = token.INT
-			return tok
-		} else { // 非法字符
-			tok = newToken(token.ILLEGAL, l.ch)
+			return l.readNumber()
+		} else { // 非法字符, 保留原始字节
+			literal := l.input[l.position:l.readPosition]
+			if l.ch == utf8.RuneError && len(literal) == 1 {
+				tok = illegalToken(literal, "invalid UTF-8 encoding")
+			} else {
+				tok = illegalToken(literal, fmt.Sprintf("illegal character %q", l.ch))
+			}
 		}
 	}
 	l.readChar()
 	return tok
 }
 
-func isDigit(ch byte) bool {
+// number 只使用 ASCII 数字
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
-func isLetter(ch byte) bool { // [a-z|A-Z|_]
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+func isLetter(ch rune) bool { // Unicode 字母 或 _
+	return ch == '_' || unicode.IsLetter(ch)
 }
 
-func (l *Lexer) readString() string {
-	l.readChar()
-	position := l.position
-	for l.ch != '"' && l.ch != 0 {
+// 标识符除第一个字符外还可以包含数字
+func isIdentChar(ch rune) bool {
+	return isLetter(ch) || unicode.IsDigit(ch)
+}
+
+// 读到 `"` 或者 `${` 为止, continued 表示从插值结束的 `}` 开始读.
+// Literal 是处理转义后的内容. 出错时继续读到这一段结束, 只报告第一个错误
+func (l *Lexer) readString(continued bool) token.Token {
+	start := l.position
+	var out strings.Builder
+	var errMsg string
+	for {
 		l.readChar()
+		switch {
+		case l.ch == '"':
+			tokType := token.TokenType(token.STRING)
+			if continued {
+				tokType = token.INTERP_TAIL
+			}
+			if errMsg != "" {
+				return illegalToken(l.input[start:l.readPosition], errMsg)
+			}
+			return makeStrCharToken(tokType, out.String())
+		case l.ch == '$' && l.peekChar() == '{':
+			l.readChar()
+			l.interps = append(l.interps, 0)
+			tokType := token.TokenType(token.INTERP_HEAD)
+			if continued {
+				tokType = token.INTERP_MIDDLE
+			}
+			if errMsg != "" {
+				return illegalToken(l.input[start:l.readPosition], errMsg)
+			}
+			return makeStrCharToken(tokType, out.String())
+		case l.ch == 0:
+			return illegalToken(l.input[start:], "unterminated string literal")
+		case l.ch == '\\':
+			l.readChar()
+			if msg := l.readEscape(&out); errMsg == "" {
+				errMsg = msg
+			}
+		default:
+			out.WriteString(l.input[l.position:l.readPosition]) // 原样保留, 包括不合法的 UTF-8 字节
+		}
 	}
-	return l.input[position:l.position]
+}
 
+// 当前字符是 `\` 后面的字符, 返回错误信息
+func (l *Lexer) readEscape(out *strings.Builder) string {
+	switch l.ch {
+	case 'n':
+		out.WriteByte('\n')
+	case 't':
+		out.WriteByte('\t')
+	case 'r':
+		out.WriteByte('\r')
+	case 'a':
+		out.WriteByte('\a')
+	case 'b':
+		out.WriteByte('\b')
+	case 'f':
+		out.WriteByte('\f')
+	case 'v':
+		out.WriteByte('\v')
+	case '0':
+		out.WriteByte(0)
+	case '\\', '"', '\'', '$':
+		out.WriteRune(l.ch)
+	case 'x', 'u', 'U':
+		return l.readHexEscape(out)
+	case 0: // 交给 readString 报告未结束
+	default:
+		return fmt.Sprintf("unknown escape sequence: \\%c", l.ch)
+	}
+	return ""
 }
 
-func (l *Lexer) readNumber() string {
+// \xHH 是一个字节, \uHHHH 和 \UHHHHHHHH 是一个 Unicode 字符
+func (l *Lexer) readHexEscape(out *strings.Builder) string {
+	kind := l.ch
+	n := map[rune]int{'x': 2, 'u': 4, 'U': 8}[kind]
+	var v rune
+	for i := 0; i < n; i++ {
+		d, ok := hexValue(l.peekChar())
+		if !ok {
+			return fmt.Sprintf("invalid escape sequence: \\%c needs %d hex digits", kind, n)
+		}
+		l.readChar()
+		v = v<<4 | d
+	}
+	if kind == 'x' {
+		out.WriteByte(byte(v))
+		return ""
+	}
+	if !utf8.ValidRune(v) {
+		return fmt.Sprintf("invalid Unicode code point in escape sequence: %#x", v)
+	}
+	out.WriteRune(v)
+	return ""
+}
+
+func hexValue(ch rune) (rune, bool) {
+	switch {
+	case '0' <= ch && ch <= '9':
+		return ch - '0', true
+	case 'a' <= ch && ch <= 'f':
+		return ch - 'a' + 10, true
+	case 'A' <= ch && ch <= 'F':
+		return ch - 'A' + 10, true
+	}
+	return 0, false
+}
+
+// 不包含行尾的换行符
+func (l *Lexer) readLineComment() token.Token {
+	start := l.position
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar()
+	}
+	return makeStrCharToken(token.COMMENT, strings.TrimRight(l.input[start:l.position], "\r"))
+}
+
+// 块注释不能嵌套, 结束后当前字符是 `*/` 的 `/`
+func (l *Lexer) readBlockComment() token.Token {
+	start := l.position
+	l.readChar() // *
+	for {
+		l.readChar()
+		switch {
+		case l.ch == 0:
+			return illegalToken(l.input[start:], "unterminated block comment")
+		case l.ch == '*' && l.peekChar() == '/':
+			l.readChar()
+			return makeStrCharToken(token.COMMENT, l.input[start:l.readPosition])
+		}
+	}
+}
+
+// 原始字符串, 不处理转义
+func (l *Lexer) readRawString() token.Token {
+	start := l.position
+	var out strings.Builder
+	for {
+		l.readChar()
+		switch l.ch {
+		case '`':
+			return makeStrCharToken(token.STRING, out.String())
+		case 0:
+			return illegalToken(l.input[start:], "unterminated raw string literal")
+		case '\r':
+		default:
+			out.WriteString(l.input[l.position:l.readPosition])
+		}
+	}
+}
+
+// 整数部分后面跟 `.数字` 或者指数时是 FLOAT
+func (l *Lexer) readNumber() token.Token {
 	position := l.position
-	for isDigit(l.ch) {
+	if l.ch == '0' {
+		switch l.peekChar() {
+		case 'x', 'X':
+			return l.readPrefixedInteger(16, "hexadecimal")
+		case 'o', 'O':
+			return l.readPrefixedInteger(8, "octal")
+		case 'b', 'B':
+			return l.readPrefixedInteger(2, "binary")
+		}
+	}
+	tokType := token.TokenType(token.INT)
+	_, sawSep, _ := l.readDigits(10)
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		tokType = token.FLOAT
 		l.readChar()
+		_, sep, _ := l.readDigits(10)
+		sawSep = sawSep || sep
 	}
-	return l.input[position:l.position]
+	exponentDigits := true
+	if l.ch == 'e' || l.ch == 'E' {
+		tokType = token.FLOAT
+		l.readChar()
+		if l.ch == '+' || l.ch == '-' {
+			l.readChar()
+		}
+		digit, sep, _ := l.readDigits(10)
+		exponentDigits = digit
+		sawSep = sawSep || sep
+	}
+	// 和 0x, 0o, 0b 一样, 紧跟的字母和数字也属于这个字面量, 例如 123abc 不能拆成 123 和 abc
+	var invalid rune
+	for isIdentChar(l.ch) {
+		if invalid == 0 {
+			invalid = l.ch
+		}
+		l.readChar()
+	}
+	literal := l.input[position:l.position]
+	name := "decimal"
+	if tokType == token.FLOAT {
+		name = "float"
+	}
+	switch {
+	case !exponentDigits:
+		return illegalToken(literal, "exponent has no digits")
+	case invalid != 0:
+		return illegalToken(literal, fmt.Sprintf("invalid digit %q in %s literal", invalid, name))
+	case tokType == token.INT && len(literal) > 1 && literal[0] == '0':
+		// 不支持旧的 010 八进制写法, 避免和十进制混淆
+		return illegalToken(literal, "invalid leading zero in decimal literal, use 0o for octal")
+	case sawSep && !validSeparators(literal):
+		return illegalToken(literal, "'_' must separate successive digits")
+	}
+	return makeStrCharToken(tokType, literal)
+}
+
+// 0x, 0o, 0b 开头的整数
+func (l *Lexer) readPrefixedInteger(base int, name string) token.Token {
+	position := l.position
+	l.readChar()
+	l.readChar()
+	sawDigit, sawSep, invalid := l.readDigits(base)
+	// 紧跟的字母和数字也属于这个字面量, 例如 0b1a 不能拆成 0b1 和 a
+	for isIdentChar(l.ch) {
+		if invalid == 0 {
+			invalid = l.ch
+		}
+		l.readChar()
+	}
+	literal := l.input[position:l.position]
+	switch {
+	case invalid != 0:
+		return illegalToken(literal, fmt.Sprintf("invalid digit %q in %s literal", invalid, name))
+	case !sawDigit:
+		return illegalToken(literal, name+" literal has no digits")
+	case sawSep && !validSeparators(literal):
+		return illegalToken(literal, "'_' must separate successive digits")
+	}
+	return makeStrCharToken(token.INT, literal)
+}
+
+// 读取数字和 `_`, 返回是否有数字, 是否有 `_` 以及第一个超出 base 的数字
+func (l *Lexer) readDigits(base int) (sawDigit, sawSep bool, invalid rune) {
+	for {
+		switch d, ok := hexValue(l.ch); {
+		case l.ch == '_':
+			sawSep = true
+		case ok && (isDigit(l.ch) || base == 16):
+			sawDigit = true
+			if int(d) >= base && invalid == 0 {
+				invalid = l.ch
+			}
+		default:
+			return
+		}
+		l.readChar()
+	}
+}
+
+// `_` 只能出现在两个数字之间, 或者 0x, 0o, 0b 前缀和数字之间
+func validSeparators(literal string) bool {
+	hex := false
+	prev := '.' // '0' 表示数字, '_' 表示分隔符, '.' 表示其他字符
+	i := 0
+	if len(literal) >= 2 && literal[0] == '0' && strings.ContainsRune("xXoObB", rune(literal[1])) {
+		hex = literal[1] == 'x' || literal[1] == 'X'
+		prev = '0' // 前缀当做数字
+		i = 2
+	}
+	for _, ch := range literal[i:] {
+		_, isHex := hexValue(ch)
+		switch {
+		case ch == '_':
+			if prev != '0' {
+				return false
+			}
+			prev = '_'
+		case isDigit(ch) || hex && isHex:
+			prev = '0'
+		default:
+			if prev == '_' {
+				return false
+			}
+			prev = '.'
+		}
+	}
+	return prev != '_'
 }
 
 func (l *Lexer) readIdentifier() string {
 	position := l.position
-	for isLetter(l.ch) {
+	for isIdentChar(l.ch) {
 		l.readChar()
 	}
 	return l.input[position:l.position]
@@ -173,10 +569,21 @@ func (l *Lexer) skipWhitespace() {
 	}
 }
 
-func newToken(tokenType token.TokenType, ch byte) token.Token {
+// 由当前字符和下一个字符组成的 token
+func (l *Lexer) readTwoCharToken(tokenType token.TokenType) token.Token {
+	preCh := l.ch
+	l.readChar()
+	return makeStrCharToken(tokenType, string(preCh)+string(l.ch))
+}
+
+func newToken(tokenType token.TokenType, ch rune) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
 
 func makeStrCharToken(tokenType token.TokenType, str string) token.Token {
 	return token.Token{Type: tokenType, Literal: str}
 }
+
+func illegalToken(literal, msg string) token.Token {
+	return token.Token{Type: token.ILLEGAL, Literal: literal, Msg: msg}
+}
@@ -12,110 +12,137 @@ import (
 )
 
 var tokenTables = []token.Token{
-	{token.LET, "let"},
-	{token.IDENT, "five"},
-	{token.ASSIGN, "="},
-	{token.INT, "5"},
-	{token.SEMICOLON, ";"},
-	{token.LET, "let"},
-	{token.IDENT, "ten"},
-	{token.ASSIGN, "="},
-	{token.INT, "10"},
-	{token.SEMICOLON, ";"},
-	{token.LET, "let"},
-	{token.IDENT, "add"},
-	{token.ASSIGN, "="},
-	{token.FUNCTION, "fn"},
-	{token.LPAREN, "("},
-	{token.IDENT, "x"},
-	{token.COMMA, ","},
-	{token.IDENT, "y"},
-	{token.RPAREN, ")"},
-	{token.LBRACE, "{"},
-	{token.IDENT, "x"},
-	{token.PLUS, "+"},
-	{token.IDENT, "y"},
-	{token.SEMICOLON, ";"},
-	{token.RBRACE, "}"},
-	{token.SEMICOLON, ";"},
-	{token.LET, "let"},
-	{token.IDENT, "result"},
-	{token.ASSIGN, "="},
-	{token.IDENT, "add"},
-	{token.LPAREN, "("},
-	{token.IDENT, "five"},
-	{token.COMMA, ","},
-	{token.IDENT, "ten"},
-	{token.RPAREN, ")"},
-	{token.SEMICOLON, ";"},
-
-	{token.BANG, "!"},
-	{token.MINUS, "-"},
-	{token.SLASH, "/"},
-	{token.ASTERISK, "*"},
-	{token.INT, "5"},
-	{token.SEMICOLON, ";"},
-	{token.INT, "5"},
-	{token.LT, "<"},
-	{token.INT, "10"},
-	{token.GT, ">"},
-	{token.INT, "5"},
-	{token.SEMICOLON, ";"},
-
-	{token.IF, "if"},
-	{token.LPAREN, "("},
-	{token.INT, "5"},
-	{token.LT, "<"},
-	{token.INT, "10"},
-	{token.RPAREN, ")"},
-	{token.LBRACE, "{"},
-	{token.RETURN, "return"},
-	{token.TRUE, "true"},
-	{token.SEMICOLON, ";"},
-	{token.RBRACE, "}"},
-	{token.ELSE, "else"},
-	{token.LBRACE, "{"},
-	{token.RETURN, "return"},
-	{token.FALSE, "false"},
-	{token.SEMICOLON, ";"},
-	{token.RBRACE, "}"},
-
-	{token.INT, "10"},
-	{token.EQ, "=="},
-	{token.INT, "10"},
-	{token.SEMICOLON, ";"},
-	{token.INT, "10"},
-	{token.NOT_EQ, "!="},
-	{token.INT, "9"},
-	{token.SEMICOLON, ";"},
+	{Type: token.LET, Literal: "let"},
+	{Type: token.IDENT, Literal: "five"},
+	{Type: token.ASSIGN, Literal: "="},
+	{Type: token.INT, Literal: "5"},
+	{Type: token.SEMICOLON, Literal: ";"},
+	{Type: token.LET, Literal: "let"},
+	{Type: token.IDENT, Literal: "ten"},
+	{Type: token.ASSIGN, Literal: "="},
+	{Type: token.INT, Literal: "10"},
+	{Type: token.SEMICOLON, Literal: ";"},
+	{Type: token.LET, Literal: "let"},
+	{Type: token.IDENT, Literal: "add"},
+	{Type: token.ASSIGN, Literal: "="},
+	{Type: token.FUNCTION, Literal: "fn"},
+	{Type: token.LPAREN, Literal: "("},
+	{Type: token.IDENT, Literal: "x"},
+	{Type: token.COMMA, Literal: ","},
+	{Type: token.IDENT, Literal: "y"},
+	{Type: token.RPAREN, Literal: ")"},
+	{Type: token.LBRACE, Literal: "{"},
+	{Type: token.IDENT, Literal: "x"},
+	{Type: token.PLUS, Literal: "+"},
+	{Type: token.IDENT, Literal: "y"},
+	{Type: token.SEMICOLON, Literal: ";"},
+	{Type: token.RBRACE, Literal: "}"},
+	{Type: token.SEMICOLON, Literal: ";"},
+	{Type: token.LET, Literal: "let"},
+	{Type: token.IDENT, Literal: "result"},
+	{Type: token.ASSIGN, Literal: "="},
+	{Type: token.IDENT, Literal: "add"},
+	{Type: token.LPAREN, Literal: "("},
+	{Type: token.IDENT, Literal: "five"},
+	{Type: token.COMMA, Literal: ","},
+	{Type: token.IDENT, Literal: "ten"},
+	{Type: token.RPAREN, Literal: ")"},
+	{Type: token.SEMICOLON, Literal: ";"},
+
+	{Type: token.BANG, Literal: "!"},
+	{Type: token.MINUS, Literal: "-"},
+	{Type: token.SLASH, Literal: "/"},
+	{Type: token.ASTERISK, Literal: "*"},
+	{Type: token.INT, Literal: "5"},
+	{Type: token.SEMICOLON, Literal: ";"},
+	{Type: token.INT, Literal: "5"},
+	{Type: token.LT, Literal: "<"},
+	{Type: token.INT, Literal: "10"},
+	{Type: token.GT, Literal: ">"},
+	{Type: token.INT, Literal: "5"},
+	{Type: token.SEMICOLON, Literal: ";"},
+
+	{Type: token.IF, Literal: "if"},
+	{Type: token.LPAREN, Literal: "("},
+	{Type: token.INT, Literal: "5"},
+	{Type: token.LT, Literal: "<"},
+	{Type: token.INT, Literal: "10"},
+	{Type: token.RPAREN, Literal: ")"},
+	{Type: token.LBRACE, Literal: "{"},
+	{Type: token.RETURN, Literal: "return"},
+	{Type: token.TRUE, Literal: "true"},
+	{Type: token.SEMICOLON, Literal: ";"},
+	{Type: token.RBRACE, Literal: "}"},
+	{Type: token.ELSE, Literal: "else"},
+	{Type: token.LBRACE, Literal: "{"},
+	{Type: token.RETURN, Literal: "return"},
+	{Type: token.FALSE, Literal: "false"},
+	{Type: token.SEMICOLON, Literal: ";"},
+	{Type: token.RBRACE, Literal: "}"},
+
+	{Type: token.INT, Literal: "10"},
+	{Type: token.EQ, Literal: "=="},
+	{Type: token.INT, Literal: "10"},
+	{Type: token.SEMICOLON, Literal: ";"},
+	{Type: token.INT, Literal: "10"},
+	{Type: token.NOT_EQ, Literal: "!="},
+	{Type: token.INT, Literal: "9"},
+	{Type: token.SEMICOLON, Literal: ";"},
 	//5 <= 5 >= 5;
-	{token.INT, "5"},
-	{token.LEQ, "<="},
-	{token.INT, "5"},
-	{token.GEQ, ">="},
-	{token.INT, "5"},
-	{token.SEMICOLON, ";"},
+	{Type: token.INT, Literal: "5"},
+	{Type: token.LEQ, Literal: "<="},
+	{Type: token.INT, Literal: "5"},
+	{Type: token.GEQ, Literal: ">="},
+	{Type: token.INT, Literal: "5"},
+	{Type: token.SEMICOLON, Literal: ";"},
 
-	{token.STRING, "foobar"},
-	{token.STRING, "foo bar"},
+	{Type: token.STRING, Literal: "foobar"},
+	{Type: token.STRING, Literal: "foo bar"},
 
 	// array
-	{token.LBRACKET, "["},
-	{token.INT, "1"},
-	{token.COMMA, ","},
-	{token.INT, "2"},
-	{token.RBRACKET, "]"},
-	{token.SEMICOLON, ";"},
+	{Type: token.LBRACKET, Literal: "["},
+	{Type: token.INT, Literal: "1"},
+	{Type: token.COMMA, Literal: ","},
+	{Type: token.INT, Literal: "2"},
+	{Type: token.RBRACKET, Literal: "]"},
+	{Type: token.SEMICOLON, Literal: ";"},
 
 	// hashtable
-	{token.HASH, "hash"},
-	{token.LBRACE, "{"},
-	{token.STRING, "foo"},
-	{token.COLON, ":"},
-	{token.STRING, "bar"},
-	{token.RBRACE, "}"},
-
-	{token.EOF, ""},
+	{Type: token.HASH, Literal: "hash"},
+	{Type: token.LBRACE, Literal: "{"},
+	{Type: token.STRING, Literal: "foo"},
+	{Type: token.COLON, Literal: ":"},
+	{Type: token.STRING, Literal: "bar"},
+	{Type: token.RBRACE, Literal: "}"},
+
+	// float, `1.e` 不是 float, `2e` 的指数没有数字
+	{Type: token.FLOAT, Literal: "3.14"},
+	{Type: token.FLOAT, Literal: "1e-9"},
+	{Type: token.FLOAT, Literal: "2.5E+3"},
+	{Type: token.FLOAT, Literal: "7e10"},
+	{Type: token.INT, Literal: "1"},
+	{Type: token.ILLEGAL, Literal: "."},
+	{Type: token.IDENT, Literal: "e"},
+	{Type: token.ILLEGAL, Literal: "2e"},
+	{Type: token.SEMICOLON, Literal: ";"},
+
+	// 逻辑, 位运算, 取模和幂
+	{Type: token.AND, Literal: "&&"},
+	{Type: token.OR, Literal: "||"},
+	{Type: token.PERCENT, Literal: "%"},
+	{Type: token.BIT_AND, Literal: "&"},
+	{Type: token.BIT_OR, Literal: "|"},
+	{Type: token.BIT_XOR, Literal: "^"},
+	{Type: token.SHL, Literal: "<<"},
+	{Type: token.SHR, Literal: ">>"},
+	{Type: token.POW, Literal: "**"},
+	{Type: token.ASTERISK, Literal: "*"},
+	{Type: token.LT, Literal: "<"},
+	{Type: token.GT, Literal: ">"},
+	{Type: token.LEQ, Literal: "<="},
+	{Type: token.SEMICOLON, Literal: ";"},
+
+	{Type: token.EOF, Literal: ""},
 }
 
 var input = `
@@ -126,7 +153,7 @@ let add = fn(x, y) {
 };
 let result = add(five, ten);
 
-!-/*5;
+!-/ *5;
 5 < 10 > 5;
 
 if (5 < 10) {
@@ -144,6 +171,8 @@ return false;
 "foo bar"
 [1, 2];
 hash{"foo": "bar"}
+3.14 1e-9 2.5E+3 7e10 1.e 2e;
+&& || % & | ^ << >> ** * < > <=;
 `
 
 // mock出来的Lexer
@@ -200,6 +229,320 @@ func TestNextToken(t *testing.T) {
 	}
 }
 
+func TestTokenPosition(t *testing.T) {
+	input := "let x = 5;\n  x + \"ab\""
+	tests := []struct {
+		expectedType token.TokenType
+		expectedPos  token.Position
+		expectedEnd  token.Position
+	}{
+		{token.LET, token.Position{Offset: 0, Line: 1, Column: 1}, token.Position{Offset: 3, Line: 1, Column: 4}},
+		{token.IDENT, token.Position{Offset: 4, Line: 1, Column: 5}, token.Position{Offset: 5, Line: 1, Column: 6}},
+		{token.ASSIGN, token.Position{Offset: 6, Line: 1, Column: 7}, token.Position{Offset: 7, Line: 1, Column: 8}},
+		{token.INT, token.Position{Offset: 8, Line: 1, Column: 9}, token.Position{Offset: 9, Line: 1, Column: 10}},
+		{token.SEMICOLON, token.Position{Offset: 9, Line: 1, Column: 10}, token.Position{Offset: 10, Line: 1, Column: 11}},
+		{token.IDENT, token.Position{Offset: 13, Line: 2, Column: 3}, token.Position{Offset: 14, Line: 2, Column: 4}},
+		{token.PLUS, token.Position{Offset: 15, Line: 2, Column: 5}, token.Position{Offset: 16, Line: 2, Column: 6}},
+		{token.STRING, token.Position{Offset: 17, Line: 2, Column: 7}, token.Position{Offset: 21, Line: 2, Column: 11}},
+		{token.EOF, token.Position{Offset: 21, Line: 2, Column: 11}, token.Position{Offset: 21, Line: 2, Column: 11}},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Pos != tt.expectedPos {
+			t.Errorf("tests[%d] - pos wrong. expected=%+v, got=%+v",
+				i, tt.expectedPos, tok.Pos)
+		}
+		if tok.End != tt.expectedEnd {
+			t.Errorf("tests[%d] - end wrong. expected=%+v, got=%+v",
+				i, tt.expectedEnd, tok.End)
+		}
+	}
+
+	tok := NewFile("main.xq", "\n\n  foo").NextToken()
+	if tok.Pos.String() != "main.xq:3:3" {
+		t.Errorf("pos string wrong. got=%q", tok.Pos.String())
+	}
+}
+
+func TestUnicode(t *testing.T) {
+	// 列号按字符计数, Offset 是字节偏移
+	input := "let 名字 = \"你好\";\nx1 + 变量_2 € \xff"
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedPos     token.Position
+		expectedEnd     token.Position
+	}{
+		{token.LET, "let", token.Position{Offset: 0, Line: 1, Column: 1}, token.Position{Offset: 3, Line: 1, Column: 4}},
+		{token.IDENT, "名字", token.Position{Offset: 4, Line: 1, Column: 5}, token.Position{Offset: 10, Line: 1, Column: 7}},
+		{token.ASSIGN, "=", token.Position{Offset: 11, Line: 1, Column: 8}, token.Position{Offset: 12, Line: 1, Column: 9}},
+		{token.STRING, "你好", token.Position{Offset: 13, Line: 1, Column: 10}, token.Position{Offset: 21, Line: 1, Column: 14}},
+		{token.SEMICOLON, ";", token.Position{Offset: 21, Line: 1, Column: 14}, token.Position{Offset: 22, Line: 1, Column: 15}},
+		{token.IDENT, "x1", token.Position{Offset: 23, Line: 2, Column: 1}, token.Position{Offset: 25, Line: 2, Column: 3}},
+		{token.PLUS, "+", token.Position{Offset: 26, Line: 2, Column: 4}, token.Position{Offset: 27, Line: 2, Column: 5}},
+		{token.IDENT, "变量_2", token.Position{Offset: 28, Line: 2, Column: 6}, token.Position{Offset: 36, Line: 2, Column: 10}},
+		{token.ILLEGAL, "€", token.Position{Offset: 37, Line: 2, Column: 11}, token.Position{Offset: 40, Line: 2, Column: 12}},
+		{token.ILLEGAL, "\xff", token.Position{Offset: 41, Line: 2, Column: 13}, token.Position{Offset: 42, Line: 2, Column: 14}},
+		{token.EOF, "", token.Position{Offset: 42, Line: 2, Column: 14}, token.Position{Offset: 42, Line: 2, Column: 14}},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - token wrong. expected=%q %q, got=%q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+		if tok.Pos != tt.expectedPos {
+			t.Errorf("tests[%d] - pos wrong. expected=%+v, got=%+v",
+				i, tt.expectedPos, tok.Pos)
+		}
+		if tok.End != tt.expectedEnd {
+			t.Errorf("tests[%d] - end wrong. expected=%+v, got=%+v",
+				i, tt.expectedEnd, tok.End)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedMsg     string
+	}{
+		{`"a\nb\t\r\\\"'"`, token.STRING, "a\nb\t\r\\\"'", ""},
+		{`"\a\b\f\v\0\'"`, token.STRING, "\a\b\f\v\x00'", ""},
+		{`"\x41\xff\u4e2d\U0001F600"`, token.STRING, "A\xff中😀", ""},
+		{`"你好\n"`, token.STRING, "你好\n", ""},
+		{"\"two\nlines\"", token.STRING, "two\nlines", ""},
+		{"`raw\\n\r\n\"x\"`", token.STRING, "raw\\n\n\"x\"", ""},
+		{"``", token.STRING, "", ""},
+		{`"abc`, token.ILLEGAL, `"abc`, "unterminated string literal"},
+		{`"abc\`, token.ILLEGAL, `"abc\`, "unterminated string literal"},
+		{"`abc", token.ILLEGAL, "`abc", "unterminated raw string literal"},
+		{`"a\qb"`, token.ILLEGAL, `"a\qb"`, `unknown escape sequence: \q`},
+		{`"\x4g"`, token.ILLEGAL, `"\x4g"`, `invalid escape sequence: \x needs 2 hex digits`},
+		{`"\u12"`, token.ILLEGAL, `"\u12"`, `invalid escape sequence: \u needs 4 hex digits`},
+		{`"\U00110000"`, token.ILLEGAL, `"\U00110000"`, "invalid Unicode code point in escape sequence: 0x110000"},
+		{"@", token.ILLEGAL, "@", "illegal character '@'"},
+		{"\xff", token.ILLEGAL, "\xff", "invalid UTF-8 encoding"},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral || tok.Msg != tt.expectedMsg {
+			t.Errorf("tests[%d] - token wrong. expected=%q %q %q, got=%q %q %q", i,
+				tt.expectedType, tt.expectedLiteral, tt.expectedMsg, tok.Type, tok.Literal, tok.Msg)
+		}
+		if next := l.NextToken(); next.Type != token.EOF {
+			t.Errorf("tests[%d] - expected EOF, got=%q %q", i, next.Type, next.Literal)
+		}
+	}
+}
+
+func TestNumber(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedMsg     string
+	}{
+		{"0x1F", token.INT, "0x1F", ""},
+		{"0XABCdef", token.INT, "0XABCdef", ""},
+		{"0o17", token.INT, "0o17", ""},
+		{"0B1010", token.INT, "0B1010", ""},
+		{"1_000_000", token.INT, "1_000_000", ""},
+		{"0x_1F", token.INT, "0x_1F", ""},
+		{"1_000.000_1e1_0", token.FLOAT, "1_000.000_1e1_0", ""},
+		{"0", token.INT, "0", ""},
+		{"0x", token.ILLEGAL, "0x", "hexadecimal literal has no digits"},
+		{"0o_", token.ILLEGAL, "0o_", "octal literal has no digits"},
+		{"0b", token.ILLEGAL, "0b", "binary literal has no digits"},
+		{"0b2", token.ILLEGAL, "0b2", "invalid digit '2' in binary literal"},
+		{"0o789", token.ILLEGAL, "0o789", "invalid digit '8' in octal literal"},
+		{"0o9", token.ILLEGAL, "0o9", "invalid digit '9' in octal literal"},
+		{"0b1a", token.ILLEGAL, "0b1a", "invalid digit 'a' in binary literal"},
+		{"0x1g", token.ILLEGAL, "0x1g", "invalid digit 'g' in hexadecimal literal"},
+		{"0o7_z9", token.ILLEGAL, "0o7_z9", "invalid digit 'z' in octal literal"},
+		{"0b1_x", token.ILLEGAL, "0b1_x", "invalid digit 'x' in binary literal"},
+		{"0xg", token.ILLEGAL, "0xg", "invalid digit 'g' in hexadecimal literal"},
+		{"0b1+1", token.INT, "0b1", ""},
+		{"1__0", token.ILLEGAL, "1__0", "'_' must separate successive digits"},
+		{"1_", token.ILLEGAL, "1_", "'_' must separate successive digits"},
+		{"0x1F_", token.ILLEGAL, "0x1F_", "'_' must separate successive digits"},
+		{"1_.5", token.ILLEGAL, "1_.5", "'_' must separate successive digits"},
+		{"1.5_e3", token.ILLEGAL, "1.5_e3", "'_' must separate successive digits"},
+		{"1e3", token.FLOAT, "1e3", ""},
+		{"2.5E-3", token.FLOAT, "2.5E-3", ""},
+		{"1e", token.ILLEGAL, "1e", "exponent has no digits"},
+		{"1e+", token.ILLEGAL, "1e+", "exponent has no digits"},
+		{"1.5E-", token.ILLEGAL, "1.5E-", "exponent has no digits"},
+		{"1e_", token.ILLEGAL, "1e_", "exponent has no digits"},
+		{"1ex", token.ILLEGAL, "1ex", "exponent has no digits"},
+		{"123abc", token.ILLEGAL, "123abc", "invalid digit 'a' in decimal literal"},
+		{"1_2x_3", token.ILLEGAL, "1_2x_3", "invalid digit 'x' in decimal literal"},
+		{"1.5f", token.ILLEGAL, "1.5f", "invalid digit 'f' in float literal"},
+		{"1e5x", token.ILLEGAL, "1e5x", "invalid digit 'x' in float literal"},
+		{"010", token.ILLEGAL, "010", "invalid leading zero in decimal literal, use 0o for octal"},
+		{"09", token.ILLEGAL, "09", "invalid leading zero in decimal literal, use 0o for octal"},
+		{"0_1", token.ILLEGAL, "0_1", "invalid leading zero in decimal literal, use 0o for octal"},
+		{"0.5", token.FLOAT, "0.5", ""},
+		{"0e1", token.FLOAT, "0e1", ""},
+		{"1+a", token.INT, "1", ""},
+		{"1.a", token.INT, "1", ""},
+	}
+
+	for i, tt := range tests {
+		tok := New(tt.input).NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral || tok.Msg != tt.expectedMsg {
+			t.Errorf("tests[%d] - token wrong. expected=%q %q %q, got=%q %q %q", i,
+				tt.expectedType, tt.expectedLiteral, tt.expectedMsg, tok.Type, tok.Literal, tok.Msg)
+		}
+	}
+}
+
+func TestEllipsis(t *testing.T) {
+	input := "fn(...a) { f(...a, .. .) }"
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.FUNCTION, "fn"},
+		{token.LPAREN, "("},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "a"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.IDENT, "f"},
+		{token.LPAREN, "("},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "a"},
+		{token.COMMA, ","},
+		{token.ILLEGAL, "."},
+		{token.ILLEGAL, "."},
+		{token.ILLEGAL, "."},
+		{token.RPAREN, ")"},
+		{token.RBRACE, "}"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - token wrong. expected=%q %q, got=%q %q", i,
+				tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := "#!/usr/bin/env xq\r\nlet a = 1; // 行注释\r\n/* 块\n注释 */ a / 2 /**/ # \n/* 未结束"
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.COMMENT, "#!/usr/bin/env xq"},
+		{token.LET, "let"},
+		{token.IDENT, "a"},
+		{token.ASSIGN, "="},
+		{token.INT, "1"},
+		{token.SEMICOLON, ";"},
+		{token.COMMENT, "// 行注释"},
+		{token.COMMENT, "/* 块\n注释 */"},
+		{token.IDENT, "a"},
+		{token.SLASH, "/"},
+		{token.INT, "2"},
+		{token.COMMENT, "/**/"},
+		{token.ILLEGAL, "#"},
+		{token.ILLEGAL, "/* 未结束"},
+		{token.EOF, ""},
+	}
+
+	Convey("TestComments", t, func() {
+		Convey("ScanComments", func() {
+			l := New(input)
+			l.SetMode(ScanComments)
+			for _, tt := range tests {
+				tok := l.NextToken()
+				So(tok.Type, ShouldEqual, tt.expectedType)
+				So(tok.Literal, ShouldEqual, tt.expectedLiteral)
+			}
+		})
+		Convey("默认跳过注释", func() {
+			l := New(input)
+			for _, tt := range tests {
+				if tt.expectedType == token.COMMENT {
+					continue
+				}
+				tok := l.NextToken()
+				So(tok.Type, ShouldEqual, tt.expectedType)
+				So(tok.Literal, ShouldEqual, tt.expectedLiteral)
+			}
+		})
+		Convey("注释的位置", func() {
+			l := New("a /* x */ // y")
+			l.SetMode(ScanComments)
+			l.NextToken()
+			tok := l.NextToken()
+			So(tok.Pos, ShouldResemble, token.Position{Offset: 2, Line: 1, Column: 3})
+			So(tok.End, ShouldResemble, token.Position{Offset: 9, Line: 1, Column: 10})
+			tok = l.NextToken()
+			So(tok.Pos, ShouldResemble, token.Position{Offset: 10, Line: 1, Column: 11})
+			So(tok.End, ShouldResemble, token.Position{Offset: 14, Line: 1, Column: 15})
+		})
+	})
+}
+
+func TestInterpolation(t *testing.T) {
+	input := `"Hello ${name}, total ${a + b}!" "${hash{"k": "${x}"}["k"]}" "\${x} $y"`
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INTERP_HEAD, "Hello "},
+		{token.IDENT, "name"},
+		{token.INTERP_MIDDLE, ", total "},
+		{token.IDENT, "a"},
+		{token.PLUS, "+"},
+		{token.IDENT, "b"},
+		{token.INTERP_TAIL, "!"},
+		// 插值中的 {} 和嵌套的插值
+		{token.INTERP_HEAD, ""},
+		{token.HASH, "hash"},
+		{token.LBRACE, "{"},
+		{token.STRING, "k"},
+		{token.COLON, ":"},
+		{token.INTERP_HEAD, ""},
+		{token.IDENT, "x"},
+		{token.INTERP_TAIL, ""},
+		{token.RBRACE, "}"},
+		{token.LBRACKET, "["},
+		{token.STRING, "k"},
+		{token.RBRACKET, "]"},
+		{token.INTERP_TAIL, ""},
+		{token.STRING, "${x} $y"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - token wrong. expected=%q %q, got=%q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
 // ===== GoConvey的例子 ====
 
 func TestStringSliceEqual(t *testing.T) {
@@ -1,18 +1,27 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"github.com/qiuhoude/go-interpreter/repl"
 	"os"
 	"os/user"
 )
 
+var engine = flag.String("engine", "eval", "use 'vm' or 'eval'")
+
 func main() {
+	flag.Parse()
+
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
 	}
 	fmt.Printf("Hello %s! This is the XIQI programming language!\n", user.Username)
 	fmt.Printf("Feel free to type in commands\n")
-	repl.Start(os.Stdin, os.Stdout)
+	if *engine == "vm" {
+		repl.StartVM(os.Stdin, os.Stdout)
+	} else {
+		repl.Start(os.Stdin, os.Stdout)
+	}
 }
@@ -39,6 +39,11 @@ func GlobalEnv() Environment {
 	return gEnv
 }
 
+// 创建一个独立的全局 env, 与 GlobalEnv() 互不影响
+func NewGlobalEnv() Environment {
+	return &globalEnv{make(map[string]Object)}
+}
+
 // localEnv
 type localEnv struct {
 	Environment // parent
@@ -0,0 +1,150 @@
+package object
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"unicode/utf8"
+)
+
+/*
+迭代协议, for-in 通过它遍历对象
+实现了 Iterable 的对象都可以用在 for (v in obj) 或者 for (k, v in obj) 中,
+宿主程序提供的集合类型实现 Iterable 即可被脚本遍历
+*/
+
+type Iterable interface {
+	Iter() Iterator
+}
+
+type Iterator interface {
+	// 返回下一个元素, key 是下标或者 hash 的键. 没有更多元素时 ok 为 false
+	Next() (key, value Object, ok bool)
+}
+
+// array, key 是下标
+type arrayIterator struct {
+	elements []Object
+	idx      int
+}
+
+func (it *arrayIterator) Next() (Object, Object, bool) {
+	if it.idx >= len(it.elements) {
+		return nil, nil, false
+	}
+	key := NewInteger(int64(it.idx))
+	it.idx++
+	return key, it.elements[it.idx-1], true
+}
+
+func (a *Array) Iter() Iterator {
+	return &arrayIterator{elements: a.Elements}
+}
+
+// string, 按 rune 逐个字符遍历, key 是字符的下标
+type stringIterator struct {
+	value  string
+	offset int // 下一个字符的字节偏移
+	idx    int
+}
+
+func (it *stringIterator) Next() (Object, Object, bool) {
+	if it.offset >= len(it.value) {
+		return nil, nil, false
+	}
+	r, size := utf8.DecodeRuneInString(it.value[it.offset:])
+	key := NewInteger(int64(it.idx))
+	it.offset += size
+	it.idx++
+	return key, &String{Value: string(r)}, true
+}
+
+func (s *String) Iter() Iterator {
+	return &stringIterator{value: s.Value}
+}
+
+// hash, 按键排序后遍历, 保证每次的顺序一致
+type hashIterator struct {
+	pairs []HashPair
+	idx   int
+}
+
+func (it *hashIterator) Next() (Object, Object, bool) {
+	if it.idx >= len(it.pairs) {
+		return nil, nil, false
+	}
+	pair := it.pairs[it.idx]
+	it.idx++
+	return pair.Key, pair.Value, true
+}
+
+func (h *Hash) Iter() Iterator {
+	return &hashIterator{pairs: h.sortedPairs()}
+}
+
+func (h *Hash) sortedPairs() []HashPair {
+	pairs := make([]HashPair, 0, len(h.Pairs))
+	for _, pair := range h.Pairs {
+		pairs = append(pairs, pair)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return lessKey(pairs[i].Key, pairs[j].Key)
+	})
+	return pairs
+}
+
+// 不同类型的键按类型名排序, 同类型按值排序
+func lessKey(a, b Object) bool {
+	if a.Type() != b.Type() {
+		return a.Type() < b.Type()
+	}
+	switch a := a.(type) {
+	case *Integer:
+		return a.Value < b.(*Integer).Value
+	case *Float:
+		return a.Value < b.(*Float).Value
+	case *BigInt:
+		return a.Value.Cmp(b.(*BigInt).Value) < 0
+	case *Boolean:
+		return !a.Value && b.(*Boolean).Value
+	}
+	return a.Inspect() < b.Inspect()
+}
+
+// 整数区间 [Start, End), 惰性生成, 不占用内存
+type Range struct {
+	Start int64
+	End   int64
+	Step  int64
+}
+
+func (r *Range) Type() ObjectType { return RANGE_OBJ }
+func (r *Range) Inspect() string {
+	return fmt.Sprintf("range(%d, %d, %d)", r.Start, r.End, r.Step)
+}
+
+type rangeIterator struct {
+	r    *Range
+	next int64
+	idx  int64
+	done bool
+}
+
+func (it *rangeIterator) Next() (Object, Object, bool) {
+	step := it.r.Step
+	if it.done || (step > 0 && it.next >= it.r.End) || (step < 0 && it.next <= it.r.End) {
+		return nil, nil, false
+	}
+	key, value := NewInteger(it.idx), NewInteger(it.next)
+	// 下一个值溢出时结束, 避免回绕成死循环
+	if (step > 0 && it.next > math.MaxInt64-step) || (step < 0 && it.next < math.MinInt64-step) {
+		it.done = true
+	}
+	it.idx++
+	it.next += step
+	return key, value, true
+}
+
+func (r *Range) Iter() Iterator {
+	return &rangeIterator{r: r, next: r.Start}
+}
@@ -4,16 +4,27 @@ import (
 	"bytes"
 	"fmt"
 	"github.com/qiuhoude/go-interpreter/ast"
+	"github.com/qiuhoude/go-interpreter/code"
+	"github.com/qiuhoude/go-interpreter/token"
 	"hash/fnv"
+	"math"
+	"math/big"
+	"strconv"
 	"strings"
+	"sync/atomic"
 )
 
 type ObjectType string
 
 type BuiltinFunction func(args ...Object) Object
 
+// 接收命名参数的内建函数, 没有命名参数时 named 为 nil
+type NamedBuiltinFunction func(args []Object, named map[string]Object) Object
+
 const (
 	INTEGER_OBJ      ObjectType = "INTEGER"
+	FLOAT_OBJ        ObjectType = "FLOAT"
+	BIGINT_OBJ       ObjectType = "BIGINT"
 	BOOLEAN_OBJ      ObjectType = "BOOLEAN"
 	NULL_OBJ         ObjectType = "NULL"
 	RETURN_VALUE_OBJ ObjectType = "RETURN_VALUE"
@@ -23,6 +34,12 @@ const (
 	BUILTIN_OBJ      ObjectType = "BUILTIN"
 	ARRAY_OBJ        ObjectType = "ARRAY"
 	HASH_OBJ         ObjectType = "HASH"
+	RANGE_OBJ        ObjectType = "RANGE"
+
+	COMPILED_FUNCTION_OBJ ObjectType = "COMPILED_FUNCTION"
+
+	BREAK_OBJ    ObjectType = "BREAK"
+	CONTINUE_OBJ ObjectType = "CONTINUE"
 )
 
 type Object interface {
@@ -42,23 +59,52 @@ type HashKey struct {
 //	HashKey() HashKey
 //}
 
+// 第一次使用时计算并缓存 hash key.
+// 宿主可以把同一个对象交给多个解释器并发使用, 所以用 atomic 保存, 并发计算的结果是相同的
 type cacheHashKey struct {
-	key *HashKey
+	key atomic.Value // HashKey
 }
 
 func (c *cacheHashKey) hashKey(keyCreateFn func() *HashKey) HashKey {
-	if c.key == nil {
-		c.key = keyCreateFn()
+	if key, ok := c.key.Load().(HashKey); ok {
+		return key
 	}
-	return *c.key
+	key := *keyCreateFn()
+	c.key.Store(key)
+	return key
 }
 
 // integer
+// Integer, Float, BigInt, String, Boolean 创建之后不能修改, 运算总是返回新的对象,
+// 因此同一个对象可以被多个变量, 常量池和 hash 的键共享
 type Integer struct {
 	cacheHashKey
 	Value int64
 }
 
+// 缓存的小整数范围, 循环计数和下标等常用的值不需要每次分配
+const (
+	minCachedInt = -128
+	maxCachedInt = 1024
+)
+
+var smallInts = func() []*Integer {
+	ints := make([]*Integer, maxCachedInt-minCachedInt+1)
+	for i := range ints {
+		ints[i] = &Integer{Value: int64(i + minCachedInt)}
+		ints[i].HashKey() // 提前计算好, 之后只读, 可以被多个解释器并发使用
+	}
+	return ints
+}()
+
+// 小整数返回缓存的对象
+func NewInteger(value int64) *Integer {
+	if value >= minCachedInt && value <= maxCachedInt {
+		return smallInts[value-minCachedInt]
+	}
+	return &Integer{Value: value}
+}
+
 func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
 func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
 func (i *Integer) HashKey() HashKey {
@@ -67,25 +113,74 @@ func (i *Integer) HashKey() HashKey {
 	})
 }
 
+// float
+type Float struct {
+	cacheHashKey
+	Value float64
+}
+
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") { // 整数值也带上小数点, 与 Integer 区分. 排除 1e+21, +Inf, NaN
+		s += ".0"
+	}
+	return s
+}
+
+// 值为整数的 float 与对应的 integer 是同一个键, 与 1 == 1.0 保持一致
+func (f *Float) HashKey() HashKey {
+	return f.hashKey(func() *HashKey {
+		if f.Value == math.Trunc(f.Value) && f.Value >= math.MinInt64 && f.Value < math.MaxInt64 {
+			return &HashKey{Type: INTEGER_OBJ, Value: uint64(int64(f.Value))}
+		}
+		if !math.IsInf(f.Value, 0) && f.Value == math.Trunc(f.Value) { // 超出 int64 的整数值与 BigInt 一致
+			i, _ := big.NewFloat(f.Value).Int(nil)
+			return bigHashKey(i)
+		}
+		return &HashKey{Type: f.Type(), Value: math.Float64bits(f.Value)}
+	})
+}
+
+// 任意精度的整数, 只用于 int64 放不下的值, 运算结果能放进 int64 时会变回 Integer
+type BigInt struct {
+	cacheHashKey
+	Value *big.Int
+}
+
+func (b *BigInt) Type() ObjectType { return BIGINT_OBJ }
+func (b *BigInt) Inspect() string  { return b.Value.String() }
+func (b *BigInt) HashKey() HashKey {
+	return b.hashKey(func() *HashKey {
+		return bigHashKey(b.Value)
+	})
+}
+
+// 能放进 int64 时与 Integer 的键相同
+func bigHashKey(v *big.Int) *HashKey {
+	if v.IsInt64() {
+		return &HashKey{Type: INTEGER_OBJ, Value: uint64(v.Int64())}
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte{byte(v.Sign() + 1)})
+	_, _ = h.Write(v.Bytes())
+	return &HashKey{Type: BIGINT_OBJ, Value: h.Sum64()}
+}
+
 // boolean
+// TRUE 和 FALSE 是所有解释器共享的单例, 不缓存 hash key, 避免并发写
 type Boolean struct {
-	cacheHashKey
 	Value bool
 }
 
 func (b *Boolean) Type() ObjectType { return BOOLEAN_OBJ }
 func (b *Boolean) Inspect() string  { return fmt.Sprintf("%v", b.Value) }
 func (b *Boolean) HashKey() HashKey {
-	return b.hashKey(func() *HashKey {
-		var value uint64
-		if b.Value {
-			value = 1
-		} else {
-			value = 0
-		}
-		return &HashKey{Type: b.Type(), Value: value}
-	})
-
+	var value uint64
+	if b.Value {
+		value = 1
+	}
+	return HashKey{Type: b.Type(), Value: value}
 }
 
 // null
@@ -102,31 +197,132 @@ type ReturnValue struct {
 func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
 func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 
+// 错误的种类, 宿主程序可以据此区分脚本错误和资源限制
+type ErrorKind int
+
+const (
+	RuntimeError          ErrorKind = iota // 普通的运行时错误
+	CanceledError                          // context 被取消
+	DeadlineExceededError                  // context 超时
+	StepLimitError                         // 超过求值步数限制
+	CallDepthError                         // 超过调用深度限制
+	AllocLimitError                        // 超过分配元素数限制
+	InternalError                          // 解释器内部的 panic, 不能被 catch
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case CanceledError:
+		return "canceled"
+	case DeadlineExceededError:
+		return "deadline exceeded"
+	case StepLimitError:
+		return "max steps"
+	case CallDepthError:
+		return "max call depth"
+	case AllocLimitError:
+		return "max allocs"
+	case InternalError:
+		return "internal"
+	default:
+		return "runtime"
+	}
+}
+
+// 内置的错误类型, 脚本中 catch 到的错误通过 e["type"] 获取
+const (
+	ErrorClass         = "Error"
+	TypeErrorClass     = "TypeError"
+	ArgumentErrorClass = "ArgumentError"
+	NameErrorClass     = "NameError"
+)
+
+// 调用栈中的一帧
+type StackFrame struct {
+	Function string         // 函数名, 通过 let 绑定的函数使用绑定的名字
+	Pos      token.Position // 调用该函数的位置
+}
+
+// 打印调用栈时, 超过这个帧数只保留两端
+const maxPrintedFrames = 20
+
+// break 和 continue, 和 ReturnValue 一样向外传递直到所在的循环
+type Break struct{}
+
+func (b *Break) Type() ObjectType { return BREAK_OBJ }
+func (b *Break) Inspect() string  { return "break" }
+
+type Continue struct{}
+
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
+func (c *Continue) Inspect() string  { return "continue" }
+
 // error
 type Error struct {
 	Message string
+	Pos     token.Position // 出错的位置
+	Kind    ErrorKind
+	Class   string       // 错误类型, 为空时是 ErrorClass
+	Value   Object       // throw 抛出的值, 其他错误为 nil
+	Stack   []StackFrame // 错误向外传递时经过的函数, 最内层在前
+	GoStack string       // InternalError 时 panic 处的 Go 调用栈, 便于定位问题
+}
+
+func (e *Error) ClassName() string {
+	if e.Class == "" {
+		return ErrorClass
+	}
+	return e.Class
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
-func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
+func (e *Error) Inspect() string {
+	if e.Pos.IsValid() {
+		return "ERROR: " + e.Pos.String() + ": " + e.Message
+	}
+	return "ERROR: " + e.Message
+}
+
+// 格式化调用栈, 每帧一行, 没有调用栈时返回空串
+func (e *Error) StackTrace() string {
+	var out bytes.Buffer
+	for i, frame := range e.Stack {
+		if len(e.Stack) > maxPrintedFrames && i == maxPrintedFrames/2 {
+			out.WriteString(fmt.Sprintf("\t... %d frames elided ...\n", len(e.Stack)-maxPrintedFrames))
+		}
+		if len(e.Stack) > maxPrintedFrames && i >= maxPrintedFrames/2 && i < len(e.Stack)-maxPrintedFrames/2 {
+			continue
+		}
+		out.WriteString(fmt.Sprintf("\tat %s (%s)\n", frame.Function, frame.Pos))
+	}
+	return out.String()
+}
+
+// 实现 error 接口, 方便宿主程序直接返回
+func (e *Error) Error() string {
+	if e.Pos.IsValid() {
+		return e.Pos.String() + ": " + e.Message
+	}
+	return e.Message
+}
 
 // function
 type Function struct {
 	Parameters []*ast.Identifier
+	Patterns   []ast.Pattern    // 解构的参数, 见 ast.FunctionLiteral
+	Defaults   []ast.Expression // 调用时在函数的 env 中求值
+	Rest       *ast.Identifier
 	Body       *ast.BlockStatement
 	Env        Environment
+	Name       string // let 绑定的名字, 匿名函数为空
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
 func (f *Function) Inspect() string {
 	var out bytes.Buffer
-	var params []string
-	for _, p := range f.Parameters {
-		params = append(params, p.String())
-	}
 	out.WriteString("fn")
 	out.WriteString("(")
-	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(ast.FormatParameters(f.Parameters, f.Defaults, f.Rest))
 	out.WriteString(") {\n")
 	out.WriteString(f.Body.String())
 	out.WriteString("\n}")
@@ -149,14 +345,25 @@ func (s *String) HashKey() HashKey {
 	})
 }
 
-// 内建函数
+// 内建函数, 设置了 NamedFn 时调用 NamedFn, 否则调用 Fn 并且不接受命名参数
 type Builtin struct {
-	Fn BuiltinFunction
+	Fn      BuiltinFunction
+	NamedFn NamedBuiltinFunction
 }
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
 func (b *Builtin) Inspect() string  { return "builtin function" }
 
+func (b *Builtin) Call(args []Object, named map[string]Object) Object {
+	if b.NamedFn != nil {
+		return b.NamedFn(args, named)
+	}
+	if len(named) > 0 {
+		return &Error{Message: "builtin function does not accept named arguments", Class: ArgumentErrorClass}
+	}
+	return b.Fn(args...)
+}
+
 // 数组
 type Array struct {
 	Elements []Object
@@ -191,9 +398,9 @@ func (h *Hash) Type() ObjectType { return HASH_OBJ }
 func (h *Hash) Inspect() string {
 	var out bytes.Buffer
 	var pairs []string
-	for _, p := range h.Pairs {
+	for _, p := range h.sortedPairs() {
 		pairs = append(pairs, fmt.Sprintf("%s: %s",
-			p.Key.Inspect(), p.Key.Inspect()))
+			p.Key.Inspect(), p.Value.Inspect()))
 	}
 	out.WriteString("hash")
 	out.WriteString("{")
@@ -201,3 +408,32 @@ func (h *Hash) Inspect() string {
 	out.WriteString("}")
 	return out.String()
 }
+
+// 编译后的函数, 只存在于常量池中
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	NumLocals     int // 局部变量个数(包含参数)
+	NumParameters int
+	Name          string
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+// 闭包, vm 中运行时的函数对象
+// Free 是外层各级函数和循环体的变量, Free[0] 是直接外层的函数或循环体当次迭代的变量,
+// 以此类推; 由于是切片引用, 内外层函数对同一个变量的修改相互可见
+type Closure struct {
+	Fn   *CompiledFunction
+	Free [][]Object
+}
+
+func (c *Closure) Type() ObjectType { return FUNCTION_OBJ } // 对脚本来说闭包就是函数
+func (c *Closure) Inspect() string {
+	if c.Fn.Name != "" {
+		return fmt.Sprintf("closure %s[%p]", c.Fn.Name, c)
+	}
+	return fmt.Sprintf("closure[%p]", c)
+}
@@ -1,6 +1,12 @@
 package object
 
-import "testing"
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"testing"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -18,3 +24,88 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("strings with different content have same hash keys")
 	}
 }
+
+func TestNewInteger(t *testing.T) {
+	for _, v := range []int64{minCachedInt, -1, 0, 1, 42, maxCachedInt} {
+		i := NewInteger(v)
+		if i.Value != v {
+			t.Errorf("NewInteger(%d).Value = %d", v, i.Value)
+		}
+		if NewInteger(v) != i {
+			t.Errorf("NewInteger(%d) is not cached", v)
+		}
+		if i.HashKey() != (&Integer{Value: v}).HashKey() {
+			t.Errorf("NewInteger(%d) has wrong hash key", v)
+		}
+	}
+	for _, v := range []int64{minCachedInt - 1, maxCachedInt + 1, math.MaxInt64} {
+		if NewInteger(v) == NewInteger(v) {
+			t.Errorf("NewInteger(%d) should not be cached", v)
+		}
+	}
+}
+
+func TestFloat(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{1.5, "1.5"},
+		{3, "3.0"},
+		{-0.25, "-0.25"},
+		{1e-9, "1e-09"},
+		{1e21, "1e+21"},
+		{math.Inf(1), "+Inf"},
+		{math.NaN(), "NaN"},
+	}
+	for _, tt := range tests {
+		f := &Float{Value: tt.value}
+		if f.Inspect() != tt.expected {
+			t.Errorf("wrong inspect. want=%q, got=%q", tt.expected, f.Inspect())
+		}
+	}
+
+	// 值为整数的 float 与 integer 是同一个键
+	if (&Float{Value: 2}).HashKey() != (&Integer{Value: 2}).HashKey() {
+		t.Errorf("2.0 and 2 have different hash keys")
+	}
+	if (&Float{Value: 2.5}).HashKey() == (&Integer{Value: 2}).HashKey() {
+		t.Errorf("2.5 and 2 have same hash keys")
+	}
+	if (&Float{Value: 2.5}).HashKey() != (&Float{Value: 2.5}).HashKey() {
+		t.Errorf("floats with same content have different hash keys")
+	}
+}
+
+func TestBigIntHashKey(t *testing.T) {
+	big1, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	big2, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	neg := new(big.Int).Neg(big1)
+
+	if (&BigInt{Value: big1}).HashKey() != (&BigInt{Value: big2}).HashKey() {
+		t.Errorf("bigints with same content have different hash keys")
+	}
+	if (&BigInt{Value: big1}).HashKey() == (&BigInt{Value: neg}).HashKey() {
+		t.Errorf("bigints with different sign have same hash keys")
+	}
+	if (&BigInt{Value: big.NewInt(7)}).HashKey() != (&Integer{Value: 7}).HashKey() {
+		t.Errorf("bigint 7 and integer 7 have different hash keys")
+	}
+}
+
+func TestErrorStackTraceElided(t *testing.T) {
+	errObj := &Error{Message: "boom"}
+	for i := 0; i < 100; i++ {
+		errObj.Stack = append(errObj.Stack, StackFrame{Function: fmt.Sprintf("f%d", i)})
+	}
+	lines := strings.Split(strings.TrimSuffix(errObj.StackTrace(), "\n"), "\n")
+	if len(lines) != maxPrintedFrames+1 {
+		t.Fatalf("wrong number of lines. got=%d", len(lines))
+	}
+	if lines[maxPrintedFrames/2] != "\t... 80 frames elided ..." {
+		t.Errorf("wrong elided line. got=%q", lines[maxPrintedFrames/2])
+	}
+	if lines[0] != "\tat f0 (-)" || lines[len(lines)-1] != "\tat f99 (-)" {
+		t.Errorf("both ends should be kept. got=%q, %q", lines[0], lines[len(lines)-1])
+	}
+}
@@ -0,0 +1,47 @@
+package parser
+
+import (
+	"fmt"
+	"github.com/qiuhoude/go-interpreter/token"
+	"strings"
+)
+
+// 每个文件最多报告的错误数, 超过后停止解析
+const DefaultMaxErrors = 10
+
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	default:
+		return "error"
+	}
+}
+
+// 解析错误
+type Error struct {
+	Pos      token.Position
+	Expected []token.TokenType // 期望的 token, 为空表示不是缺少某个 token 导致的错误
+	Found    token.Token       // 实际遇到的 token
+	Msg      string
+	Severity Severity
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+}
+
+func expectedString(ts []token.TokenType) string {
+	var names []string
+	for _, t := range ts {
+		names = append(names, string(t))
+	}
+	return strings.Join(names, " or ")
+}
@@ -5,7 +5,9 @@ import (
 	"github.com/qiuhoude/go-interpreter/ast"
 	"github.com/qiuhoude/go-interpreter/lexer"
 	"github.com/qiuhoude/go-interpreter/token"
+	"math/big"
 	"strconv"
+	"strings"
 )
 
 const (
@@ -13,11 +15,18 @@ const (
 	_ int = iota
 	LOWEST
 	ASSIGN
+	LOGICAL_OR  // ||
+	LOGICAL_AND // &&
 	EQUALS      // ==
 	LESSGREATER // > or <  >= <=
+	BIT_OR      // |
+	BIT_XOR     // ^
+	BIT_AND     // &
+	SHIFT       // << >>
 	SUM         // +
-	PRODUCT     // *
+	PRODUCT     // * / %
 	PREFIX      // -X or !X
+	POWER       // **, 比前缀高: -2 ** 2 == -(2 ** 2)
 	CALL        // myFunction(X)
 	INDEX       // arr[1]
 )
@@ -34,6 +43,15 @@ var precedences = map[token.TokenType]int{
 	token.MINUS:    SUM,
 	token.SLASH:    PRODUCT,
 	token.ASTERISK: PRODUCT,
+	token.PERCENT:  PRODUCT,
+	token.POW:      POWER,
+	token.AND:      LOGICAL_AND,
+	token.OR:       LOGICAL_OR,
+	token.BIT_AND:  BIT_AND,
+	token.BIT_OR:   BIT_OR,
+	token.BIT_XOR:  BIT_XOR,
+	token.SHL:      SHIFT,
+	token.SHR:      SHIFT,
 	token.LPAREN:   CALL,
 	token.ASSIGN:   ASSIGN,
 	token.LBRACKET: INDEX, // arr`[`1]
@@ -47,11 +65,22 @@ type (
 
 type Parser struct {
 	l      *lexer.Lexer
-	errors []string
+	errors []*Error
+
+	maxErrors int
+	panicking bool // 出错后直到同步点之前, 不再报告新的错误, 避免连锁的错误
+
+	braceDepth int // curToken 所在的 {} 嵌套层数, 错误恢复时用来找到出错语句所在的块
+
+	loopDepth int // 当前所在循环的层数, break/continue 只能出现在循环中
+
+	traceLevel int
 
 	curToken  token.Token // cur point
 	peekToken token.Token // next point
 
+	comments []token.Token // 跳过的注释, 最后放到 Program 中
+
 	prefixParseFns map[token.TokenType]prefixParseFn // 前缀解析方法
 	infixParseFns  map[token.TokenType]infixParseFn  // 中缀解析方法
 }
@@ -59,14 +88,18 @@ type Parser struct {
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
 		l:              l,
-		errors:         []string{},
+		errors:         []*Error{},
+		maxErrors:      DefaultMaxErrors,
 		prefixParseFns: map[token.TokenType]prefixParseFn{},
 		infixParseFns:  map[token.TokenType]infixParseFn{},
 	}
 
 	p.RegisterPrefix(token.IDENT, p.parseIdentifier)
 	p.RegisterPrefix(token.STRING, p.parseStringLiteral)
+	p.RegisterPrefix(token.INTERP_HEAD, p.parseInterpolatedString)
+	p.RegisterPrefix(token.ILLEGAL, p.parseIllegal)
 	p.RegisterPrefix(token.INT, p.parseIntegerLiteral)
+	p.RegisterPrefix(token.FLOAT, p.parseFloatLiteral)
 	p.RegisterPrefix(token.BANG, p.parsePrefixExpression)
 	p.RegisterPrefix(token.MINUS, p.parsePrefixExpression)
 	p.RegisterPrefix(token.PLUS, p.parsePrefixExpression)
@@ -75,6 +108,7 @@ func New(l *lexer.Lexer) *Parser {
 	p.RegisterPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.RegisterPrefix(token.LBRACE, p.parseBlockExpression) // 块语句
 	p.RegisterPrefix(token.IF, p.parseIfExpression)
+	p.RegisterPrefix(token.TRY, p.parseTryExpression)
 	p.RegisterPrefix(token.FUNCTION, p.parseFunctionLiteral)
 	p.RegisterPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.RegisterPrefix(token.HASH, p.parseHashLiteral) //hash表, 本来用 {, 但是 { 被语句块占用
@@ -90,6 +124,15 @@ func New(l *lexer.Lexer) *Parser {
 	p.RegisterInfix(token.MINUS, p.parseInfixExpression)
 	p.RegisterInfix(token.SLASH, p.parseInfixExpression)
 	p.RegisterInfix(token.ASTERISK, p.parseInfixExpression)
+	p.RegisterInfix(token.PERCENT, p.parseInfixExpression)
+	p.RegisterInfix(token.POW, p.parseInfixExpression)
+	p.RegisterInfix(token.AND, p.parseInfixExpression)
+	p.RegisterInfix(token.OR, p.parseInfixExpression)
+	p.RegisterInfix(token.BIT_AND, p.parseInfixExpression)
+	p.RegisterInfix(token.BIT_OR, p.parseInfixExpression)
+	p.RegisterInfix(token.BIT_XOR, p.parseInfixExpression)
+	p.RegisterInfix(token.SHL, p.parseInfixExpression)
+	p.RegisterInfix(token.SHR, p.parseInfixExpression)
 	p.RegisterInfix(token.LPAREN, p.parseCallExpression)    // call
 	p.RegisterInfix(token.ASSIGN, p.parseAssignExpression)  // 分配表达式
 	p.RegisterInfix(token.LBRACKET, p.parseIndexExpression) //index
@@ -101,13 +144,84 @@ func New(l *lexer.Lexer) *Parser {
 
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
+	switch p.curToken.Type {
+	case token.LBRACE:
+		p.braceDepth++
+	case token.RBRACE:
+		if p.braceDepth > 0 { // 多余的 } 不影响后面的恢复
+			p.braceDepth--
+		}
+	}
 	p.peekToken = p.l.NextToken()
+	for p.peekToken.Type == token.COMMENT {
+		p.comments = append(p.comments, p.peekToken)
+		p.peekToken = p.l.NextToken()
+	}
 }
 
-func (p *Parser) Errors() []string {
+func (p *Parser) Errors() []*Error {
 	return p.errors
 }
 
+// 设置最多报告的错误数, <= 0 表示不限制
+func (p *Parser) SetMaxErrors(n int) {
+	p.maxErrors = n
+}
+
+// 在 tok 处记录错误, 同一条语句中只记录第一个错误
+func (p *Parser) errorAt(tok token.Token, expected []token.TokenType, format string, a ...interface{}) {
+	if p.panicking || p.tooManyErrors() {
+		return
+	}
+	p.panicking = true
+	p.errors = append(p.errors, &Error{
+		Pos:      tok.Pos,
+		Expected: expected,
+		Found:    tok,
+		Msg:      fmt.Sprintf(format, a...),
+		Severity: SeverityError,
+	})
+	if p.tooManyErrors() {
+		p.errors = append(p.errors, &Error{
+			Pos:      tok.Pos,
+			Found:    tok,
+			Msg:      "too many errors",
+			Severity: SeverityError,
+		})
+	}
+}
+
+func (p *Parser) tooManyErrors() bool {
+	return p.maxErrors > 0 && len(p.errors) >= p.maxErrors
+}
+
+/*
+panic-mode 错误恢复
+出错后跳过 token 直到同步点, 然后从下一条语句继续解析.
+depth 是出错语句所在块的 {} 层数, 只有回到这一层时 `;`, `}` 和语句关键字才是同步点,
+出错的结构中已经读过的 { (hash, 语句块等) 会被完整跳过.
+返回 false 表示当前 token 就是关闭这个块的 `}`, 调用方不能再跳过它
+*/
+func (p *Parser) synchronize(depth int) bool {
+	p.panicking = false
+	for !p.curTokenIs(token.EOF) {
+		if p.braceDepth < depth {
+			return false
+		}
+		if p.braceDepth == depth {
+			if p.curTokenIs(token.SEMICOLON) {
+				return true
+			}
+			switch p.peekToken.Type {
+			case token.LET, token.RETURN, token.THROW, token.WHILE, token.FOR, token.RBRACE, token.EOF:
+				return true
+			}
+		}
+		p.nextToken()
+	}
+	return true
+}
+
 func (p *Parser) RegisterPrefix(tokenType token.TokenType, fn prefixParseFn) {
 	p.prefixParseFns[tokenType] = fn
 }
@@ -120,35 +234,67 @@ func (p *Parser) ParseProgram() *ast.Program {
 	program := &ast.Program{}
 	program.Statements = []ast.Statement{}
 
-	for !p.curTokenIs(token.EOF) {
+	for !p.curTokenIs(token.EOF) && !p.tooManyErrors() {
 		stmt := p.parseStatement()
 		if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
 		}
+		if p.panicking {
+			p.synchronize(0)
+		}
 		p.nextToken()
 	}
+	program.Comments = p.comments
 	return program
 }
 
 // 解析语句
 func (p *Parser) parseStatement() ast.Statement {
+	// 返回 nil 时要返回 nil interface, 而不是 nil 指针
 	switch p.curToken.Type {
 	case token.LET:
-		return p.parseLetStatement()
+		if stmt := p.parseLetStatement(); stmt != nil {
+			return stmt
+		}
 	case token.RETURN:
-		return p.parseReturnStatement()
+		if stmt := p.parseReturnStatement(); stmt != nil {
+			return stmt
+		}
+	case token.THROW:
+		if stmt := p.parseThrowStatement(); stmt != nil {
+			return stmt
+		}
+	case token.WHILE:
+		if stmt := p.parseWhileStatement(); stmt != nil {
+			return stmt
+		}
+	case token.FOR:
+		if stmt := p.parseForStatement(); stmt != nil {
+			return stmt
+		}
+	case token.BREAK:
+		if stmt := p.parseBreakStatement(); stmt != nil {
+			return stmt
+		}
+	case token.CONTINUE:
+		if stmt := p.parseContinueStatement(); stmt != nil {
+			return stmt
+		}
 	default:
-		return p.parseExpressionStatement()
+		if stmt := p.parseExpressionStatement(); stmt != nil {
+			return stmt
+		}
 	}
+	return nil
 }
 
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
-	defer untrace(trace("parseExpressionStatement"))
+	defer p.untrace(p.trace("parseExpressionStatement"))
 
 	stmt := &ast.ExpressionStatement{Token: p.curToken}
 	stmt.Expression = p.parseExpression(LOWEST)
 
-	if p.peekTokenIs(token.SEMICOLON) {
+	if !p.panicking && p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 	return stmt
@@ -157,12 +303,18 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 func (p *Parser) parseLetStatement() *ast.LetStatement {
 	stmt := &ast.LetStatement{Token: p.curToken}
 
-	if !p.expectPeek(token.IDENT) {
-		return nil
+	if p.peekTokenIs(token.LBRACKET) || p.peekTokenIs(token.HASH) { // let [a, b] = arr;
+		p.nextToken()
+		if stmt.Pattern = p.parsePattern(); stmt.Pattern == nil {
+			return nil
+		}
+	} else {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 	}
 
-	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-
 	if !p.expectPeek(token.ASSIGN) {
 		return nil
 	}
@@ -170,51 +322,342 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 
 	stmt.Value = p.parseExpression(LOWEST)
 
-	// 先跳过 expressions ,直到我们遇到 ;
-	for !p.curTokenIs(token.EOF) && !p.curTokenIs(token.SEMICOLON) {
+	if !p.panicking && p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 
 	return stmt
 }
 
+// 当前 token 是模式的开始: 标识符, [ 或者 hash
+func (p *Parser) parsePattern() ast.Pattern {
+	defer p.untrace(p.trace("parsePattern"))
+	switch p.curToken.Type {
+	case token.IDENT:
+		return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	case token.LBRACKET:
+		return p.parseArrayPattern()
+	case token.HASH:
+		return p.parseHashPattern()
+	}
+	expected := []token.TokenType{token.IDENT, token.LBRACKET, token.HASH}
+	p.errorAt(p.curToken, expected, "expected %s in pattern, got %s instead",
+		expectedString(expected), p.curToken.Type)
+	return nil
+}
+
+// [a, [b, c], ...rest]
+func (p *Parser) parseArrayPattern() ast.Pattern {
+	pat := &ast.ArrayPattern{Token: p.curToken}
+	if p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		pat.Rbracket = p.curToken.Pos
+		return pat
+	}
+	for {
+		p.nextToken() // cur指向元素
+		if p.curTokenIs(token.ELLIPSIS) {
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			pat.Rest = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			if p.peekTokenIs(token.COMMA) {
+				p.errorAt(p.peekToken, nil, "rest element must be the last element")
+				return nil
+			}
+			break
+		}
+		el := p.parsePattern()
+		if el == nil {
+			return nil
+		}
+		pat.Elements = append(pat.Elements, el)
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken() // cur指向 `,`
+	}
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+	pat.Rbracket = p.curToken.Pos
+	return pat
+}
+
+// hash{"name": n, "tags": [first]}
+func (p *Parser) parseHashPattern() ast.Pattern {
+	pat := &ast.HashPattern{Token: p.curToken}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	if p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		pat.Rbrace = p.curToken.Pos
+		return pat
+	}
+	for {
+		p.nextToken() // cur指向 key
+		key := p.parseExpression(LOWEST)
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+		p.nextToken() // skip ':'
+		value := p.parsePattern()
+		if value == nil {
+			return nil
+		}
+		pat.Keys = append(pat.Keys, key)
+		pat.Values = append(pat.Values, value)
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken() // cur指向 `,`
+	}
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	pat.Rbrace = p.curToken.Pos
+	return pat
+}
+
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
-	defer untrace(trace("parseReturnStatement"))
+	defer p.untrace(p.trace("parseReturnStatement"))
 	stmt := &ast.ReturnStatement{Token: p.curToken}
 	// 解析 return <expression>;
 
 	p.nextToken()
 	stmt.Value = p.parseExpression(LOWEST)
 
-	for !p.curTokenIs(token.EOF) && !p.curTokenIs(token.SEMICOLON) {
+	if !p.panicking && p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	defer p.untrace(p.trace("parseThrowStatement"))
+	stmt := &ast.ThrowStatement{Token: p.curToken}
+	// 解析 throw <expression>;
+
+	p.nextToken()
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if !p.panicking && p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseWhileStatement() *ast.WhileStatement {
+	defer p.untrace(p.trace("parseWhileStatement"))
+	stmt := &ast.WhileStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) { // `while` (
+		return nil
+	}
+	p.nextToken()
+	stmt.Condition = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Body = p.parseLoopBody()
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseForStatement() ast.Statement {
+	defer p.untrace(p.trace("parseForStatement"))
+	stmt := &ast.ForStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) { // `for` (
+		return nil
+	}
+	p.nextToken()
+	// for (x in ...) 或 for (k, v in ...)
+	if p.curTokenIs(token.IDENT) && (p.peekTokenIs(token.IN) || p.peekTokenIs(token.COMMA)) {
+		return p.parseForInStatement(stmt.Token)
+	}
+	if !p.parseForHeader(stmt) {
+		p.skipForStatement()
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Body = p.parseLoopBody()
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// (init; condition; post), 开始时 cur 指向 init 的第一个 token, 结束时 cur 指向 `)`
+func (p *Parser) parseForHeader(stmt *ast.ForStatement) bool {
+	// init, let 和表达式语句会自己消耗结尾的 `;`
+	if !p.curTokenIs(token.SEMICOLON) {
+		if p.curTokenIs(token.LET) {
+			if init := p.parseLetStatement(); init != nil {
+				stmt.Init = init
+			}
+		} else {
+			stmt.Init = p.parseExpressionStatement()
+		}
+		if p.panicking {
+			return false
+		}
+		if !p.curTokenIs(token.SEMICOLON) {
+			p.peekError(token.SEMICOLON)
+			return false
+		}
+	}
+
+	// condition
+	p.nextToken()
+	if !p.curTokenIs(token.SEMICOLON) {
+		stmt.Condition = p.parseExpression(LOWEST)
+		if !p.expectPeek(token.SEMICOLON) {
+			return false
+		}
+	}
+
+	// post
+	p.nextToken()
+	if !p.curTokenIs(token.RPAREN) {
+		stmt.Post = p.parseExpression(LOWEST)
+		if !p.expectPeek(token.RPAREN) {
+			return false
+		}
+	}
+	return true
+}
+
+// 开始时 cur 指向第一个循环变量
+func (p *Parser) parseForInStatement(tok token.Token) ast.Statement {
+	defer p.untrace(p.trace("parseForInStatement"))
+	stmt := &ast.ForInStatement{Token: tok}
+
+	stmt.Vars = append(stmt.Vars, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+	if p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			p.skipForStatement()
+			return nil
+		}
+		stmt.Vars = append(stmt.Vars, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+	}
+	if !p.expectPeek(token.IN) {
+		p.skipForStatement()
+		return nil
+	}
+	p.nextToken()
+	stmt.Iterable = p.parseExpression(LOWEST)
+	if p.panicking || !p.expectPeek(token.RPAREN) {
+		p.skipForStatement()
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Body = p.parseLoopBody()
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// for 的头部出错时跳过整个 for 语句, 停在循环体的 `}` 上.
+// 否则头部中的 `;` 会被当成同步点, 剩下的部分被当成新的语句导致连锁的错误
+func (p *Parser) skipForStatement() {
+	p.skipBalanced(token.LPAREN, token.RPAREN, 1) // 已经在 `(` 之内
+	if p.peekTokenIs(token.LBRACE) {
+		p.nextToken()
+		p.skipBalanced(token.LBRACE, token.RBRACE, 0)
+	}
+}
+
+// 从 cur 开始跳过 token, 直到 open/close 配对完成, 停在最后的 close 上
+func (p *Parser) skipBalanced(open, close token.TokenType, depth int) {
+	for !p.curTokenIs(token.EOF) {
+		switch p.curToken.Type {
+		case open:
+			depth++
+		case close:
+			depth--
+		}
+		if depth == 0 {
+			return
+		}
 		p.nextToken()
 	}
+}
 
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	p.loopDepth++
+	defer func() { p.loopDepth-- }()
+	return p.parseBlockStatement()
+}
+
+func (p *Parser) parseBreakStatement() *ast.BreakStatement {
+	stmt := &ast.BreakStatement{Token: p.curToken}
+	if p.loopDepth == 0 {
+		p.errorAt(p.curToken, nil, "break outside loop")
+		return nil
+	}
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseContinueStatement() *ast.ContinueStatement {
+	stmt := &ast.ContinueStatement{Token: p.curToken}
+	if p.loopDepth == 0 {
+		p.errorAt(p.curToken, nil, "continue outside loop")
+		return nil
+	}
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
 	return stmt
 }
 
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	blockStmt := &ast.BlockStatement{Token: p.curToken}
+	depth := p.braceDepth // 包括这个块的 {
 
 	p.nextToken() // skip {
 
-	for !p.curTokenIs(token.EOF) && !p.curTokenIs(token.RBRACE) {
+	for !p.curTokenIs(token.EOF) && !p.curTokenIs(token.RBRACE) && !p.tooManyErrors() {
 		stmt := p.parseStatement()
 		if stmt != nil {
 			blockStmt.Statements = append(blockStmt.Statements, stmt)
 		}
+		if p.panicking && !p.synchronize(depth) {
+			break
+		}
 		p.nextToken()
 	}
+	if p.curTokenIs(token.RBRACE) {
+		blockStmt.Rbrace = p.curToken.Pos
+	}
 	return blockStmt
 }
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.errorAt(p.curToken, nil, "no prefix parse function for %s found", t)
 }
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
-	defer untrace(trace("parseExpression"))
+	defer p.untrace(p.trace("parseExpression"))
 	// 流程就是使用递归方式构建多叉树 AST
 	// 前缀
 	prefixFn, ok := p.prefixParseFns[p.curToken.Type]
@@ -226,7 +669,7 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 	leftExp := prefixFn()
 
 	// 中缀 key code
-	for !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
+	for !p.panicking && !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
 		// 下一个token 不是`;` , 并且下一个token优先级大于传入参数优先级
 		infixFn, ok := p.infixParseFns[p.peekToken.Type]
 		// 不是中缀,跳出循环
@@ -241,21 +684,62 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 }
 
 func (p *Parser) parseIdentifier() ast.Expression {
-	defer untrace(trace("parseIdentifier"))
+	defer p.untrace(p.trace("parseIdentifier"))
 	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 }
 
+// 词法错误, 报告 lexer 给出的原因
+func (p *Parser) parseIllegal() ast.Expression {
+	p.errorAt(p.curToken, nil, "%s", p.curToken.Msg)
+	return nil
+}
+
 func (p *Parser) parseStringLiteral() ast.Expression {
-	defer untrace(trace("parseStringLiteral"))
+	defer p.untrace(p.trace("parseStringLiteral"))
 	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
 
+// 当前 token 是 INTERP_HEAD, 依次解析表达式和后面的 INTERP_MIDDLE, 直到 INTERP_TAIL
+func (p *Parser) parseInterpolatedString() ast.Expression {
+	defer p.untrace(p.trace("parseInterpolatedString"))
+	exp := &ast.InterpolatedString{Token: p.curToken}
+	for {
+		if p.curToken.Literal != "" {
+			exp.Parts = append(exp.Parts, &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal})
+		}
+		if p.curTokenIs(token.INTERP_TAIL) {
+			exp.Quote = p.curToken.End.Shift(-1)
+			return exp
+		}
+		if p.peekTokenIs(token.INTERP_MIDDLE) || p.peekTokenIs(token.INTERP_TAIL) {
+			p.errorAt(p.peekToken, nil, "empty expression in string interpolation")
+			return nil
+		}
+		p.nextToken()
+		part := p.parseExpression(LOWEST)
+		if part == nil {
+			return nil
+		}
+		exp.Parts = append(exp.Parts, part)
+		if !p.peekTokenIs(token.INTERP_MIDDLE) && !p.peekTokenIs(token.INTERP_TAIL) {
+			p.errorAt(p.peekToken, []token.TokenType{token.INTERP_MIDDLE, token.INTERP_TAIL},
+				"expected } to close string interpolation, got %s instead", p.peekToken.Type)
+			return nil
+		}
+		p.nextToken()
+	}
+}
+
 func (p *Parser) parseIntegerLiteral() ast.Expression {
-	defer untrace(trace("parseIntegerLiteral"))
-	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
+	defer p.untrace(p.trace("parseIntegerLiteral"))
+	digits, base := splitIntegerLiteral(p.curToken.Literal)
+	value, err := strconv.ParseInt(digits, base, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		// 超出 int64 时使用 BigInt
+		if bigValue, ok := new(big.Int).SetString(digits, base); ok {
+			return &ast.IntegerLiteral{Token: p.curToken, Big: bigValue}
+		}
+		p.errorAt(p.curToken, nil, "could not parse %q as integer", p.curToken.Literal)
 		return nil
 	}
 
@@ -263,8 +747,38 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	return lit
 }
 
+// 去掉 0x, 0o, 0b 前缀和 `_`, 返回数字部分和进制.
+// 不使用 base 0, 否则 010 会按旧的规则当成八进制
+func splitIntegerLiteral(literal string) (string, int) {
+	base := 10
+	if len(literal) >= 2 && literal[0] == '0' {
+		switch literal[1] {
+		case 'x', 'X':
+			base = 16
+		case 'o', 'O':
+			base = 8
+		case 'b', 'B':
+			base = 2
+		}
+		if base != 10 {
+			literal = literal[2:]
+		}
+	}
+	return strings.ReplaceAll(literal, "_", ""), base
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	defer p.untrace(p.trace("parseFloatLiteral"))
+	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
+	if err != nil {
+		p.errorAt(p.curToken, nil, "could not parse %q as float", p.curToken.Literal)
+		return nil
+	}
+	return &ast.FloatLiteral{Token: p.curToken, Value: value}
+}
+
 func (p *Parser) parsePrefixExpression() ast.Expression {
-	defer untrace(trace("parsePrefixExpression"))
+	defer p.untrace(p.trace("parsePrefixExpression"))
 	pe := &ast.PrefixExpression{Token: p.curToken, Operator: p.curToken.Literal}
 
 	p.nextToken()
@@ -273,10 +787,10 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 }
 
 func (p *Parser) parseAssignExpression(left ast.Expression) ast.Expression {
-	defer untrace(trace("parseAssignExpression"))
+	defer p.untrace(p.trace("parseAssignExpression"))
 	leftI, ok := left.(*ast.Identifier)
 	if !ok {
-		p.errors = append(p.errors, fmt.Sprintf("assign left is not Identifier got %v instead", left))
+		p.errorAt(p.curToken, nil, "assign left is not Identifier got %v instead", left)
 		return nil
 	}
 	exp := &ast.AssignExpression{
@@ -289,7 +803,7 @@ func (p *Parser) parseAssignExpression(left ast.Expression) ast.Expression {
 }
 
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
-	defer untrace(trace("parseIndexExpression"))
+	defer p.untrace(p.trace("parseIndexExpression"))
 	exp := &ast.IndexExpression{
 		Token: p.curToken,
 		Left:  left,
@@ -300,12 +814,13 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
 	}
+	exp.Rbracket = p.curToken.Pos
 
 	return exp
 }
 
 func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
-	defer untrace(trace("parseInfixExpression"))
+	defer p.untrace(p.trace("parseInfixExpression"))
 	exp := &ast.InfixExpression{
 		Token:    p.curToken,
 		Left:     left,
@@ -313,6 +828,9 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	}
 
 	precedences := p.curPrecedence()
+	if p.curTokenIs(token.POW) { // 右结合: 2 ** 3 ** 2 == 2 ** (3 ** 2)
+		precedences--
+	}
 	p.nextToken()
 	exp.Right = p.parseExpression(precedences)
 
@@ -320,12 +838,12 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 }
 
 func (p *Parser) parseBoolean() ast.Expression {
-	defer untrace(trace("parseBoolean"))
+	defer p.untrace(p.trace("parseBoolean"))
 	return &ast.Boolean{Token: p.curToken, Value: p.curTokenIs(token.TRUE)}
 }
 
 func (p *Parser) parseGroupedExpression() ast.Expression {
-	defer untrace(trace("parseGroupedExpression"))
+	defer p.untrace(p.trace("parseGroupedExpression"))
 	p.nextToken()
 
 	exp := p.parseExpression(LOWEST)
@@ -337,7 +855,7 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 }
 
 func (p *Parser) parseIfExpression() ast.Expression {
-	defer untrace(trace("parseIfExpression"))
+	defer p.untrace(p.trace("parseIfExpression"))
 	exp := &ast.IfExpression{Token: p.curToken}
 
 	if !p.expectPeek(token.LPAREN) { // `if` (
@@ -370,25 +888,71 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return exp
 }
 
+func (p *Parser) parseTryExpression() ast.Expression {
+	defer p.untrace(p.trace("parseTryExpression"))
+	exp := &ast.TryExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LBRACE) { // `try` {
+		return nil
+	}
+	exp.Block = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+		if p.peekTokenIs(token.LPAREN) { // `catch` (e)
+			p.nextToken()
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			exp.Param = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			if !p.expectPeek(token.RPAREN) {
+				return nil
+			}
+		}
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		exp.Catch = p.parseBlockStatement()
+	}
+
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		exp.Finally = p.parseBlockStatement()
+	}
+
+	if exp.Catch == nil && exp.Finally == nil {
+		p.peekError(token.CATCH, token.FINALLY)
+		return nil
+	}
+	return exp
+}
+
 func (p *Parser) parseFunctionLiteral() ast.Expression {
-	defer untrace(trace("parseFunctionLiteral"))
+	defer p.untrace(p.trace("parseFunctionLiteral"))
 	exp := &ast.FunctionLiteral{Token: p.curToken}
 
 	if !p.expectPeek(token.LPAREN) { // `fn` (
 		return nil
 	}
-	exp.Parameters = p.parseFunctionParameters()
+	// 参数默认值和函数体中的 break/continue 不属于外层的循环
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
+	defer func() { p.loopDepth = loopDepth }()
+
+	p.parseFunctionParameters(exp)
 
 	if !p.expectPeek(token.LBRACE) { // `fn ( params... )` {
 		return nil
 	}
-
 	exp.Body = p.parseBlockStatement()
 	return exp
 }
 
 func (p *Parser) parseHashLiteral() ast.Expression {
-	defer untrace(trace("parseHashLiteral"))
+	defer p.untrace(p.trace("parseHashLiteral"))
 	tok := p.curToken
 	// eg hash{1, 2, 3}
 	if !p.expectPeek(token.LBRACE) { // hash 后面不是 {
@@ -400,6 +964,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 	}
 	if p.peekTokenIs(token.RBRACE) { // hash{ 后面是 } ,说明是空 hash
 		p.nextToken()
+		exp.Rbrace = p.curToken.Pos
 		return exp
 	}
 	p.nextToken() // skip '{'
@@ -415,23 +980,29 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		if p.peekTokenIs(token.RBRACE) { // '}' 说明最后一对
 			break
 		}
-		if !p.expectPeek(token.COMMA) { // 下一个不是 ',' 说明有错误
+		if !p.peekTokenIs(token.COMMA) { // 下一个不是 ',' 说明有错误
+			p.peekError(token.COMMA, token.RBRACE)
 			return nil
 		}
+		p.nextToken()
 		p.nextToken() // skip ','
 	}
 
 	if !p.expectPeek(token.RBRACE) { // 不是 } 结尾
 		return nil
 	}
+	exp.Rbrace = p.curToken.Pos
 
 	return exp
 }
 
 func (p *Parser) parseArrayLiteral() ast.Expression {
-	defer untrace(trace("parseArrayLiteral"))
+	defer p.untrace(p.trace("parseArrayLiteral"))
 	exp := &ast.ArrayLiteral{Token: p.curToken}
 	exp.Elements = p.parseExpressionList(token.RBRACKET)
+	if exp.Elements != nil {
+		exp.Rbracket = p.curToken.Pos
+	}
 	return exp
 }
 
@@ -443,65 +1014,157 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 		return list
 	}
 	p.nextToken() // skip startToken
-	list = append(list, p.parseExpression(LOWEST))
+	list = append(list, p.parseListElement())
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken() // skip previous expression
 		p.nextToken() // skip ','
-		list = append(list, p.parseExpression(LOWEST))
+		list = append(list, p.parseListElement())
 	}
-	if !p.expectPeek(end) {
+	if !p.peekTokenIs(end) {
+		p.peekError(token.COMMA, end)
 		return nil
 	}
+	p.nextToken()
 
 	return list
 }
 
+// 调用参数和数组元素可以是 ...expr
+func (p *Parser) parseListElement() ast.Expression {
+	if !p.curTokenIs(token.ELLIPSIS) {
+		return p.parseExpression(LOWEST)
+	}
+	exp := &ast.SpreadExpression{Token: p.curToken}
+	p.nextToken() // skip '...'
+	exp.Value = p.parseExpression(LOWEST)
+	return exp
+}
+
 func (p *Parser) parseBlockExpression() ast.Expression {
-	defer untrace(trace("parseBlockExpression"))
+	defer p.untrace(p.trace("parseBlockExpression"))
 	exp := &ast.BlockExpression{Token: p.curToken}
 	exp.Body = p.parseBlockStatement()
 	return exp
 }
 
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
-	defer untrace(trace("parseFunctionParameters"))
-	// fn (a,b,c...)
-	var identifiers []*ast.Identifier
+// fn (a, [b, c], d = 10, ...rest)
+// 有默认值的参数后面只能是有默认值的参数或者剩余参数, 剩余参数只能是最后一个
+func (p *Parser) parseFunctionParameters(fn *ast.FunctionLiteral) {
+	defer p.untrace(p.trace("parseFunctionParameters"))
 
 	if p.peekTokenIs(token.RPAREN) {
 		p.nextToken()
-		return identifiers
+		return
 	}
-	p.nextToken()
-	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-	identifiers = append(identifiers, ident)
-
-	for p.peekTokenIs(token.COMMA) { // 多个参数 (a,b,c)
-		p.nextToken() // cur指向 `,`
+	for {
 		p.nextToken() // cur指向 `参数`
+		if p.curTokenIs(token.ELLIPSIS) {
+			if !p.expectPeek(token.IDENT) {
+				return
+			}
+			fn.Rest = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			if p.peekTokenIs(token.COMMA) {
+				p.errorAt(p.peekToken, nil, "rest parameter must be the last parameter")
+				return
+			}
+			break
+		}
 
 		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-		identifiers = append(identifiers, ident)
-	}
+		if p.curTokenIs(token.LBRACKET) || p.curTokenIs(token.HASH) { // 解构的参数
+			pat := p.parsePattern()
+			if pat == nil {
+				return
+			}
+			if fn.Patterns == nil {
+				fn.Patterns = make([]ast.Pattern, len(fn.Parameters))
+			}
+			ident.Value = pat.String() // 占位的名字, 不会和标识符冲突
+			fn.Patterns = append(fn.Patterns, pat)
+		} else if fn.Patterns != nil {
+			fn.Patterns = append(fn.Patterns, nil)
+		}
+		fn.Parameters = append(fn.Parameters, ident)
+		if p.peekTokenIs(token.ASSIGN) {
+			p.nextToken()
+			p.nextToken() // skip '='
+			if fn.Defaults == nil {
+				fn.Defaults = make([]ast.Expression, len(fn.Parameters)-1)
+			}
+			fn.Defaults = append(fn.Defaults, p.parseExpression(LOWEST))
+		} else if fn.Defaults != nil {
+			p.errorAt(ident.Token, nil, "parameter %s without default follows parameter with default", ident.Value)
+			return
+		}
 
-	if !p.expectPeek(token.RPAREN) { // 不是 ) 结束
-		return nil
+		if !p.peekTokenIs(token.COMMA) { // 多个参数 (a,b,c)
+			break
+		}
+		p.nextToken() // cur指向 `,`
 	}
 
-	return identifiers
+	if !p.peekTokenIs(token.RPAREN) { // 不是 ) 结束
+		p.peekError(token.COMMA, token.RPAREN)
+		return
+	}
+	p.nextToken()
 }
 
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
-	defer untrace(trace("parseCallExpression"))
+	defer p.untrace(p.trace("parseCallExpression"))
 	exp := &ast.CallExpression{Token: p.curToken, Function: function}
-	exp.Arguments = p.parseExpressionList(token.RPAREN) // p.parseCallParameters()
+	if p.parseCallArguments(exp) {
+		exp.Rparen = p.curToken.Pos
+	}
 	return exp
 }
 
+// (a, ...b, name: c), 命名参数只能在位置参数之后, 同一个名字只能出现一次
+func (p *Parser) parseCallArguments(exp *ast.CallExpression) bool {
+	exp.Arguments = []ast.Expression{}
+	if p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		return true
+	}
+	for {
+		p.nextToken() // cur指向 `参数`
+		if p.curTokenIs(token.IDENT) && p.peekTokenIs(token.COLON) {
+			arg := &ast.NamedArgument{Name: &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}}
+			for _, n := range exp.Named {
+				if n.Name.Value == arg.Name.Value {
+					p.errorAt(p.curToken, nil, "repeated named argument: %s", arg.Name.Value)
+					return false
+				}
+			}
+			p.nextToken()
+			p.nextToken() // skip ':'
+			arg.Value = p.parseExpression(LOWEST)
+			exp.Named = append(exp.Named, arg)
+		} else if len(exp.Named) > 0 {
+			p.errorAt(p.curToken, nil, "positional argument follows named argument")
+			return false
+		} else {
+			exp.Arguments = append(exp.Arguments, p.parseListElement())
+		}
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken() // cur指向 `,`
+	}
+
+	if !p.peekTokenIs(token.RPAREN) { // 不是 ) 结束
+		p.peekError(token.COMMA, token.RPAREN)
+		return false
+	}
+	p.nextToken()
+	return true
+}
+
 /*
 func (p *Parser) parseCallParameters() []ast.Expression {
-	defer untrace(trace("parseCallParameters"))
+	defer p.untrace(p.trace("parseCallParameters"))
 	args := []ast.Expression{}
 
 	if p.peekTokenIs(token.RPAREN) {
@@ -541,10 +1204,9 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 	}
 }
 
-func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead",
-		t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+func (p *Parser) peekError(expected ...token.TokenType) {
+	p.errorAt(p.peekToken, expected, "expected next token to be %s, got %s instead",
+		expectedString(expected), p.peekToken.Type)
 }
 
 func (p *Parser) peekPrecedence() int {
@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"github.com/qiuhoude/go-interpreter/ast"
 	"github.com/qiuhoude/go-interpreter/lexer"
+	"github.com/qiuhoude/go-interpreter/token"
+	"math"
+	"strings"
 	"testing"
 )
 
@@ -73,6 +76,60 @@ func TestLetStatements(t *testing.T) {
 	}
 }
 
+func TestDestructuringPatterns(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let [a, b] = arr;", "let [a, b] = arr;"},
+		{"let [] = arr;", "let [] = arr;"},
+		{"let [a, ...rest] = arr;", "let [a, ...rest] = arr;"},
+		{"let [a, [b, c]] = arr;", "let [a, [b, c]] = arr;"},
+		{`let hash{"name": n, "age": a} = person;`, "let hash{name: n, age: a} = person;"},
+		{`let hash{"tags": [first, ...others], k: v} = h;`, "let hash{tags: [first, ...others], k: v} = h;"},
+		{"let f = fn([a, b], hash{1: c} = h, d = 0) { a };", "let f = fn([a, b], hash{1: c} = h, d = 0) a;"},
+	}
+	for _, tt := range tests {
+		program := buildAST(t, tt.input)
+		if program.String() != tt.expected {
+			t.Errorf("%q: want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	program := buildAST(t, `let [a, hash{"k": b}, ...c] = x;`)
+	stmt := program.Statements[0].(*ast.LetStatement)
+	if stmt.Name != nil {
+		t.Errorf("stmt.Name should be nil. got=%s", stmt.Name)
+	}
+	pat, ok := stmt.Pattern.(*ast.ArrayPattern)
+	if !ok {
+		t.Fatalf("stmt.Pattern is not ast.ArrayPattern. got=%T", stmt.Pattern)
+	}
+	if len(pat.Elements) != 2 || pat.Rest == nil || pat.Rest.Value != "c" {
+		t.Fatalf("wrong array pattern. got=%s", pat)
+	}
+	testIdentifier(t, pat.Elements[0].(*ast.Identifier), "a")
+	hashPat, ok := pat.Elements[1].(*ast.HashPattern)
+	if !ok {
+		t.Fatalf("pat.Elements[1] is not ast.HashPattern. got=%T", pat.Elements[1])
+	}
+	if key, ok := hashPat.Keys[0].(*ast.StringLiteral); !ok || key.Value != "k" {
+		t.Errorf("wrong hash pattern key. got=%s", hashPat.Keys[0])
+	}
+	if pat.Pos().Column != 5 || pat.End().Column != 28 {
+		t.Errorf("wrong pattern position. got=%s-%s", pat.Pos(), pat.End())
+	}
+
+	program = buildAST(t, "fn(a, [b, c]) { b }")
+	function := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if len(function.Patterns) != 2 || function.Patterns[0] != nil {
+		t.Fatalf("wrong function patterns. got=%v", function.Patterns)
+	}
+	if _, ok := function.Patterns[1].(*ast.ArrayPattern); !ok {
+		t.Errorf("function.Patterns[1] is not ast.ArrayPattern. got=%T", function.Patterns[1])
+	}
+}
+
 func TestAssignExpression(t *testing.T) {
 	tests := []struct {
 		input              string
@@ -136,6 +193,114 @@ func TestReturnStatements(t *testing.T) {
 	}
 }
 
+func TestThrowStatement(t *testing.T) {
+	program := buildAST(t, `fn() { throw "boom" }`)
+	fn := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if len(fn.Body.Statements) != 1 {
+		t.Fatalf("function body does not contain 1 statements. got=%d", len(fn.Body.Statements))
+	}
+	throwStmt, ok := fn.Body.Statements[0].(*ast.ThrowStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.ThrowStatement. got=%T", fn.Body.Statements[0])
+	}
+	if throwStmt.Value.String() != "boom" {
+		t.Errorf("throwStmt.Value wrong. got=%q", throwStmt.Value.String())
+	}
+}
+
+func TestTryExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		param    string
+		catch    bool
+		finally  bool
+		expected string
+	}{
+		{"try { x } catch (e) { e }", "e", true, false, "try x catch (e) e"},
+		{"try { x } catch { 1 }", "", true, false, "try x catch 1"},
+		{"try { x } finally { y }", "", false, true, "try x finally y"},
+		{"try { x } catch (err) { 1 } finally { y }", "err", true, true, "try x catch (err) 1 finally y"},
+	}
+
+	for _, tt := range tests {
+		program := buildAST(t, tt.input)
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		exp, ok := stmt.Expression.(*ast.TryExpression)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.TryExpression. got=%T", stmt.Expression)
+		}
+		if (exp.Param != nil && exp.Param.Value != tt.param) || (exp.Param == nil && tt.param != "") {
+			t.Errorf("%q: wrong catch param. got=%v", tt.input, exp.Param)
+		}
+		if (exp.Catch != nil) != tt.catch || (exp.Finally != nil) != tt.finally {
+			t.Errorf("%q: wrong catch/finally. got=%v/%v", tt.input, exp.Catch, exp.Finally)
+		}
+		if exp.String() != tt.expected {
+			t.Errorf("%q: wrong string. want=%q, got=%q", tt.input, tt.expected, exp.String())
+		}
+	}
+}
+
+func TestWhileStatement(t *testing.T) {
+	program := buildAST(t, "while (x < y) { x = x + 1; }; x")
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.WhileStatement. got=%T", program.Statements[0])
+	}
+	if !testInfixExpression(t, stmt.Condition, "x", "<", "y") {
+		return
+	}
+	if len(stmt.Body.Statements) != 1 {
+		t.Errorf("body is not 1 statements. got=%d", len(stmt.Body.Statements))
+	}
+}
+
+func TestForStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"for (let i = 0; i < 10; i = i + 1) { x }", "for (let i = 0; (i < 10); i = (i + 1)) x"},
+		{"for (i = 0; i < 10;) { x }", "for (i = 0; (i < 10); ) x"},
+		{"for (;;) { break; }", "for (; ; ) break;"},
+		{"for (;;) { if (x) { continue } }", "for (; ; ) ifx continue;"},
+	}
+	for _, tt := range tests {
+		program := buildAST(t, tt.input)
+		stmt, ok := program.Statements[0].(*ast.ForStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.ForStatement. got=%T", program.Statements[0])
+		}
+		if stmt.String() != tt.expected {
+			t.Errorf("wrong string. want=%q, got=%q", tt.expected, stmt.String())
+		}
+	}
+}
+
+func TestForInStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"for (x in arr) { x }", "for (x in arr) x"},
+		{"for (k, v in hash{\"a\": 1}) { k }", "for (k, v in hash{a:1}) k"},
+		{"for (i in range(1, 10)) { if (i > 5) { break } };", "for (i in range(1, 10)) if(i > 5) break;"},
+	}
+	for _, tt := range tests {
+		program := buildAST(t, tt.input)
+		stmt, ok := program.Statements[0].(*ast.ForInStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.ForInStatement. got=%T", program.Statements[0])
+		}
+		if stmt.String() != tt.expected {
+			t.Errorf("wrong string. want=%q, got=%q", tt.expected, stmt.String())
+		}
+	}
+}
+
 func TestIdentifierExpression(t *testing.T) {
 	input := "foobar;"
 
@@ -196,6 +361,82 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestBigIntegerLiteral(t *testing.T) {
+	program := buildAST(t, "123456789012345678901234567890")
+	lit, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IntegerLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.IntegerLiteral. got=%T", program.Statements[0])
+	}
+	if lit.Big == nil || lit.Big.String() != "123456789012345678901234567890" {
+		t.Errorf("lit.Big wrong. got=%v", lit.Big)
+	}
+
+	program = buildAST(t, "9223372036854775807")
+	lit = program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IntegerLiteral)
+	if lit.Big != nil || lit.Value != math.MaxInt64 {
+		t.Errorf("int64 literal should not be big. got=%v, %d", lit.Big, lit.Value)
+	}
+}
+
+func TestIntegerLiteralForms(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"0x1F", 31},
+		{"0XfF", 255},
+		{"0o17", 15},
+		{"0b1010", 10},
+		{"1_000_000", 1000000},
+		{"0x_FF_FF", 65535},
+		{"0b1111_0000", 240},
+	}
+	for _, tt := range tests {
+		program := buildAST(t, tt.input)
+		lit, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IntegerLiteral)
+		if !ok {
+			t.Fatalf("%q: exp not *ast.IntegerLiteral. got=%T", tt.input, program.Statements[0])
+		}
+		if lit.Value != tt.expected {
+			t.Errorf("%q: lit.Value wrong. want=%d, got=%d", tt.input, tt.expected, lit.Value)
+		}
+	}
+
+	program := buildAST(t, "123_456_789_012_345_678_901")
+	lit := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IntegerLiteral)
+	if lit.Big == nil || lit.Big.String() != "123456789012345678901" {
+		t.Errorf("lit.Big wrong. got=%v", lit.Big)
+	}
+
+	program = buildAST(t, "0xFFFF_FFFF_FFFF_FFFF_FF")
+	lit = program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IntegerLiteral)
+	if lit.Big == nil || lit.Big.String() != "4722366482869645213695" {
+		t.Errorf("lit.Big wrong. got=%v", lit.Big)
+	}
+}
+
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14;", 3.14},
+		{"1e-9", 1e-9},
+		{"2.5E+3", 2500},
+	}
+	for _, tt := range tests {
+		program := buildAST(t, tt.input)
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		lit, ok := stmt.Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+		}
+		if lit.Value != tt.expected {
+			t.Errorf("lit.Value not %g. got=%g", tt.expected, lit.Value)
+		}
+	}
+}
+
 func TestParsingPrefixExpressions(t *testing.T) {
 	prefixTests := []struct {
 		input        string
@@ -383,6 +624,46 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{
+			"a || b && c",
+			"(a || (b && c))",
+		},
+		{
+			"a == b && c < d || !e",
+			"(((a == b) && (c < d)) || (!e))",
+		},
+		{
+			"a % b * c",
+			"((a % b) * c)",
+		},
+		{
+			"x & 1 == 0",
+			"((x & 1) == 0)",
+		},
+		{
+			"a | b ^ c & d",
+			"(a | (b ^ (c & d)))",
+		},
+		{
+			"1 << 2 + 3 >> 1",
+			"((1 << (2 + 3)) >> 1)",
+		},
+		{
+			"a < b << c",
+			"(a < (b << c))",
+		},
+		{
+			"-2 ** 2",
+			"(-(2 ** 2))",
+		},
+		{
+			"2 ** 3 ** 2",
+			"(2 ** (3 ** 2))",
+		},
+		{
+			"a * b ** c[0]",
+			"(a * (b ** (c[0])))",
+		},
 	}
 	for _, tt := range tests {
 		program := buildAST(t, tt.input)
@@ -551,6 +832,113 @@ func TestFunctionParameterParsing(t *testing.T) {
 	}
 }
 
+func TestFunctionDefaultAndRestParameters(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedParams   []string
+		expectedDefaults []string
+		expectedRest     string
+		expectedString   string
+	}{
+		{"fn(a, b = 10) {}", []string{"a", "b"}, []string{"", "10"}, "", "fn(a, b = 10) "},
+		{"fn(a = 1 + 2, b = a) {}", []string{"a", "b"}, []string{"(1 + 2)", "a"}, "", "fn(a = (1 + 2), b = a) "},
+		{"fn(...rest) {}", nil, nil, "rest", "fn(...rest) "},
+		{"fn(a, b = 1, ...rest) {}", []string{"a", "b"}, []string{"", "1"}, "rest", "fn(a, b = 1, ...rest) "},
+		{"fn(a, b) {}", []string{"a", "b"}, nil, "", "fn(a, b) "},
+	}
+	for _, tt := range tests {
+		program := buildAST(t, tt.input)
+		function := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+		if len(function.Parameters) != len(tt.expectedParams) {
+			t.Fatalf("%q: wrong number of parameters. want=%d, got=%d",
+				tt.input, len(tt.expectedParams), len(function.Parameters))
+		}
+		for i, name := range tt.expectedParams {
+			testLiteralExpression(t, function.Parameters[i], name)
+		}
+		if len(function.Defaults) != len(tt.expectedDefaults) {
+			t.Fatalf("%q: wrong number of defaults. want=%d, got=%d",
+				tt.input, len(tt.expectedDefaults), len(function.Defaults))
+		}
+		for i, want := range tt.expectedDefaults {
+			got := ""
+			if function.Defaults[i] != nil {
+				got = function.Defaults[i].String()
+			}
+			if got != want {
+				t.Errorf("%q: wrong default %d. want=%q, got=%q", tt.input, i, want, got)
+			}
+		}
+		rest := ""
+		if function.Rest != nil {
+			rest = function.Rest.Value
+		}
+		if rest != tt.expectedRest {
+			t.Errorf("%q: wrong rest parameter. want=%q, got=%q", tt.input, tt.expectedRest, rest)
+		}
+		if function.String() != tt.expectedString {
+			t.Errorf("%q: wrong String(). want=%q, got=%q", tt.input, tt.expectedString, function.String())
+		}
+	}
+}
+
+func TestNamedArguments(t *testing.T) {
+	program := buildAST(t, "f(x, ...ys, timeout: 30, retries: a + 1)")
+	call := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.CallExpression)
+	if len(call.Arguments) != 2 {
+		t.Fatalf("wrong number of arguments. want=2, got=%d", len(call.Arguments))
+	}
+	if len(call.Named) != 2 {
+		t.Fatalf("wrong number of named arguments. want=2, got=%d", len(call.Named))
+	}
+	if call.Named[0].Name.Value != "timeout" {
+		t.Errorf("wrong name. want=timeout, got=%s", call.Named[0].Name.Value)
+	}
+	testIntegerLiteral(t, call.Named[0].Value, 30)
+	testInfixExpression(t, call.Named[1].Value, "a", "+", 1)
+	if call.String() != "f(x, ...ys, timeout: 30, retries: (a + 1))" {
+		t.Errorf("wrong String(). got=%q", call.String())
+	}
+	if call.Named[1].Pos().Column != 26 || call.Named[1].End().Column != 40 {
+		t.Errorf("wrong named argument position. got=%s-%s", call.Named[1].Pos(), call.Named[1].End())
+	}
+
+	// 只有调用参数中 name: 才是命名参数
+	program = buildAST(t, `f(hash{"a": 1})`)
+	call = program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.CallExpression)
+	if len(call.Arguments) != 1 || len(call.Named) != 0 {
+		t.Errorf("hash argument parsed as named argument: %s", call)
+	}
+}
+
+func TestSpreadExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"f(...args)", "f(...args)"},
+		{"f(1, ...a + b, 2)", "f(1, ...(a + b), 2)"},
+		{"[0, ...xs, ...[1, 2]]", "[0, ...xs, ...[1, 2]]"},
+	}
+	for _, tt := range tests {
+		program := buildAST(t, tt.input)
+		if program.String() != tt.expected {
+			t.Errorf("%q: want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	program := buildAST(t, "f(a, ...b)")
+	call := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.CallExpression)
+	spread, ok := call.Arguments[1].(*ast.SpreadExpression)
+	if !ok {
+		t.Fatalf("call.Arguments[1] is not ast.SpreadExpression. got=%T", call.Arguments[1])
+	}
+	testIdentifier(t, spread.Value, "b")
+	if spread.Pos().Column != 6 || spread.End().Column != 10 {
+		t.Errorf("wrong spread position. got=%s-%s", spread.Pos(), spread.End())
+	}
+}
+
 func TestCallExpressionParsing(t *testing.T) {
 	input := `add(1, 2 * 3, 4 + 5)`
 	program := buildAST(t, input)
@@ -832,6 +1220,402 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 	}
 }
 
+func TestNodePosition(t *testing.T) {
+	input := `let add = fn(a, b) {
+	a + b
+};
+add(1, [2, 3][0]);`
+	program := buildAST(t, input)
+
+	tests := []struct {
+		node          ast.Node
+		expectedStart string
+		expectedEnd   string
+	}{
+		{program, "1:1", "4:18"},
+		{program.Statements[0], "1:1", "3:2"},
+		{program.Statements[0].(*ast.LetStatement).Value, "1:11", "3:2"},
+		{program.Statements[1], "4:1", "4:18"},
+		{program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.CallExpression).Arguments[1], "4:8", "4:17"},
+	}
+	for _, tt := range tests {
+		if tt.node.Pos().String() != tt.expectedStart {
+			t.Errorf("%s: wrong pos. want=%s, got=%s", tt.node, tt.expectedStart, tt.node.Pos())
+		}
+		if tt.node.End().String() != tt.expectedEnd {
+			t.Errorf("%s: wrong end. want=%s, got=%s", tt.node, tt.expectedEnd, tt.node.End())
+		}
+	}
+}
+
+func TestParserErrorPosition(t *testing.T) {
+	input := `let a = 1;
+let b = add(1, 2;`
+	p := New(lexer.New(input))
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) != 1 {
+		t.Fatalf("expected 1 parser error. got=%d", len(errors))
+	}
+	expected := "2:17: expected next token to be , or ), got ; instead"
+	if errors[0].Error() != expected {
+		t.Errorf("wrong error. want=%q, got=%q", expected, errors[0].Error())
+	}
+	if errors[0].Found.Type != token.SEMICOLON {
+		t.Errorf("wrong found token. got=%q", errors[0].Found.Type)
+	}
+	if len(errors[0].Expected) != 2 || errors[0].Expected[1] != token.RPAREN {
+		t.Errorf("wrong expected tokens. got=%v", errors[0].Expected)
+	}
+	if errors[0].Severity != SeverityError {
+		t.Errorf("wrong severity. got=%s", errors[0].Severity)
+	}
+}
+
+func TestParserErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedErrors []string
+		expectedStmts  int
+	}{
+		{
+			// 一个错误只报告一次, 后面的语句正常解析
+			"let = 5; let b = 10; b;",
+			[]string{"1:5: expected next token to be IDENT, got = instead"},
+			2,
+		},
+		{
+			"let a = add(1, 2; let b = 10; b;",
+			[]string{"1:17: expected next token to be , or ), got ; instead"},
+			3, // `let a` 的值为 nil
+		},
+		{
+			"let f = fn(x) { x + ; let y = 1; y }; f(1);",
+			[]string{"1:21: no prefix parse function for ; found"},
+			2,
+		},
+		{
+			"fn(x) { x + }; 5;",
+			[]string{"1:13: no prefix parse function for } found"},
+			2,
+		},
+		{
+			"if (x { 1 }; let a = 2; let b = 3;",
+			[]string{"1:7: expected next token to be ), got { instead"},
+			3,
+		},
+		{
+			"try { 1 }; let a = 2;",
+			[]string{"1:10: expected next token to be CATCH or FINALLY, got ; instead"},
+			2,
+		},
+		{
+			// 没有 `;` 的 let/return 不能吞掉块的 `}`
+			"fn() { let a = 1 }; fn() { return 2 }; 3",
+			nil,
+			3,
+		},
+		{
+			"break; let a = 1;",
+			[]string{"1:1: break outside loop"},
+			1,
+		},
+		{
+			// 函数体中的 continue 不属于外层的循环
+			"while (true) { fn() { continue } }; 1",
+			[]string{"1:23: continue outside loop"},
+			2,
+		},
+		{
+			"while (true) { fn(a = { break }) { a } }; 1",
+			[]string{"1:25: break outside loop"},
+			2,
+		},
+		{
+			"for (let i = 0 i < 3; i = i + 1) { i }; 1",
+			[]string{"1:16: expected next token to be ;, got IDENT instead"},
+			1,
+		},
+		{
+			"for (k, 1 in arr) { k }; 1",
+			[]string{"1:9: expected next token to be IDENT, got INT instead"},
+			1,
+		},
+		{
+			"for (x in ) { x }; 1",
+			[]string{"1:11: no prefix parse function for ) found"},
+			1,
+		},
+		{
+			"let a = 1e999; 1",
+			[]string{"1:9: could not parse \"1e999\" as float"},
+			2,
+		},
+		{
+			"for () { x }; 1",
+			[]string{"1:6: no prefix parse function for ) found"},
+			1,
+		},
+		{
+			"let a = 0x; let b = 0b102; 1",
+			[]string{
+				"1:9: hexadecimal literal has no digits",
+				"1:21: invalid digit '2' in binary literal",
+			},
+			3,
+		},
+		{
+			"let a = 1__000 + 0o_7_;",
+			[]string{"1:9: '_' must separate successive digits"},
+			1,
+		},
+		{
+			`let s = "a\qb"; 1`,
+			[]string{`1:9: unknown escape sequence: \q`},
+			2,
+		},
+		{
+			`let s = "\x4"; let t = "\uD800"; 1`,
+			[]string{
+				`1:9: invalid escape sequence: \x needs 2 hex digits`,
+				"1:24: invalid Unicode code point in escape sequence: 0xd800",
+			},
+			3,
+		},
+		{
+			"let s = \"abc;\nlet t = 1;",
+			[]string{"1:9: unterminated string literal"},
+			1,
+		},
+		{
+			"let s = `abc",
+			[]string{"1:9: unterminated raw string literal"},
+			1,
+		},
+		{
+			`let s = "${}"; 1`,
+			[]string{"1:12: empty expression in string interpolation"},
+			2,
+		},
+		{
+			`let s = "${a b}"; 1`,
+			[]string{"1:14: expected } to close string interpolation, got IDENT instead"},
+			2,
+		},
+		{
+			"let f = fn(a = 1, b) { a }; 1",
+			[]string{"1:19: parameter b without default follows parameter with default"},
+			2,
+		},
+		{
+			"let f = fn(...a, b) { a }; 1",
+			[]string{"1:16: rest parameter must be the last parameter"},
+			2,
+		},
+		{
+			"let f = fn(a, ...) { a }; 1",
+			[]string{"1:18: expected next token to be IDENT, got ) instead"},
+			2,
+		},
+		{
+			"let [a, 1] = x; 1",
+			[]string{"1:9: expected IDENT or [ or HASH in pattern, got INT instead"},
+			1,
+		},
+		{
+			"let [...a, b] = x; 1",
+			[]string{"1:10: rest element must be the last element"},
+			1,
+		},
+		{
+			"let [a, b = x; 1",
+			[]string{"1:11: expected next token to be ], got = instead"},
+			1,
+		},
+		{
+			"f(a: 1, 2); 1",
+			[]string{"1:9: positional argument follows named argument"},
+			2,
+		},
+		{
+			"f(a: 1, a: 2); 1",
+			[]string{"1:9: repeated named argument: a"},
+			2,
+		},
+		{
+			"let a = ...b; 1",
+			[]string{"1:9: no prefix parse function for ... found"},
+			2,
+		},
+		{
+			"let a = €; 1",
+			[]string{"1:9: illegal character '€'"},
+			2,
+		},
+		{
+			// 词法错误, 位置是字面量的开头
+			"let a = 09; 1",
+			[]string{"1:9: invalid leading zero in decimal literal, use 0o for octal"},
+			2,
+		},
+		{
+			"let a = 123abc; 1",
+			[]string{"1:9: invalid digit 'a' in decimal literal"},
+			2,
+		},
+		{
+			// 出错时已经读过 hash 的 {, 要跳过它对应的 }
+			`let h = hash{"a" 1}; let b = 2;`,
+			[]string{"1:18: expected next token to be :, got INT instead"},
+			2,
+		},
+		{
+			`let hash{"a" b} = x; 1`,
+			[]string{"1:14: expected next token to be :, got IDENT instead"},
+			1,
+		},
+		{
+			// 嵌套的块中出错, 外层的块和后面的语句不受影响
+			"let f = fn() { if (x) { let = 1; 2 } else { 3 } }; let b = 2; b",
+			[]string{"1:29: expected next token to be IDENT, got = instead"},
+			3,
+		},
+		{
+			`let f = fn() { let h = hash{"a" 1}; { 2 } }; f();`,
+			[]string{"1:33: expected next token to be :, got INT instead"},
+			2,
+		},
+		{
+			"} let a = 1;",
+			[]string{"1:1: no prefix parse function for } found"},
+			2,
+		},
+		{
+			"let a = 1;\nlet = 2;\nlet c 3;\nlet d = 4;",
+			[]string{
+				"2:5: expected next token to be IDENT, got = instead",
+				"3:7: expected next token to be =, got INT instead",
+			},
+			2,
+		},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		errors := p.Errors()
+		if len(errors) != len(tt.expectedErrors) {
+			t.Errorf("%q: wrong number of errors. want=%d, got=%d %v",
+				tt.input, len(tt.expectedErrors), len(errors), errors)
+			continue
+		}
+		for i, want := range tt.expectedErrors {
+			if errors[i].Error() != want {
+				t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, want, errors[i].Error())
+			}
+		}
+		if len(program.Statements) != tt.expectedStmts {
+			t.Errorf("%q: wrong number of statements. want=%d, got=%d (%s)",
+				tt.input, tt.expectedStmts, len(program.Statements), program)
+		}
+	}
+}
+
+func TestInterpolatedString(t *testing.T) {
+	input := `"Hello ${name}, total ${a + b}!"`
+	program := buildAST(t, input)
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+	}
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	str, ok := stmt.Expression.(*ast.InterpolatedString)
+	if !ok {
+		t.Fatalf("exp not *ast.InterpolatedString. got=%T", stmt.Expression)
+	}
+	if str.String() != "Hello ${name}, total ${(a + b)}!" {
+		t.Errorf("str.String() wrong. got=%q", str.String())
+	}
+	if len(str.Parts) != 5 {
+		t.Fatalf("wrong number of parts. got=%d", len(str.Parts))
+	}
+	for i, want := range []string{"Hello ", "name", ", total ", "(a + b)", "!"} {
+		if str.Parts[i].String() != want {
+			t.Errorf("parts[%d] wrong. want=%q, got=%q", i, want, str.Parts[i].String())
+		}
+	}
+	if _, ok := str.Parts[2].(*ast.StringLiteral); !ok {
+		t.Errorf("parts[2] not *ast.StringLiteral. got=%T", str.Parts[2])
+	}
+	if str.Pos().Offset != 0 || str.End().Offset != len(input) {
+		t.Errorf("wrong range. got=%+v - %+v", str.Pos(), str.End())
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `#!/usr/bin/env xq
+// add 返回两数之和
+let add = fn(x, y) {
+	x + y /* 不需要 return */
+};
+add(1, 2); // 3`
+
+	for _, scan := range []bool{false, true} {
+		l := lexer.New(input)
+		if scan {
+			l.SetMode(lexer.ScanComments)
+		}
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if len(program.Statements) != 2 {
+			t.Fatalf("wrong number of statements. got=%d (%s)", len(program.Statements), program)
+		}
+		if program.String() != "let add = fn(x, y) (x + y);add(1, 2)" {
+			t.Errorf("wrong program. got=%q", program.String())
+		}
+		if !scan {
+			if len(program.Comments) != 0 {
+				t.Errorf("expected no comments. got=%d", len(program.Comments))
+			}
+			continue
+		}
+		expected := []string{"#!/usr/bin/env xq", "// add 返回两数之和", "/* 不需要 return */", "// 3"}
+		if len(program.Comments) != len(expected) {
+			t.Fatalf("wrong number of comments. want=%d, got=%d", len(expected), len(program.Comments))
+		}
+		for i, want := range expected {
+			if program.Comments[i].Literal != want {
+				t.Errorf("comments[%d] wrong. want=%q, got=%q", i, want, program.Comments[i].Literal)
+			}
+		}
+		if program.Comments[1].Pos.Line != 2 || program.Comments[2].Pos.Line != 4 {
+			t.Errorf("wrong comment positions. got=%s, %s", program.Comments[1].Pos, program.Comments[2].Pos)
+		}
+	}
+}
+
+func TestMaxErrors(t *testing.T) {
+	input := strings.Repeat("let = 1;\n", 20)
+
+	p := New(lexer.New(input))
+	p.ParseProgram()
+	if len(p.Errors()) != DefaultMaxErrors+1 {
+		t.Fatalf("wrong number of errors. want=%d, got=%d",
+			DefaultMaxErrors+1, len(p.Errors()))
+	}
+	if last := p.Errors()[DefaultMaxErrors]; last.Msg != "too many errors" {
+		t.Errorf("last error should be 'too many errors'. got=%q", last.Msg)
+	}
+
+	p = New(lexer.New(input))
+	p.SetMaxErrors(0)
+	p.ParseProgram()
+	if len(p.Errors()) != 20 {
+		t.Errorf("wrong number of errors without limit. got=%d", len(p.Errors()))
+	}
+}
+
 func buildAST(t *testing.T, input string) *ast.Program {
 	l := lexer.New(input)
 	p := New(l)
@@ -6,30 +6,29 @@ import (
 	"strings"
 )
 
-var traceLevel int = 0
-
 const traceIdentPlaceholder string = "\t"
 
-func identLevel() string {
-	return strings.Repeat(traceIdentPlaceholder, traceLevel-1)
+// trace 的缩进层级保存在 Parser 上, 多个 parser 并发使用时互不影响
+func (p *Parser) identLevel() string {
+	return strings.Repeat(traceIdentPlaceholder, p.traceLevel-1)
 }
 
-func tracePrint(fs string) {
+func (p *Parser) tracePrint(fs string) {
 
-	_, _ = fmt.Fprintf(ioutil.Discard, "%s%s\n", identLevel(), fs)
-	//_, _ = fmt.Fprintf(os.Stdout, "%s%s\n", identLevel(), fs)
+	_, _ = fmt.Fprintf(ioutil.Discard, "%s%s\n", p.identLevel(), fs)
+	//_, _ = fmt.Fprintf(os.Stdout, "%s%s\n", p.identLevel(), fs)
 }
 
-func incIdent() { traceLevel = traceLevel + 1 }
-func decIdent() { traceLevel = traceLevel - 1 }
+func (p *Parser) incIdent() { p.traceLevel = p.traceLevel + 1 }
+func (p *Parser) decIdent() { p.traceLevel = p.traceLevel - 1 }
 
-func trace(msg string) string {
-	incIdent()
-	tracePrint("BEGIN " + msg)
+func (p *Parser) trace(msg string) string {
+	p.incIdent()
+	p.tracePrint("BEGIN " + msg)
 	return msg
 }
 
-func untrace(msg string) {
-	tracePrint("END " + msg)
-	decIdent()
+func (p *Parser) untrace(msg string) {
+	p.tracePrint("END " + msg)
+	p.decIdent()
 }
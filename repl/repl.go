@@ -3,10 +3,12 @@ package repl
 import (
 	"bufio"
 	"fmt"
-	"github.com/qiuhoude/go-interpreter/evaluator"
+	"github.com/qiuhoude/go-interpreter/compiler"
+	"github.com/qiuhoude/go-interpreter/interp"
 	"github.com/qiuhoude/go-interpreter/lexer"
 	"github.com/qiuhoude/go-interpreter/object"
 	"github.com/qiuhoude/go-interpreter/parser"
+	"github.com/qiuhoude/go-interpreter/vm"
 	"io"
 )
 
@@ -17,8 +19,41 @@ Read Eval Print Loop = repl
 const PROMPT = ">>"
 
 func Start(in io.Reader, out io.Writer) {
+	// 脚本中的 input() 与 repl 共用同一个 reader, 避免缓冲区互相抢数据
+	reader := bufio.NewReader(in)
+	interpreter := interp.New(interp.WithStdout(out), interp.WithStdin(reader))
+
+	for {
+		fmt.Println(PROMPT)
+		line, err := reader.ReadString('\n')
+		if err != nil && line == "" {
+			return
+		}
+
+		evaluated, err := interpreter.Eval(line)
+		if perr, ok := err.(*interp.ParseError); ok {
+			printParserErrors(out, perr.Errors)
+			continue
+		}
+		if errObj, ok := err.(*object.Error); ok {
+			_, _ = fmt.Fprintf(out, "%s\n%s", errObj.Inspect(), errObj.StackTrace())
+			continue
+		}
+		if evaluated != nil {
+			_, _ = fmt.Fprintf(out, "%s\n", evaluated.Inspect())
+		}
+	}
+}
+
+// 使用 compiler + vm 执行
+func StartVM(in io.Reader, out io.Writer) {
 	scanner := bufio.NewScanner(in)
 
+	// 每行单独编译执行, 全局变量需要在多次执行之间共享
+	var constants []object.Object
+	globals := make([]object.Object, vm.GlobalsSize)
+	symbolTable := compiler.NewSymbolTable()
+
 	for {
 		fmt.Println(PROMPT)
 		scanned := scanner.Scan()
@@ -30,24 +65,32 @@ func Start(in io.Reader, out io.Writer) {
 
 		p := parser.New(l)
 
-		program := p.ParseProgram() // AST
+		program := p.ParseProgram()
 		if len(p.Errors()) != 0 {
 			printParserErrors(out, p.Errors())
 			continue
 		}
-		//_, _ = fmt.Fprintf(out, "%s\n", program.String())
 
-		//for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
-		//	_, _ = fmt.Fprintf(out, "%+v\n", tok)
-		//}
+		comp := compiler.NewWithState(symbolTable, constants)
+		if err := comp.Compile(program); err != nil {
+			_, _ = fmt.Fprintf(out, " compilation failed:\n\t%s\n", err)
+			continue
+		}
+		code := comp.Bytecode()
+		constants = code.Constants
 
-		evaluated := evaluator.Eval(program, object.GlobalEnv())
-		if evaluated != nil {
-			_, _ = fmt.Fprintf(out, "%s\n", evaluated.Inspect())
+		machine := vm.NewWithGlobalsStore(code, globals)
+		if err := machine.Run(); err != nil {
+			_, _ = fmt.Fprintf(out, " executing bytecode failed:\n\t%s\n", err)
+			continue
+		}
+		if result := machine.Result(); result != nil {
+			_, _ = fmt.Fprintf(out, "%s\n", result.Inspect())
 		}
 	}
 }
-func printParserErrors(out io.Writer, errors []string) {
+
+func printParserErrors(out io.Writer, errors []*parser.Error) {
 	_, _ = fmt.Fprint(out, " parser errors:\n")
 	for _, msg := range errors {
 		_, _ = fmt.Fprintf(out, "\t%v\n", msg)
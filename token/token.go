@@ -1,21 +1,65 @@
 package token
 
+import "fmt"
+
 type TokenType string
 
 type Token struct {
 	Type    TokenType // 类型
 	Literal string    // 文字内容
+	Pos     Position  // 起始位置
+	End     Position  // 结束位置, 指向 token 之后的第一个字符
+	Msg     string    // ILLEGAL token 的错误原因
+}
+
+// 源码中的位置
+type Position struct {
+	Filename string
+	Offset   int // 字节偏移, 从 0 开始
+	Line     int // 行号, 从 1 开始
+	Column   int // 列号, 从 1 开始
+}
+
+// Line 为 0 表示没有位置信息
+func (p Position) IsValid() bool { return p.Line > 0 }
+
+// 同一行内向后移动 n 个字符
+func (p Position) Shift(n int) Position {
+	p.Offset += n
+	p.Column += n
+	return p
+}
+
+// file:line:column 或者 line:column
+func (p Position) String() string {
+	if !p.IsValid() {
+		if p.Filename != "" {
+			return p.Filename
+		}
+		return "-"
+	}
+	if p.Filename != "" {
+		return fmt.Sprintf("%s:%d:%d", p.Filename, p.Line, p.Column)
+	}
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
 }
 
 const (
 	ILLEGAL TokenType = "ILLEGAL"
 	EOF               = "EOF"
+	COMMENT           = "COMMENT" // 只有 lexer 开启 ScanComments 时才会出现
 
 	// Identifiers literals
 	IDENT  = "IDENT" // add ,fn, x, y, ...
 	INT    = "INT"   // 1234567890
+	FLOAT  = "FLOAT" // 3.14, 1e-9
 	STRING = "STRING"
 
+	// 带插值的字符串 "a${x}b${y}c" 分成 INTERP_HEAD(a) x INTERP_MIDDLE(b) y INTERP_TAIL(c)
+	INTERP_HEAD   = "INTERP_HEAD"   // "a${
+	INTERP_MIDDLE = "INTERP_MIDDLE" // }b${
+	INTERP_TAIL   = "INTERP_TAIL"   // }c"
+
 	// Operator
 	ASSIGN   = "="
 	PLUS     = "+"
@@ -29,6 +73,15 @@ const (
 	GEQ      = ">="
 	EQ       = "=="
 	NOT_EQ   = "!="
+	PERCENT  = "%"
+	POW      = "**"
+	AND      = "&&"
+	OR       = "||"
+	BIT_AND  = "&"
+	BIT_OR   = "|"
+	BIT_XOR  = "^"
+	SHL      = "<<"
+	SHR      = ">>"
 
 	// Delimiters
 	COMMA     = ","
@@ -40,6 +93,7 @@ const (
 	LBRACKET  = "["
 	RBRACKET  = "]"
 	COLON     = ":"
+	ELLIPSIS  = "..." // 剩余参数和展开
 
 	// Keywords
 	FUNCTION = "FUNCTION"
@@ -50,17 +104,35 @@ const (
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
 	HASH     = "HASH" // hash表
+	THROW    = "THROW"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	FINALLY  = "FINALLY"
+	WHILE    = "WHILE"
+	FOR      = "FOR"
+	IN       = "IN"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
 )
 
 var keyword = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"true":   TRUE,
-	"false":  FALSE,
-	"if":     IF,
-	"else":   ELSE,
-	"return": RETURN,
-	"hash":   HASH,
+	"fn":       FUNCTION,
+	"let":      LET,
+	"true":     TRUE,
+	"false":    FALSE,
+	"if":       IF,
+	"else":     ELSE,
+	"return":   RETURN,
+	"hash":     HASH,
+	"throw":    THROW,
+	"try":      TRY,
+	"catch":    CATCH,
+	"finally":  FINALLY,
+	"while":    WHILE,
+	"for":      FOR,
+	"in":       IN,
+	"break":    BREAK,
+	"continue": CONTINUE,
 }
 
 func LookupIdent(ident string) TokenType {
@@ -0,0 +1,67 @@
+package vm
+
+import (
+	"github.com/qiuhoude/go-interpreter/code"
+	"github.com/qiuhoude/go-interpreter/object"
+)
+
+// 调用帧, 每次函数调用都会创建一个
+type Frame struct {
+	cl          *object.Closure
+	ip          int // 当前函数中执行到的指令位置
+	basePointer int // 调用前的栈顶位置, 函数返回时恢复
+	locals      []object.Object
+	scopes      [][]object.Object // 循环体当次迭代的变量, 最内层的循环在最后
+	blocks      []block           // 当前函数中进入的循环和 try, 最内层在最后
+}
+
+type blockKind int
+
+const (
+	loopBlock    blockKind = iota
+	tryBlock               // 执行 try 的部分
+	catchBlock             // 执行 catch 的部分
+	finallyBlock           // 执行 finally 的部分
+)
+
+// 循环或者 try 对应的块. break, continue, return 和错误离开块时恢复栈顶和循环体的槽位, 并在需要时先执行 finally
+type block struct {
+	kind   blockKind
+	sp     int // 进入块时的栈顶
+	scopes int // 进入块时 Frame.scopes 的长度
+
+	breakIP    int // 循环
+	continueIP int
+	catchIP    int // try, 没有 catch 时为 0
+	finallyIP  int
+	pending    completion // finally 执行完之后继续的动作
+}
+
+type completionKind int
+
+const (
+	normalCompletion completionKind = iota // try 或 catch 正常结束
+	errorCompletion
+	returnCompletion
+	breakCompletion
+	continueCompletion
+)
+
+// 离开块的方式, value 是 try 的值, 错误或者返回值
+type completion struct {
+	kind  completionKind
+	value object.Object
+}
+
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	f := &Frame{cl: cl, ip: -1, basePointer: basePointer}
+	if cl.Fn.NumLocals > 0 {
+		// 局部变量不放在栈上, 闭包通过切片引用它们
+		f.locals = make([]object.Object, cl.Fn.NumLocals)
+	}
+	return f
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
@@ -0,0 +1,598 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/qiuhoude/go-interpreter/code"
+	"github.com/qiuhoude/go-interpreter/compiler"
+	"github.com/qiuhoude/go-interpreter/evaluator"
+	"github.com/qiuhoude/go-interpreter/object"
+	"math"
+	"strings"
+)
+
+/*
+基于栈的虚拟机, 执行 compiler 生成的字节码
+运算语义复用 evaluator 中的实现, 保证两种后端得到相同的结果,
+integer 运算是最常见的情况, 直接在 vm 中处理
+*/
+
+const (
+	StackSize   = 2048
+	GlobalsSize = 65536
+	MaxFrames   = 1024
+)
+
+// 指令对应的运算符, 交给 evaluator 处理时使用
+var infixOperators = map[code.Opcode]string{
+	code.OpAdd:          "+",
+	code.OpSub:          "-",
+	code.OpMul:          "*",
+	code.OpDiv:          "/",
+	code.OpEqual:        "==",
+	code.OpNotEqual:     "!=",
+	code.OpGreaterThan:  ">",
+	code.OpGreaterEqual: ">=",
+	code.OpLessThan:     "<",
+	code.OpLessEqual:    "<=",
+	code.OpMod:          "%",
+	code.OpBitAnd:       "&",
+	code.OpBitOr:        "|",
+	code.OpBitXor:       "^",
+	code.OpShiftLeft:    "<<",
+	code.OpShiftRight:   ">>",
+	code.OpPow:          "**",
+}
+
+type VM struct {
+	constants   []object.Object
+	globals     []object.Object
+	globalNames []string
+
+	stack []object.Object
+	sp    int // 指向下一个空位, 栈顶为 stack[sp-1]
+
+	frames      []*Frame
+	framesIndex int
+
+	lastPopped object.Object
+	result     object.Object // 顶层 return 或者运行时错误
+}
+
+func New(bytecode *compiler.Bytecode) *VM {
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	mainFrame := NewFrame(&object.Closure{Fn: mainFn}, 0)
+
+	frames := make([]*Frame, MaxFrames)
+	frames[0] = mainFrame
+
+	return &VM{
+		constants:   bytecode.Constants,
+		globals:     make([]object.Object, GlobalsSize),
+		globalNames: bytecode.GlobalNames,
+		stack:       make([]object.Object, StackSize),
+		frames:      frames,
+		framesIndex: 1,
+	}
+}
+
+// 使用已有的全局变量, 用于 repl 多次执行共享全局变量
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
+	vm := New(bytecode)
+	vm.globals = s
+	return vm
+}
+
+// 执行结果, 和 evaluator.Eval 的返回值对应
+func (vm *VM) Result() object.Object {
+	if vm.result != nil {
+		return vm.result
+	}
+	return vm.lastPopped
+}
+
+// 脚本的运行时错误以 *object.Error 作为 Result 返回, error 只表示字节码本身有问题
+func (vm *VM) Run() error {
+	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		frame := vm.currentFrame()
+		frame.ip++
+
+		ip := frame.ip
+		ins := frame.Instructions()
+		op := code.Opcode(ins[ip])
+
+		var errObj *object.Error
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			errObj = vm.push(vm.constants[constIndex])
+		case code.OpPop:
+			vm.lastPopped = vm.pop()
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv,
+			code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpGreaterEqual,
+			code.OpLessThan, code.OpLessEqual, code.OpMod, code.OpBitAnd, code.OpBitOr,
+			code.OpBitXor, code.OpShiftLeft, code.OpShiftRight, code.OpPow:
+			errObj = vm.executeInfixOperation(op)
+		case code.OpMinus, code.OpPlus:
+			errObj = vm.executeMinusOrPlusOperator(op)
+		case code.OpBang:
+			errObj = vm.push(evaluator.EvalPrefix("!", vm.pop()))
+		case code.OpTrue:
+			errObj = vm.push(evaluator.TRUE)
+		case code.OpFalse:
+			errObj = vm.push(evaluator.FALSE)
+		case code.OpNull:
+			errObj = vm.push(evaluator.NULL)
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip = pos - 1
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			if !evaluator.IsTruthy(vm.pop()) {
+				frame.ip = pos - 1
+			}
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			val := vm.globals[globalIndex]
+			if val == nil {
+				errObj = evaluator.NewTypedError(object.NameErrorClass, "identifier not found: %s", vm.globalName(int(globalIndex)))
+			} else {
+				errObj = vm.push(val)
+			}
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			vm.globals[globalIndex] = vm.pop()
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+			errObj = vm.push(orNull(frame.locals[localIndex]))
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+			frame.locals[localIndex] = vm.pop()
+		case code.OpGetFree:
+			depth := code.ReadUint8(ins[ip+1:])
+			freeIndex := code.ReadUint8(ins[ip+2:])
+			frame.ip += 2
+			errObj = vm.push(orNull(frame.cl.Free[depth][freeIndex]))
+		case code.OpSetFree:
+			depth := code.ReadUint8(ins[ip+1:])
+			freeIndex := code.ReadUint8(ins[ip+2:])
+			frame.ip += 2
+			frame.cl.Free[depth][freeIndex] = vm.pop()
+		case code.OpGetBuiltin:
+			builtinIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+			builtin, _ := evaluator.LookupBuiltin(evaluator.BuiltinNames[builtinIndex])
+			errObj = vm.push(builtin)
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			elements := make([]object.Object, numElements)
+			copy(elements, vm.stack[vm.sp-numElements:vm.sp])
+			vm.sp = vm.sp - numElements
+			errObj = vm.push(&object.Array{Elements: elements})
+		case code.OpConcat:
+			numParts := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			var out strings.Builder
+			for _, part := range vm.stack[vm.sp-numParts : vm.sp] {
+				out.WriteString(evaluator.ToString(part))
+			}
+			vm.sp = vm.sp - numParts
+			errObj = vm.push(&object.String{Value: out.String()})
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			var hash object.Object
+			hash, errObj = vm.buildHash(vm.sp-numElements, vm.sp)
+			if errObj == nil {
+				vm.sp = vm.sp - numElements
+				errObj = vm.push(hash)
+			}
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+			errObj = vm.push(evaluator.EvalIndex(left, index))
+		case code.OpCall:
+			numArgs := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+			errObj = vm.executeCall(numArgs)
+		case code.OpReturnValue:
+			if vm.unwind(completion{kind: returnCompletion, value: vm.pop()}) {
+				return nil
+			}
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			errObj = vm.pushClosure(int(constIndex))
+		case code.OpThrow:
+			errObj = evaluator.NewThrownError(vm.pop())
+		case code.OpSetupLoop:
+			breakIP := int(code.ReadUint16(ins[ip+1:]))
+			continueIP := int(code.ReadUint16(ins[ip+3:]))
+			frame.ip += 4
+			frame.blocks = append(frame.blocks, block{kind: loopBlock, sp: vm.sp, scopes: len(frame.scopes),
+				breakIP: breakIP, continueIP: continueIP})
+		case code.OpPopBlock:
+			frame.blocks = frame.blocks[:len(frame.blocks)-1]
+		case code.OpBreak:
+			vm.unwind(completion{kind: breakCompletion})
+		case code.OpContinue:
+			vm.unwind(completion{kind: continueCompletion})
+		case code.OpSetupTry:
+			catchIP := int(code.ReadUint16(ins[ip+1:]))
+			finallyIP := int(code.ReadUint16(ins[ip+3:]))
+			frame.ip += 4
+			frame.blocks = append(frame.blocks, block{kind: tryBlock, sp: vm.sp, scopes: len(frame.scopes),
+				catchIP: catchIP, finallyIP: finallyIP})
+		case code.OpEndTry:
+			vm.enterFinally(frame, completion{kind: normalCompletion, value: vm.pop()})
+		case code.OpEndFinally:
+			b := frame.blocks[len(frame.blocks)-1]
+			frame.blocks = frame.blocks[:len(frame.blocks)-1]
+			if b.pending.kind == normalCompletion {
+				errObj = vm.push(b.pending.value)
+			} else if vm.unwind(b.pending) {
+				return nil
+			}
+		case code.OpIter:
+			errObj = vm.executeIter()
+		case code.OpIterNext:
+			endIP := int(code.ReadUint16(ins[ip+1:]))
+			numVars := int(code.ReadUint8(ins[ip+3:]))
+			frame.ip += 3
+			errObj = vm.executeIterNext(frame, endIP, numVars)
+		case code.OpPushScope:
+			numVars := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			var vars []object.Object
+			if numVars > 0 {
+				vars = make([]object.Object, numVars)
+			}
+			frame.scopes = append(frame.scopes, vars)
+		case code.OpPopScope:
+			frame.scopes = frame.scopes[:len(frame.scopes)-1]
+		case code.OpGetLoop:
+			depth := int(code.ReadUint8(ins[ip+1:]))
+			index := code.ReadUint8(ins[ip+2:])
+			frame.ip += 2
+			errObj = vm.push(orNull(frame.scopes[len(frame.scopes)-1-depth][index]))
+		case code.OpSetLoop:
+			depth := int(code.ReadUint8(ins[ip+1:]))
+			index := code.ReadUint8(ins[ip+2:])
+			frame.ip += 2
+			frame.scopes[len(frame.scopes)-1-depth][index] = vm.pop()
+		default:
+			def, err := code.Lookup(byte(op))
+			if err != nil {
+				return err
+			}
+			return fmt.Errorf("unhandled opcode %s", def.Name)
+		}
+
+		if errObj != nil && vm.unwind(completion{kind: errorCompletion, value: errObj}) { // 没有被 catch 的错误结束执行
+			return nil
+		}
+	}
+	return nil
+}
+
+// break, continue, return 或者错误离开当前的块, 按照从内到外的顺序处理经过的循环和 try.
+// 遇到 finally 时先执行 finally, 结束后由 OpEndFinally 继续. 返回 true 表示执行结束
+func (vm *VM) unwind(c completion) bool {
+	for {
+		frame := vm.currentFrame()
+		for len(frame.blocks) > 0 {
+			b := &frame.blocks[len(frame.blocks)-1]
+			switch b.kind {
+			case loopBlock:
+				if c.kind == breakCompletion || c.kind == continueCompletion {
+					vm.sp = b.sp
+					frame.scopes = frame.scopes[:b.scopes]
+					frame.ip = b.continueIP - 1
+					if c.kind == breakCompletion {
+						frame.ip = b.breakIP - 1
+					}
+					return false
+				}
+			case tryBlock, catchBlock:
+				errObj, isErr := c.value.(*object.Error)
+				if isErr && c.kind == errorCompletion && !evaluator.IsCatchable(errObj) {
+					break // 超出限制的错误不能被 catch, 也不执行 finally
+				}
+				if isErr && c.kind == errorCompletion && b.kind == tryBlock && b.catchIP > 0 {
+					b.kind = catchBlock
+					vm.sp = b.sp
+					frame.scopes = frame.scopes[:b.scopes]
+					frame.ip = b.catchIP - 1
+					if overflow := vm.push(evaluator.ErrorToHash(errObj)); overflow != nil {
+						c = completion{kind: errorCompletion, value: overflow}
+						continue
+					}
+					return false
+				}
+				vm.enterFinally(frame, c)
+				return false
+			}
+			// 离开循环, 或者 finally 中的 break, continue, return 和错误覆盖之前的动作
+			frame.blocks = frame.blocks[:len(frame.blocks)-1]
+		}
+
+		switch c.kind {
+		case returnCompletion:
+			returned := vm.popFrame()
+			if vm.framesIndex == 0 { // 顶层的 return 直接结束
+				vm.result = c.value
+				return true
+			}
+			vm.sp = returned.basePointer
+			vm.stack[vm.sp] = c.value
+			vm.sp++
+			return false
+		case errorCompletion: // 传递给调用者
+			returned := vm.popFrame()
+			if vm.framesIndex == 0 {
+				vm.result = c.value
+				return true
+			}
+			vm.sp = returned.basePointer
+		default: // parser 保证 break 和 continue 只出现在循环中
+			vm.result = evaluator.NewError("break or continue outside loop")
+			return true
+		}
+	}
+}
+
+// try 或 catch 结束, 记录之后要继续的动作并跳转到 finally
+func (vm *VM) enterFinally(frame *Frame, c completion) {
+	b := &frame.blocks[len(frame.blocks)-1]
+	b.kind = finallyBlock
+	b.pending = c
+	vm.sp = b.sp
+	frame.scopes = frame.scopes[:b.scopes]
+	frame.ip = b.finallyIP - 1
+}
+
+// 迭代器只在 vm 的栈上使用
+type iterator struct {
+	iter object.Iterator
+	hash bool // 一个循环变量时 hash 绑定 key, 其他绑定 value
+}
+
+func (it *iterator) Type() object.ObjectType { return "ITERATOR" }
+func (it *iterator) Inspect() string         { return "iterator" }
+
+func (vm *VM) executeIter() *object.Error {
+	obj := vm.pop()
+	iterable, ok := obj.(object.Iterable)
+	if !ok {
+		return evaluator.NewTypedError(object.TypeErrorClass, "object is not iterable: %s", obj.Type())
+	}
+	return vm.push(&iterator{iter: iterable.Iter(), hash: obj.Type() == object.HASH_OBJ})
+}
+
+// 栈顶是迭代器, 迭代结束时跳转到 endIP
+func (vm *VM) executeIterNext(frame *Frame, endIP, numVars int) *object.Error {
+	it := vm.stack[vm.sp-1].(*iterator)
+	key, value, ok := it.iter.Next()
+	switch {
+	case !ok:
+		frame.ip = endIP - 1
+		return nil
+	case numVars == 2:
+		if errObj := vm.push(key); errObj != nil {
+			return errObj
+		}
+		return vm.push(value)
+	case it.hash:
+		return vm.push(key)
+	default:
+		return vm.push(value)
+	}
+}
+
+func (vm *VM) executeInfixOperation(op code.Opcode) *object.Error {
+	right := vm.pop()
+	left := vm.pop()
+
+	if l, ok := left.(*object.Integer); ok {
+		if r, ok := right.(*object.Integer); ok {
+			if result, ok := integerInfixOperation(op, l.Value, r.Value); ok {
+				return vm.push(result)
+			}
+			if op == code.OpDiv && r.Value == 0 {
+				return evaluator.NewTypedError(object.ArgumentErrorClass, "division by zero")
+			}
+		}
+	}
+	// 溢出时也交给 evaluator, 提升为 BigInt
+	return vm.push(evaluator.EvalInfix(infixOperators[op], left, right))
+}
+
+// integer 运算的快速路径, ok 为 false 时表示溢出, 除零或者不支持的运算符
+func integerInfixOperation(op code.Opcode, left, right int64) (object.Object, bool) {
+	switch op {
+	case code.OpAdd:
+		v, ok := evaluator.AddInt(left, right)
+		return object.NewInteger(v), ok
+	case code.OpSub:
+		v, ok := evaluator.SubInt(left, right)
+		return object.NewInteger(v), ok
+	case code.OpMul:
+		v, ok := evaluator.MulInt(left, right)
+		return object.NewInteger(v), ok
+	case code.OpDiv:
+		if right == 0 || (left == math.MinInt64 && right == -1) {
+			return nil, false
+		}
+		return object.NewInteger(left / right), true
+	case code.OpEqual:
+		return nativeBoolToBooleanObject(left == right), true
+	case code.OpNotEqual:
+		return nativeBoolToBooleanObject(left != right), true
+	case code.OpGreaterThan:
+		return nativeBoolToBooleanObject(left > right), true
+	case code.OpGreaterEqual:
+		return nativeBoolToBooleanObject(left >= right), true
+	case code.OpLessThan:
+		return nativeBoolToBooleanObject(left < right), true
+	case code.OpLessEqual:
+		return nativeBoolToBooleanObject(left <= right), true
+	}
+	return nil, false
+}
+
+// integer 不可变, 取负总是生成新对象
+func (vm *VM) executeMinusOrPlusOperator(op code.Opcode) *object.Error {
+	operand := vm.pop()
+	if i, ok := operand.(*object.Integer); ok && i.Value != math.MinInt64 { // -MinInt64 需要提升为 BigInt
+		if op == code.OpMinus {
+			return vm.push(object.NewInteger(-i.Value))
+		}
+		return vm.push(i)
+	}
+	operator := "-"
+	if op == code.OpPlus {
+		operator = "+"
+	}
+	return vm.push(evaluator.EvalPrefix(operator, operand))
+}
+
+func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, *object.Error) {
+	pairs := make(map[object.HashKey]object.HashPair)
+	for i := startIndex; i < endIndex; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return nil, evaluator.NewTypedError(object.TypeErrorClass, "unusable as hash key: %s", key.Type())
+		}
+		pairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+	return &object.Hash{Pairs: pairs}, nil
+}
+
+func (vm *VM) executeCall(numArgs int) *object.Error {
+	callee := vm.stack[vm.sp-1-numArgs]
+	switch callee := callee.(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs)
+	case *object.Builtin:
+		args := vm.stack[vm.sp-numArgs : vm.sp]
+		result := callee.Call(args, nil)
+		vm.sp = vm.sp - numArgs - 1
+		if errObj, ok := result.(*object.Error); ok {
+			return errObj
+		}
+		return vm.push(orNull(result))
+	default:
+		return evaluator.NewTypedError(object.TypeErrorClass, "not a function: %s", callee.Type())
+	}
+}
+
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) *object.Error {
+	if numArgs != cl.Fn.NumParameters {
+		return evaluator.NewTypedError(object.ArgumentErrorClass, "wrong number of arguments: want=%d, got=%d",
+			cl.Fn.NumParameters, numArgs)
+	}
+	if vm.framesIndex >= MaxFrames {
+		return stackOverflow()
+	}
+	basePointer := vm.sp - 1 - numArgs
+	frame := NewFrame(cl, basePointer)
+	copy(frame.locals, vm.stack[vm.sp-numArgs:vm.sp])
+	vm.sp = basePointer
+	vm.pushFrame(frame)
+	return nil
+}
+
+func (vm *VM) pushClosure(constIndex int) *object.Error {
+	fn, ok := vm.constants[constIndex].(*object.CompiledFunction)
+	if !ok {
+		return evaluator.NewTypedError(object.TypeErrorClass, "not a function: %+v", vm.constants[constIndex])
+	}
+	// 由内到外: 当前函数中的循环体, 当前函数的局部变量, 外层的各级存储
+	frame := vm.currentFrame()
+	topLevel := vm.framesIndex == 1 // 顶层没有局部变量, 全局变量直接访问
+	n := len(frame.scopes) + len(frame.cl.Free)
+	if !topLevel {
+		n++
+	}
+	var free [][]object.Object
+	if n > 0 {
+		free = make([][]object.Object, 0, n)
+		for i := len(frame.scopes) - 1; i >= 0; i-- {
+			free = append(free, frame.scopes[i])
+		}
+		if !topLevel {
+			free = append(free, frame.locals)
+		}
+		free = append(free, frame.cl.Free...)
+	}
+	return vm.push(&object.Closure{Fn: fn, Free: free})
+}
+
+func (vm *VM) globalName(index int) string {
+	if index < len(vm.globalNames) {
+		return vm.globalNames[index]
+	}
+	return fmt.Sprintf("global#%d", index)
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) {
+	vm.frames[vm.framesIndex] = f
+	vm.framesIndex++
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+func (vm *VM) push(o object.Object) *object.Error {
+	if errObj, ok := o.(*object.Error); ok {
+		return errObj
+	}
+	if vm.sp >= StackSize {
+		return stackOverflow()
+	}
+	vm.stack[vm.sp] = o
+	vm.sp++
+	return nil
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
+
+// 栈溢出和 evaluator 中超出调用深度一样不能被 catch
+func stackOverflow() *object.Error {
+	errObj := evaluator.NewError("stack overflow")
+	errObj.Kind = object.CallDepthError
+	return errObj
+}
+
+func orNull(o object.Object) object.Object {
+	if o == nil {
+		return evaluator.NULL
+	}
+	return o
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return evaluator.TRUE
+	}
+	return evaluator.FALSE
+}
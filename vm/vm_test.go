@@ -0,0 +1,120 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"github.com/qiuhoude/go-interpreter/compiler"
+	"github.com/qiuhoude/go-interpreter/evaluator"
+	"github.com/qiuhoude/go-interpreter/evaluator/evaltest"
+	"github.com/qiuhoude/go-interpreter/lexer"
+	"github.com/qiuhoude/go-interpreter/object"
+	"github.com/qiuhoude/go-interpreter/parser"
+	. "github.com/smartystreets/goconvey/convey"
+	"regexp"
+	"testing"
+)
+
+func testRun(input string) object.Object {
+	result, err := compileAndRun(input)
+	if err != nil {
+		panic(err)
+	}
+	return result
+}
+
+func compileAndRun(input string) (object.Object, error) {
+	program := parser.New(lexer.New(input)).ParseProgram()
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		return nil, fmt.Errorf("compiler error: %w", err)
+	}
+	machine := New(comp.Bytecode())
+	if err := machine.Run(); err != nil {
+		return nil, fmt.Errorf("vm error: %w", err)
+	}
+	return machine.Result(), nil
+}
+
+var errorPos = regexp.MustCompile(`^ERROR: \d+:\d+: `)
+
+// "ERROR: 1:1: msg" -> "ERROR: msg"
+func withoutPos(inspect string) string {
+	return errorPos.ReplaceAllString(inspect, "ERROR: ")
+}
+
+func testEval(input string) object.Object {
+	program := parser.New(lexer.New(input)).ParseProgram()
+	return evaluator.Eval(program, object.NewGlobalEnv())
+}
+
+// vm 不支持的用例, 编译时必须返回 compiler.ErrUnsupported (见 README).
+// 新增的用例不支持时需要加到这里, vm 支持之后需要从这里删除
+var unsupportedSuites = map[string]string{
+	"FunctionParameters": "默认值, 剩余参数和展开",
+	"NamedArguments":     "命名参数",
+	"Destructuring":      "解构",
+}
+
+// 两种后端对 evaltest 中的用例的执行结果必须一致. vm 中的错误没有位置信息, 比较时去掉位置
+func TestBackendParity(t *testing.T) {
+	Convey("TestBackendParity", t, func() {
+		for _, suite := range evaltest.Suites {
+			name := suite.Name
+			reason, unsupported := unsupportedSuites[suite.Name]
+			if unsupported {
+				name += " (vm 不支持" + reason + ")"
+			}
+			Convey(name, func() {
+				for _, tt := range suite.Cases {
+					Convey(tt.Input, func() {
+						result, err := compileAndRun(tt.Input)
+						if unsupported {
+							So(errors.Is(err, compiler.ErrUnsupported), ShouldBeTrue)
+							return
+						}
+						So(err, ShouldBeNil)
+						So(result.Inspect(), ShouldEqual, withoutPos(tt.Expected))
+					})
+				}
+			})
+		}
+	})
+}
+
+func TestVMOnly(t *testing.T) {
+	Convey("TestVMOnly", t, func() {
+		cases := []struct {
+			input    string
+			expected string
+		}{
+			// 常量池中的 integer 不能被前缀运算修改
+			{"let f = fn() { -5 }; f(); f()", "-5"},
+			{"fn(a, b) { a }(1)", "ERROR: wrong number of arguments: want=2, got=1"},
+			{"1 / 0", "ERROR: division by zero"},
+			{"let f = fn() { f() }; f()", "ERROR: stack overflow"},
+			// 栈溢出不能被 catch
+			{"let f = fn() { f() }; try { f() } catch (e) { 1 }", "ERROR: stack overflow"},
+			{"5()", "ERROR: not a function: INTEGER"},
+		}
+		for _, tt := range cases {
+			So(testRun(tt.input).Inspect(), ShouldEqual, tt.expected)
+		}
+	})
+}
+
+const benchmarkInput = `
+let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+fib(20);
+`
+
+func BenchmarkEvaluator(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		testEval(benchmarkInput)
+	}
+}
+
+func BenchmarkVM(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		testRun(benchmarkInput)
+	}
+}